@@ -0,0 +1,523 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const anonymizationMappingSuffix = "-mapping.json"
+
+// Files with a NUL byte in the head are treated as binary, like git does
+const binaryDetectionSize = 8000
+const binaryScanChunkSize = 1024 * 1024
+const binaryScanOverlap = 256
+
+const (
+	ipv4Kind     = "ipv4"
+	ipv6Kind     = "ipv6"
+	hostnameKind = "hostname"
+)
+
+// Pseudonyms are taken from the benchmarking (198.18.0.0/15) and documentation (2001:db8::/32) ranges
+var ipv4PseudonymBase = net.IPv4(198, 18, 0, 0).To4()
+var ipv6PseudonymBase = net.ParseIP("2001:db8::")
+
+const ipv4AddressPattern = `\d{1,3}(?:\.\d{1,3}){3}`
+const ipv6AddressPattern = `[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`
+
+/* Settings */
+
+type AnonymizationSettings struct {
+	Enabled bool `yaml:"enabled"`
+	// Host names replaced in addition to the target hosts
+	Hostnames []string `yaml:"hostnames"`
+	// Domains all the host names of which are replaced, e.g. "corp.example.com"
+	Domains []string `yaml:"domains"`
+}
+
+func AnonymizationDefaultSettings() *AnonymizationSettings {
+	return &AnonymizationSettings{
+		Enabled:   false,
+		Hostnames: []string{},
+		Domains:   []string{},
+	}
+}
+
+/* Anonymizer */
+
+type AnonymizationMapping struct {
+	Pseudonym string `json:"pseudonym"`
+	Original  string `json:"original"`
+	Kind      string `json:"kind"`
+}
+
+// Anonymizer consistently replaces the IP addresses and host names with pseudonyms across the bundle:
+// file contents (including .gz and .zip archives) and file names. The mapping never goes to the bundle.
+type Anonymizer struct {
+	pattern    *regexp.Regexp
+	pseudonyms map[string]string
+	allocated  map[string]bool
+	mapping    []AnonymizationMapping
+
+	ipv4Count     int
+	ipv6Count     int
+	hostnameCount int
+}
+
+func NewAnonymizer(settings *AnonymizationSettings, hosts []string) (*Anonymizer, error) {
+	hostnames := make([]string, 0)
+	for _, host := range append(append([]string{}, hosts...), settings.Hostnames...) {
+		if net.ParseIP(host) == nil && len(strings.TrimSpace(host)) > 0 {
+			hostnames = append(hostnames, regexp.QuoteMeta(strings.TrimSpace(host)))
+		}
+	}
+	for _, domain := range settings.Domains {
+		domain = strings.Trim(strings.TrimSpace(domain), ".")
+		if len(domain) > 0 {
+			hostnames = append(hostnames, `[\w-]+(?:\.[\w-]+)*\.`+regexp.QuoteMeta(domain))
+		}
+	}
+	// The longest first, so that "node1.example.com" wins over "node1"
+	sort.SliceStable(hostnames, func(i, j int) bool {
+		return len(hostnames[i]) > len(hostnames[j])
+	})
+
+	expression := `(?P<ipv4>` + ipv4AddressPattern + `)|(?P<ipv6>` + ipv6AddressPattern + `)`
+	if len(hostnames) > 0 {
+		expression += `|(?P<hostname>(?i:` + strings.Join(hostnames, "|") + `))`
+	}
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, errors.New("Failed to compile anonymization pattern (" + err.Error() + ")")
+	}
+
+	anonymizer := &Anonymizer{
+		pattern:    pattern,
+		pseudonyms: make(map[string]string),
+		allocated:  make(map[string]bool),
+		mapping:    make([]AnonymizationMapping, 0),
+	}
+
+	// Targets get the first pseudonyms, in the order given
+	for _, host := range hosts {
+		anonymizer.Replace([]byte(host))
+	}
+
+	return anonymizer, nil
+}
+
+// Replace returns the text with the addresses and host names replaced by their pseudonyms
+func (anonymizer *Anonymizer) Replace(text []byte) []byte {
+	spans := anonymizer.find(text)
+	if len(spans) == 0 {
+		return text
+	}
+
+	var replaced bytes.Buffer
+	position := 0
+	for _, span := range spans {
+		replaced.Write(text[position:span.start])
+		replaced.WriteString(anonymizer.pseudonym(span.kind, string(text[span.start:span.end])))
+		position = span.end
+	}
+	replaced.Write(text[position:])
+
+	return replaced.Bytes()
+}
+
+// Anonymize rewrites all the files under the root and renames the files and folders named by hosts.
+// Binary files containing addresses (e.g. Prometheus TSDB index) can't be rewritten, so they are
+// removed; the relative paths (anonymized) of the removed files are returned.
+func (anonymizer *Anonymizer) Anonymize(root string) ([]string, error) {
+	paths := make([]string, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dropped := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		removed, err := anonymizer.AnonymizeFile(path)
+		if err != nil {
+			return nil, errors.New("Failed to anonymize '" + path + "' (" + err.Error() + ")")
+		}
+		if removed {
+			relative, _ := filepath.Rel(root, path)
+			dropped = append(dropped, filepath.ToSlash(string(anonymizer.Replace([]byte(relative)))))
+		}
+	}
+
+	// Walk lists the parents first, so renaming in the reverse order keeps the parents' paths valid
+	for index := len(paths) - 1; index >= 0; index-- {
+		name := filepath.Base(paths[index])
+		pseudonym := string(anonymizer.Replace([]byte(name)))
+		if pseudonym == name {
+			continue
+		}
+
+		_, err := os.Lstat(paths[index])
+		if os.IsNotExist(err) {
+			continue
+		}
+		err = os.Rename(paths[index], filepath.Join(filepath.Dir(paths[index]), pseudonym))
+		if err != nil {
+			return nil, errors.New("Failed to rename '" + paths[index] + "' (" + err.Error() + ")")
+		}
+	}
+
+	return dropped, nil
+}
+
+// AnonymizeFile rewrites the file contents in place, it returns true when the file has been removed
+func (anonymizer *Anonymizer) AnonymizeFile(path string) (bool, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		return anonymizer.rewriteFile(path, anonymizer.anonymizeGzip)
+	case ".zip":
+		return anonymizer.rewriteFile(path, anonymizer.anonymizeZip)
+	}
+	return anonymizer.rewriteFile(path, anonymizer.anonymizeStream)
+}
+
+// SaveMapping saves the pseudonyms to de-anonymize the findings, readable by the owner only
+func (anonymizer *Anonymizer) SaveMapping(path string) error {
+	data, err := json.MarshalIndent(anonymizer.mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+type anonymizeFunc func(src *os.File, dst io.Writer) (changed bool, sensitive bool, err error)
+
+func (anonymizer *Anonymizer) rewriteFile(path string, anonymize anonymizeFunc) (bool, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	dst, err := ioutil.TempFile(filepath.Dir(path), ".anonymize-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(dst.Name())
+
+	changed, sensitive, err := anonymize(src, dst)
+	closeErr := dst.Close()
+	src.Close()
+	if err != nil {
+		return false, err
+	}
+	if closeErr != nil {
+		return false, closeErr
+	}
+
+	if sensitive {
+		return true, os.Remove(path)
+	}
+	if changed {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		err = os.Chmod(dst.Name(), info.Mode())
+		if err != nil {
+			return false, err
+		}
+		err = os.Rename(dst.Name(), path)
+		if err != nil {
+			return false, err
+		}
+		return false, os.Chtimes(path, info.ModTime(), info.ModTime())
+	}
+	return false, nil
+}
+
+// anonymizeStream copies the text replacing the addresses line by line. Binary content is copied as is,
+// sensitive reports whether it contains any address.
+func (anonymizer *Anonymizer) anonymizeStream(src *os.File, dst io.Writer) (bool, bool, error) {
+	return anonymizer.anonymizeReader(src, dst)
+}
+
+func (anonymizer *Anonymizer) anonymizeReader(src io.Reader, dst io.Writer) (bool, bool, error) {
+	reader := bufio.NewReaderSize(src, binaryScanChunkSize)
+	head, err := reader.Peek(binaryDetectionSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, false, err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		sensitive, err := anonymizer.scanBinary(reader, dst)
+		return false, sensitive, err
+	}
+
+	writer := bufio.NewWriter(dst)
+	changed := false
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			replaced := anonymizer.Replace(line)
+			if !bytes.Equal(replaced, line) {
+				changed = true
+			}
+			_, writeErr := writer.Write(replaced)
+			if writeErr != nil {
+				return false, false, writeErr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, false, err
+		}
+	}
+
+	return changed, false, writer.Flush()
+}
+
+// scanBinary copies the content in chunks, overlapping them so that the addresses on the chunk
+// boundaries are found too
+func (anonymizer *Anonymizer) scanBinary(src io.Reader, dst io.Writer) (bool, error) {
+	sensitive := false
+	buffer := make([]byte, binaryScanOverlap+binaryScanChunkSize)
+	overlap := 0
+	for {
+		n, err := io.ReadFull(src, buffer[overlap:])
+		if n > 0 {
+			_, writeErr := dst.Write(buffer[overlap : overlap+n])
+			if writeErr != nil {
+				return false, writeErr
+			}
+			if !sensitive && len(anonymizer.find(buffer[:overlap+n])) > 0 {
+				sensitive = true
+			}
+
+			size := overlap + n
+			overlap = binaryScanOverlap
+			if size < overlap {
+				overlap = size
+			}
+			copy(buffer, buffer[size-overlap:size])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sensitive, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+func (anonymizer *Anonymizer) anonymizeGzip(src *os.File, dst io.Writer) (bool, bool, error) {
+	reader, err := gzip.NewReader(src)
+	if err != nil {
+		return false, false, err
+	}
+	defer reader.Close()
+
+	writer := gzip.NewWriter(dst)
+	writer.Name = string(anonymizer.Replace([]byte(reader.Name)))
+	writer.ModTime = reader.ModTime
+
+	changed, sensitive, err := anonymizer.anonymizeReader(reader, writer)
+	if err != nil {
+		return false, false, err
+	}
+
+	return changed || writer.Name != reader.Name, sensitive, writer.Close()
+}
+
+func (anonymizer *Anonymizer) anonymizeZip(src *os.File, dst io.Writer) (bool, bool, error) {
+	info, err := src.Stat()
+	if err != nil {
+		return false, false, err
+	}
+	archive, err := zip.NewReader(src, info.Size())
+	if err != nil {
+		return false, false, err
+	}
+
+	writer := zip.NewWriter(dst)
+	changed := false
+	for _, file := range archive.File {
+		header := file.FileHeader
+		header.Name = string(anonymizer.Replace([]byte(file.Name)))
+		if header.Name != file.Name {
+			changed = true
+		}
+
+		entry, err := writer.CreateHeader(&header)
+		if err != nil {
+			return false, false, err
+		}
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return false, false, err
+		}
+		entryChanged, sensitive, err := anonymizer.anonymizeReader(reader, entry)
+		reader.Close()
+		if err != nil {
+			return false, false, err
+		}
+		if sensitive {
+			return false, true, nil
+		}
+		changed = changed || entryChanged
+	}
+
+	return changed, false, writer.Close()
+}
+
+type anonymizationSpan struct {
+	start int
+	end   int
+	kind  string
+}
+
+// find returns the valid addresses and the host names found in the text
+func (anonymizer *Anonymizer) find(text []byte) []anonymizationSpan {
+	spans := make([]anonymizationSpan, 0)
+	for _, match := range anonymizer.pattern.FindAllSubmatchIndex(text, -1) {
+		for group, kind := range anonymizer.pattern.SubexpNames() {
+			if len(kind) == 0 || match[2*group] < 0 {
+				continue
+			}
+
+			span := anonymizationSpan{start: match[2*group], end: match[2*group+1], kind: kind}
+			if anonymizer.isValid(text, span) {
+				spans = append(spans, span)
+			}
+		}
+	}
+	return spans
+}
+
+func (anonymizer *Anonymizer) isValid(text []byte, span anonymizationSpan) bool {
+	var before, after, next byte
+	if span.start > 0 {
+		before = text[span.start-1]
+	}
+	if span.end < len(text) {
+		after = text[span.end]
+	}
+	if span.end+1 < len(text) {
+		next = text[span.end+1]
+	}
+	value := string(text[span.start:span.end])
+
+	switch span.kind {
+	case ipv4Kind:
+		// Skip versions and OIDs like 1.3.6.1.4.1
+		if isDigit(before) || before == '.' || isDigit(after) || (after == '.' && isDigit(next)) {
+			return false
+		}
+		ip := net.ParseIP(value)
+		return ip != nil && isSensitiveIP(ip)
+	case ipv6Kind:
+		// Skip Java method references like Class::method and time stamps
+		if isHostnameChar(before) || before == ':' || isHostnameChar(after) || after == ':' {
+			return false
+		}
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() == nil && isSensitiveIP(ip)
+	case hostnameKind:
+		return !isHostnameChar(before) && !isHostnameChar(after)
+	}
+	return false
+}
+
+// Loopback, unspecified, broadcast and net mask like addresses tell nothing about the network
+func isSensitiveIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil && (ip4[0] == 0 || ip4[0] == 255) {
+		return false
+	}
+	return true
+}
+
+func (anonymizer *Anonymizer) pseudonym(kind string, value string) string {
+	key := value
+	switch kind {
+	case ipv4Kind, ipv6Kind:
+		key = net.ParseIP(value).String()
+	case hostnameKind:
+		key = strings.ToLower(value)
+	}
+
+	pseudonym, ok := anonymizer.pseudonyms[key]
+	if ok {
+		return pseudonym
+	}
+	// Already anonymized, e.g. the paths logged after anonymizing the bundle
+	if anonymizer.allocated[key] {
+		return value
+	}
+
+	switch kind {
+	case ipv4Kind:
+		anonymizer.ipv4Count++
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(ipv4PseudonymBase)+uint32(anonymizer.ipv4Count))
+		pseudonym = ip.String()
+	case ipv6Kind:
+		anonymizer.ipv6Count++
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, ipv6PseudonymBase)
+		binary.BigEndian.PutUint32(ip[12:], uint32(anonymizer.ipv6Count))
+		pseudonym = ip.String()
+	default:
+		anonymizer.hostnameCount++
+		pseudonym = "host-" + strconv.Itoa(anonymizer.hostnameCount)
+	}
+
+	anonymizer.pseudonyms[key] = pseudonym
+	anonymizer.allocated[pseudonym] = true
+	anonymizer.mapping = append(anonymizer.mapping, AnonymizationMapping{Pseudonym: pseudonym, Original: key, Kind: kind})
+
+	return pseudonym
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHostnameChar(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '-' || c == '_'
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnonymizer_Replace(t *testing.T) {
+	settings := AnonymizationDefaultSettings()
+	settings.Domains = []string{"corp.example.com"}
+
+	anonymizer, err := NewAnonymizer(settings, []string{"10.0.0.2", "node1.dc1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t,
+		"UN  198.18.0.2  1.2 GiB  256  ?  d2b1  rack1\n",
+		string(anonymizer.Replace([]byte("UN  10.0.0.1  1.2 GiB  256  ?  d2b1  rack1\n"))))
+	assert.Equal(t,
+		"/198.18.0.1\n  RPC_ADDRESS:198.18.0.2\n",
+		string(anonymizer.Replace([]byte("/10.0.0.2\n  RPC_ADDRESS:10.0.0.1\n"))))
+	assert.Equal(t,
+		"Handshaking version with host-1/198.18.0.1:7000, host-2 and host-3",
+		string(anonymizer.Replace([]byte("Handshaking version with NODE1.dc1/10.0.0.2:7000, db7.corp.example.com and db8.Corp.Example.com"))))
+	assert.Equal(t,
+		"listen_address: 2001:db8::1 # [2001:db8::1]:7000",
+		string(anonymizer.Replace([]byte("listen_address: fd00:10::7 # [fd00:10::7]:7000"))))
+
+	// Not addresses
+	for _, text := range []string{
+		"ReleaseVersion: 4.0.11",
+		"oid 1.3.6.1.4.1.2021",
+		"localhost/127.0.0.1 and 0.0.0.0 mask 255.255.255.0",
+		"INFO  [main] 2022-01-01 10:11:12,345 Foo::bar at 10:11:12 ::1",
+		"java.version=1.8.0_292 node1.dc1x",
+		"already 198.18.0.1 and host-1",
+	} {
+		assert.Equal(t, text, string(anonymizer.Replace([]byte(text))))
+	}
+
+	assert.Equal(t, []AnonymizationMapping{
+		{Pseudonym: "198.18.0.1", Original: "10.0.0.2", Kind: "ipv4"},
+		{Pseudonym: "host-1", Original: "node1.dc1", Kind: "hostname"},
+		{Pseudonym: "198.18.0.2", Original: "10.0.0.1", Kind: "ipv4"},
+		{Pseudonym: "host-2", Original: "db7.corp.example.com", Kind: "hostname"},
+		{Pseudonym: "host-3", Original: "db8.corp.example.com", Kind: "hostname"},
+		{Pseudonym: "2001:db8::1", Original: "fd00:10::7", Kind: "ipv6"},
+	}, anonymizer.mapping)
+}
+
+func TestAnonymizer_Anonymize(t *testing.T) {
+	root, err := ioutil.TempDir("", "bundle")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(root)
+
+	write := func(path string, data []byte) {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+	}
+
+	var gz bytes.Buffer
+	gzWriter := gzip.NewWriter(&gz)
+	gzWriter.Write([]byte("INFO  Node /10.0.0.2 state jump to NORMAL\n"))
+	gzWriter.Close()
+
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	entry, _ := zipWriter.Create("system.log.1")
+	entry.Write([]byte("Gossiping with node1.dc1\n"))
+	zipWriter.Close()
+
+	write("nodes/node1.dc1/info/status.info", []byte("UN  10.0.0.1  rack1\nUN  10.0.0.2  rack1\n"))
+	write("nodes/node1.dc1/logs/system.log.1.gz", gz.Bytes())
+	write("nodes/node1.dc1/logs/system.log.2.zip", archive.Bytes())
+	write("metrics/index", append([]byte{0, 1, 2}, []byte("instance=10.0.0.1:9500")...))
+	write("metrics/chunks/000001", []byte{0, 1, 2, 3})
+
+	anonymizer, err := NewAnonymizer(AnonymizationDefaultSettings(), []string{"node1.dc1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	dropped, err := anonymizer.Anonymize(root)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"metrics/index"}, dropped)
+
+	data, err := ioutil.ReadFile(filepath.Join(root, "nodes/host-1/info/status.info"))
+	assert.NoError(t, err)
+	assert.Equal(t, "UN  198.18.0.1  rack1\nUN  198.18.0.2  rack1\n", string(data))
+
+	file, err := os.Open(filepath.Join(root, "nodes/host-1/logs/system.log.1.gz"))
+	if assert.NoError(t, err) {
+		reader, err := gzip.NewReader(file)
+		if assert.NoError(t, err) {
+			data, _ = ioutil.ReadAll(reader)
+			assert.Equal(t, "INFO  Node /198.18.0.2 state jump to NORMAL\n", string(data))
+		}
+		file.Close()
+	}
+
+	zipReader, err := zip.OpenReader(filepath.Join(root, "nodes/host-1/logs/system.log.2.zip"))
+	if assert.NoError(t, err) {
+		reader, _ := zipReader.File[0].Open()
+		data, _ = ioutil.ReadAll(reader)
+		assert.Equal(t, "Gossiping with host-1\n", string(data))
+		zipReader.Close()
+	}
+
+	assert.FileExists(t, filepath.Join(root, "metrics/chunks/000001"))
+	_, err = os.Stat(filepath.Join(root, "nodes/node1.dc1"))
+	assert.True(t, os.IsNotExist(err))
+
+	mappingPath := filepath.Join(root, "..", filepath.Base(root)+anonymizationMappingSuffix)
+	defer os.Remove(mappingPath)
+	assert.NoError(t, anonymizer.SaveMapping(mappingPath))
+
+	var mapping []AnonymizationMapping
+	data, _ = ioutil.ReadFile(mappingPath)
+	assert.NoError(t, json.Unmarshal(data, &mapping))
+	assert.Equal(t, []AnonymizationMapping{
+		{Pseudonym: "host-1", Original: "node1.dc1", Kind: "hostname"},
+		{Pseudonym: "198.18.0.1", Original: "10.0.0.1", Kind: "ipv4"},
+		{Pseudonym: "198.18.0.2", Original: "10.0.0.2", Kind: "ipv4"},
+	}, mapping)
+}
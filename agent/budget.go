@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const bundleMetadataFileName = "metadata.json"
+
+// Artifact classes by collected folder, classes without priority are never trimmed
+var nodeArtifactClasses = map[string]string{
+	"config":      "config",
+	"logs":        "logs",
+	"gc_logs":     "gc-logs",
+	"info":        "info",
+	"cql":         "cql",
+	"jvm":         "jvm",
+	"os":          "os",
+	"network":     "network",
+	"sstables":    "sstables",
+	"maintenance": "maintenance",
+	"custom":      "custom",
+}
+
+type BundleMetadata struct {
+	MaxBundleSize int64            `json:"max-bundle-size"`
+	CollectedSize int64            `json:"collected-size"`
+	BundleSize    int64            `json:"bundle-size"`
+	Dropped       []BundleArtifact `json:"dropped"`
+}
+
+type BundleArtifact struct {
+	Path     string    `json:"path"`
+	Class    string    `json:"class"`
+	Priority int       `json:"priority"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// TrimToBudget removes the collected files until their size fits the budget, the lowest priority
+// and the oldest files first. The size is measured before compressing, so the bundle ends up smaller.
+func TrimToBudget(root string, maxSize int64, priorities map[string]int) (*BundleMetadata, error) {
+	metadata := &BundleMetadata{MaxBundleSize: maxSize, Dropped: make([]BundleArtifact, 0)}
+
+	candidates := make([]BundleArtifact, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		metadata.CollectedSize += info.Size()
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		class := artifactClass(relative)
+		priority, ok := priorities[class]
+		if ok {
+			candidates = append(candidates, BundleArtifact{
+				Path:     filepath.ToSlash(relative),
+				Class:    class,
+				Priority: priority,
+				Size:     info.Size(),
+				Modified: info.ModTime().UTC(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority < candidates[j].Priority
+		}
+		return candidates[i].Modified.Before(candidates[j].Modified)
+	})
+
+	metadata.BundleSize = metadata.CollectedSize
+	for _, candidate := range candidates {
+		if metadata.BundleSize <= maxSize {
+			break
+		}
+
+		err = os.Remove(filepath.Join(root, filepath.FromSlash(candidate.Path)))
+		if err != nil {
+			return nil, err
+		}
+		metadata.BundleSize -= candidate.Size
+		metadata.Dropped = append(metadata.Dropped, candidate)
+	}
+
+	return metadata, nil
+}
+
+func (metadata *BundleMetadata) Save(root string) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(root, bundleMetadataFileName), data, 0644)
+}
+
+// artifactClass classifies the file by the collected folder, e.g. nodes/<host>/gc_logs/gc.log is "gc-logs"
+func artifactClass(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) > 1 && parts[0] == "metrics" {
+		return "metrics"
+	}
+	if len(parts) > 3 && parts[0] == "nodes" {
+		return nodeArtifactClasses[parts[2]]
+	}
+	return ""
+}
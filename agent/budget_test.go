@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrimToBudget(t *testing.T) {
+	root, err := ioutil.TempDir("", "bundle")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(root)
+
+	now := time.Now()
+	files := []struct {
+		path string
+		size int
+		age  time.Duration
+	}{
+		{"agent.log", 100, 0},
+		{"metrics/prometheus/InstaclustrCollection.tar", 1000, 0},
+		{"nodes/10.0.0.1/logs/system.log", 300, 0},
+		{"nodes/10.0.0.1/logs/system.log.1.zip", 300, time.Hour},
+		{"nodes/10.0.0.1/logs/system.log.2.zip", 300, 2 * time.Hour},
+		{"nodes/10.0.0.1/info/status.info", 10, 0},
+	}
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file.path))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile(path, make([]byte, file.size), 0644))
+		assert.NoError(t, os.Chtimes(path, now.Add(-file.age), now.Add(-file.age)))
+	}
+
+	priorities := AgentDefaultSettings().BundlePriorities
+	metadata, err := TrimToBudget(root, 500, priorities)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(2010), metadata.CollectedSize)
+	assert.Equal(t, int64(410), metadata.BundleSize)
+
+	dropped := make([]string, 0)
+	for _, artifact := range metadata.Dropped {
+		dropped = append(dropped, artifact.Path)
+	}
+	assert.Equal(t, []string{
+		"metrics/prometheus/InstaclustrCollection.tar",
+		"nodes/10.0.0.1/logs/system.log.2.zip",
+		"nodes/10.0.0.1/logs/system.log.1.zip",
+	}, dropped)
+
+	_, err = os.Stat(filepath.Join(root, "nodes/10.0.0.1/logs/system.log.2.zip"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "nodes/10.0.0.1/logs/system.log"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, metadata.Save(root))
+	_, err = os.Stat(filepath.Join(root, bundleMetadataFileName))
+	assert.NoError(t, err)
+}
+
+func TestArtifactClass(t *testing.T) {
+	assert.Equal(t, "gc-logs", artifactClass(filepath.FromSlash("nodes/10.0.0.1/gc_logs/gc.log.0")))
+	assert.Equal(t, "metrics", artifactClass(filepath.FromSlash("metrics/rules/rules.yml")))
+	assert.Equal(t, "", artifactClass("agent.log"))
+}
+
+// Every node folder must have a class with a priority, or it would never be trimmed
+func TestArtifactClass_NodeFolders(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("collector", "*.go"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	folder := regexp.MustCompile(`makeFolder\(agent\.GetHost\(\), "([^"]+)"\)`)
+	priorities := AgentDefaultSettings().BundlePriorities
+	found := 0
+	for _, source := range sources {
+		if strings.HasSuffix(source, "_test.go") {
+			continue
+		}
+		data, err := ioutil.ReadFile(source)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, match := range folder.FindAllSubmatch(data, -1) {
+			found++
+			name := string(match[1])
+			class, ok := nodeArtifactClasses[name]
+			if assert.True(t, ok, "folder '%s' of %s has no artifact class", name, source) {
+				assert.Contains(t, priorities, class, "class '%s' has no default priority", class)
+			}
+		}
+	}
+	assert.NotZero(t, found)
+}
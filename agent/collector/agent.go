@@ -9,8 +9,10 @@ import (
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,8 +20,9 @@ import (
 type ProgressFunc func(copied int64, size int64, remaining time.Duration)
 
 type FileInfo struct {
-	Path  string
-	IdDir bool
+	Path    string
+	IdDir   bool
+	ModTime time.Time
 }
 
 type SSHCollectingAgent interface {
@@ -30,12 +33,17 @@ type SSHCollectingAgent interface {
 
 	Connect() error
 	ExecuteCommand(cmd string) (*bytes.Buffer, *bytes.Buffer, error)
+	ExecuteCommandWithInput(cmd string, input []byte) (*bytes.Buffer, *bytes.Buffer, error)
 
 	GetContent(path string) (*bytes.Buffer, error)
+	PutContent(path string, content []byte, mode os.FileMode) error
 	ListDirectory(path string) ([]FileInfo, error)
 	ReceiveFile(src, dest string, progressFn ProgressFunc) error
 	ReceiveDir(src, dest string, progressFn ProgressFunc) error
+	ReceiveCommandOutput(cmd, dest string, progressFn ProgressFunc) error
 	Remove(path string) error
+
+	Dial(network, address string) (net.Conn, error)
 }
 
 type SSHAgent struct {
@@ -71,6 +79,12 @@ func (agent *SSHAgent) Connect() error {
 }
 
 func (agent *SSHAgent) ExecuteCommand(cmd string) (*bytes.Buffer, *bytes.Buffer, error) {
+	return agent.ExecuteCommandWithInput(cmd, nil)
+}
+
+// ExecuteCommandWithInput runs the command feeding the input to its stdin,
+// it keeps secrets out of the remote command line.
+func (agent *SSHAgent) ExecuteCommandWithInput(cmd string, input []byte) (*bytes.Buffer, *bytes.Buffer, error) {
 	session, err := agent.client.NewSession()
 	if err != nil {
 		return nil, nil, errors.New("SSH agent: Failed to create SSH session to '" + agent.host + "'")
@@ -80,6 +94,9 @@ func (agent *SSHAgent) ExecuteCommand(cmd string) (*bytes.Buffer, *bytes.Buffer,
 	var outBuffer, errBuffer bytes.Buffer
 	session.Stdout = &outBuffer
 	session.Stderr = &errBuffer
+	if input != nil {
+		session.Stdin = bytes.NewReader(input)
+	}
 	err = session.Run(cmd)
 	if err != nil {
 		return &outBuffer, &errBuffer, errors.New("SSH agent: Failed to run command '" + cmd + "' on '" + agent.host + "'. (" + err.Error() + ")")
@@ -88,6 +105,11 @@ func (agent *SSHAgent) ExecuteCommand(cmd string) (*bytes.Buffer, *bytes.Buffer,
 	return &outBuffer, &errBuffer, nil
 }
 
+// Dial opens a connection to the address from the remote host, tunneled over SSH.
+func (agent *SSHAgent) Dial(network, address string) (net.Conn, error) {
+	return agent.client.Dial(network, address)
+}
+
 func (agent *SSHAgent) GetContent(path string) (*bytes.Buffer, error) {
 	path = filepath.Clean(path)
 
@@ -112,6 +134,35 @@ func (agent *SSHAgent) GetContent(path string) (*bytes.Buffer, error) {
 	return buf, nil
 }
 
+func (agent *SSHAgent) PutContent(path string, content []byte, mode os.FileMode) error {
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	client, err := sftp.NewClient(agent.client)
+	if err != nil {
+		return errors.New("SSH agent: Failed to create SFTP session (" + err.Error() + ")")
+	}
+	defer client.Close()
+
+	file, err := client.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return errors.New("SSH agent: Failed to open file over SFTP (" + err.Error() + ")")
+	}
+	defer file.Close()
+
+	// Restrict permissions before the content is written
+	err = file.Chmod(mode)
+	if err != nil {
+		return errors.New("SSH agent: Failed to change file mode over SFTP (" + err.Error() + ")")
+	}
+
+	_, err = file.Write(content)
+	if err != nil {
+		return errors.New("SSH agent: Failed to write file over SFTP (" + err.Error() + ")")
+	}
+
+	return nil
+}
+
 func (agent *SSHAgent) ListDirectory(path string) ([]FileInfo, error) {
 	path = filepath.Clean(path)
 
@@ -129,7 +180,7 @@ func (agent *SSHAgent) ListDirectory(path string) ([]FileInfo, error) {
 	infos := make([]FileInfo, 0)
 	for _, info := range dir {
 		path := filepath.Join(path, info.Name())
-		infos = append(infos, FileInfo{path, info.IsDir()})
+		infos = append(infos, FileInfo{path, info.IsDir(), info.ModTime()})
 	}
 
 	return infos, nil
@@ -272,6 +323,61 @@ func (agent *SSHAgent) ReceiveDir(src, dest string, progressFn ProgressFunc) err
 	return nil
 }
 
+// ReceiveCommandOutput runs the command on the remote host and streams its stdout
+// straight into the local dest file, the total size is not known in advance (-1).
+func (agent *SSHAgent) ReceiveCommandOutput(cmd, dest string, progressFn ProgressFunc) error {
+	dest = filepath.Clean(dest)
+
+	err := agent.createDirectoryIfNotExists(filepath.Dir(dest))
+	if err != nil {
+		return err
+	}
+
+	session, err := agent.client.NewSession()
+	if err != nil {
+		return errors.New("SSH agent: Failed to create SSH session to '" + agent.host + "'")
+	}
+	defer session.Close()
+
+	destFile, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.New("SSH agent: Failed to open destination file (" + err.Error() + ")")
+	}
+
+	progressWriter := progress.NewWriter(destFile)
+
+	if progressFn != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go func() {
+			progressChan := progress.NewTicker(ctx, progressWriter, -1, 1*time.Second)
+
+			for p := range progressChan {
+				progressFn(p.N(), p.Size(), p.Remaining())
+			}
+		}()
+	}
+
+	var errBuffer bytes.Buffer
+	session.Stdout = progressWriter
+	session.Stderr = &errBuffer
+	err = session.Run(cmd)
+	closeErr := destFile.Close()
+	// The truncated or partial output must not be taken for the collected one
+	if err != nil {
+		os.Remove(dest)
+		return errors.New("SSH agent: Failed to stream command '" + cmd + "' output from '" + agent.host + "'. (" +
+			err.Error() + " " + strings.TrimSpace(errBuffer.String()) + ")")
+	}
+	if closeErr != nil {
+		os.Remove(dest)
+		return errors.New("SSH agent: Failed to write destination file (" + closeErr.Error() + ")")
+	}
+
+	return nil
+}
+
 func (agent *SSHAgent) getDirSize(client *sftp.Client, path string) int64 {
 	var size int64 = 0
 	walker := client.Walk(path)
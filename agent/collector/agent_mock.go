@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"github.com/stretchr/testify/mock"
 	"golang.org/x/crypto/ssh"
+	"net"
+	"os"
 )
 
 type mockedSSHAgentObject struct {
@@ -34,11 +36,21 @@ func (m *mockedSSHAgentObject) ExecuteCommand(cmd string) (*bytes.Buffer, *bytes
 	return ret.Get(0).(*bytes.Buffer), ret.Get(1).(*bytes.Buffer), ret.Error(2)
 }
 
+func (m *mockedSSHAgentObject) ExecuteCommandWithInput(cmd string, input []byte) (*bytes.Buffer, *bytes.Buffer, error) {
+	ret := m.Called(cmd, input)
+	return ret.Get(0).(*bytes.Buffer), ret.Get(1).(*bytes.Buffer), ret.Error(2)
+}
+
 func (m *mockedSSHAgentObject) GetContent(path string) (*bytes.Buffer, error) {
 	ret := m.Called(path)
 	return ret.Get(0).(*bytes.Buffer), ret.Error(1)
 }
 
+func (m *mockedSSHAgentObject) PutContent(path string, content []byte, mode os.FileMode) error {
+	ret := m.Called(path, content, mode)
+	return ret.Error(0)
+}
+
 func (m *mockedSSHAgentObject) ListDirectory(path string) ([]FileInfo, error) {
 	ret := m.Called(path)
 	return ret.Get(0).([]FileInfo), ret.Error(1)
@@ -54,6 +66,19 @@ func (m *mockedSSHAgentObject) ReceiveDir(src, dest string, progressFn ProgressF
 	return ret.Error(0)
 }
 
+func (m *mockedSSHAgentObject) ReceiveCommandOutput(cmd, dest string, progressFn ProgressFunc) error {
+	ret := m.Called(cmd, dest, progressFn)
+	return ret.Error(0)
+}
+
+func (m *mockedSSHAgentObject) Dial(network, address string) (net.Conn, error) {
+	ret := m.Called(network, address)
+	if conn, ok := ret.Get(0).(net.Conn); ok {
+		return conn, ret.Error(1)
+	}
+	return nil, ret.Error(1)
+}
+
 func (m *mockedSSHAgentObject) Remove(path string) error {
 	ret := m.Called(path)
 	return ret.Error(0)
@@ -0,0 +1,259 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gocql/gocql"
+	"github.com/spf13/afero"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+const describeSchemaQuery = "DESCRIBE SCHEMA"
+const releaseVersionQuery = "SELECT release_version FROM system.local"
+const selectTableQueryTemplate = "SELECT * FROM %s"
+const schemaFileName = "schema.cql"
+
+/*
+Settings
+*/
+type CQLSettings struct {
+	Enabled bool           `yaml:"enabled"`
+	Host    string         `yaml:"host"`
+	Port    int            `yaml:"port"`
+	Timeout time.Duration  `yaml:"timeout"`
+	TLS     CQLTLSSettings `yaml:"tls"`
+	Schema  bool           `yaml:"schema"`
+	Tables  []string       `yaml:"tables"`
+}
+
+// Client TLS, the paths are local to the agent
+type CQLTLSSettings struct {
+	Enabled          bool   `yaml:"enabled"`
+	CAPath           string `yaml:"ca-path"`
+	CertPath         string `yaml:"cert-path"`
+	KeyPath          string `yaml:"key-path"`
+	HostVerification bool   `yaml:"host-verification"`
+	ServerName       string `yaml:"server-name"`
+}
+
+func CQLDefaultSettings() CQLSettings {
+	return CQLSettings{
+		Enabled: true,
+		Host:    "127.0.0.1",
+		Port:    9042,
+		Timeout: time.Minute,
+		TLS: CQLTLSSettings{
+			Enabled:          false,
+			CAPath:           "",
+			CertPath:         "",
+			KeyPath:          "",
+			HostVerification: false,
+			ServerName:       "",
+		},
+		Schema: true,
+		Tables: []string{
+			"system_schema.keyspaces",
+			"system_schema.tables",
+			"system_schema.columns",
+			"system_schema.dropped_columns",
+			"system_schema.indexes",
+			"system_schema.triggers",
+			"system_schema.types",
+			"system_schema.functions",
+			"system_schema.aggregates",
+			"system_schema.views",
+			"system.local",
+			"system.peers",
+			"system.peers_v2",
+			"system_views.settings",
+			"system.size_estimates",
+		},
+	}
+}
+
+/*
+Collector
+*/
+func (collector *NodeCollector) collectCQLInfo(agent SSHCollectingAgent) error {
+	path, err := collector.makeFolder(agent.GetHost(), "cql")
+	if err != nil {
+		return err
+	}
+
+	session, err := collector.createCQLSession(agent)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if collector.Settings.Collecting.CQL.Schema {
+		err = collector.collectCQLSchema(session, path)
+		if err != nil {
+			collector.log.Warn(err)
+		}
+	}
+
+	findings := make([]redactionFinding, 0)
+	for _, table := range collector.Settings.Collecting.CQL.Tables {
+		err = collector.collectCQLTable(session, path, table, &findings)
+		if err != nil {
+			collector.log.Warn(err)
+		}
+	}
+
+	return collector.saveOutputsRedactionReport(path, findings)
+}
+
+// Connections are tunneled over SSH and kept to the node itself, no peers are discovered
+func (collector *NodeCollector) createCQLSession(agent SSHCollectingAgent) (*gocql.Session, error) {
+	settings := collector.Settings.Collecting.CQL
+
+	cluster := gocql.NewCluster(settings.Host)
+	cluster.Port = settings.Port
+	cluster.Timeout = settings.Timeout
+	cluster.ConnectTimeout = settings.Timeout
+	cluster.NumConns = 1
+	cluster.Consistency = gocql.One
+	cluster.Dialer = &sshDialer{agent: agent}
+	cluster.DisableInitialHostLookup = true
+	cluster.Events.DisableNodeStatusEvents = true
+	cluster.Events.DisableTopologyEvents = true
+	cluster.Events.DisableSchemaEvents = true
+	cluster.Logger = collector.log
+
+	if len(collector.Settings.Cassandra.Username) > 0 {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: collector.Settings.Cassandra.Username,
+			Password: collector.Settings.Cassandra.Password,
+		}
+	}
+
+	if settings.TLS.Enabled {
+		cluster.SslOpts = &gocql.SslOptions{
+			Config:                 &tls.Config{ServerName: settings.TLS.ServerName},
+			CaPath:                 settings.TLS.CAPath,
+			CertPath:               settings.TLS.CertPath,
+			KeyPath:                settings.TLS.KeyPath,
+			EnableHostVerification: settings.TLS.HostVerification,
+		}
+	}
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, errors.New("Failed to connect CQL at '" + net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port)) +
+			"' (" + err.Error() + ")")
+	}
+
+	return session, nil
+}
+
+// Server side DESCRIBE is available since Cassandra 4.0, the system_schema tables describe the older versions
+func (collector *NodeCollector) collectCQLSchema(session *gocql.Session, path string) error {
+	var version string
+	err := session.Query(releaseVersionQuery).Scan(&version)
+	if err != nil {
+		collector.log.Warn("Failed to check Cassandra version, describing schema anyway (" + err.Error() + ")")
+	} else if !describeSchemaSupported(version) {
+		collector.log.Warn("Skipped describing schema, DESCRIBE SCHEMA needs Cassandra 4.0 or later (version " + version +
+			"), the system_schema tables are collected with node.collecting.cql.tables")
+		return nil
+	}
+
+	var schema strings.Builder
+
+	iter := session.Query(describeSchemaQuery).Iter()
+	row := make(map[string]interface{})
+	for iter.MapScan(row) {
+		if statement, ok := row["create_statement"].(string); ok {
+			schema.WriteString(statement)
+			schema.WriteString("\n\n")
+		}
+		row = make(map[string]interface{})
+	}
+	err = iter.Close()
+	if err != nil {
+		return errors.New("Failed to describe schema (" + err.Error() + ")")
+	}
+
+	err = afero.WriteFile(collector.AppFs, filepath.Join(path, schemaFileName), []byte(schema.String()), os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to write schema (" + err.Error() + ")")
+	}
+
+	return nil
+}
+
+// describeSchemaSupported checks the release version, e.g. 3.11.10 or 4.0.1, an unknown one is tried
+func describeSchemaSupported(version string) bool {
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	return err != nil || major >= 4
+}
+
+func (collector *NodeCollector) collectCQLTable(session *gocql.Session, path string, table string, findings *[]redactionFinding) error {
+	return collector.collectCQLQuery(session, path, table, fmt.Sprintf(selectTableQueryTemplate, table), findings)
+}
+
+// collectCQLQuery saves the rows to <path>/<table>.json, redacted like the config files
+func (collector *NodeCollector) collectCQLQuery(session *gocql.Session, path string, table string, query string,
+	findings *[]redactionFinding) error {
+	rows, err := session.Query(query).Iter().SliceMap()
+	if err != nil {
+		return errors.New("Failed to select '" + table + "' (" + err.Error() + ")")
+	}
+
+	data, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return errors.New("Failed to encode '" + table + "' (" + err.Error() + ")")
+	}
+
+	fileName := table + ".json"
+	data = collector.redactOutput(fileName, data, findings)
+	err = afero.WriteFile(collector.AppFs, filepath.Join(path, fileName), data, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to write '" + table + "' (" + err.Error() + ")")
+	}
+
+	return nil
+}
+
+type sshDialer struct {
+	agent SSHCollectingAgent
+}
+
+// DialContext gives up on the context deadline or cancellation (gocql's connect timeout), the SSH Dial itself
+// can't be interrupted so a late connection is closed.
+func (dialer *sshDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		conn, err := dialer.agent.Dial(network, addr)
+		results <- result{conn, err}
+	}()
+
+	select {
+	case result := <-results:
+		return result.conn, result.err
+	case <-ctx.Done():
+		go func() {
+			if result := <-results; result.conn != nil {
+				result.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDescribeSchemaSupported(t *testing.T) {
+	assert.False(t, describeSchemaSupported("3.11.10"))
+	assert.False(t, describeSchemaSupported("3.0.24"))
+	assert.True(t, describeSchemaSupported("4.0.1"))
+	assert.True(t, describeSchemaSupported("4.1-SNAPSHOT"))
+	assert.True(t, describeSchemaSupported("unknown"))
+}
+
+func TestSSHDialer_DialContext(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("Dial", "tcp", "127.0.0.1:9042").Return(local, nil)
+	mockedSSHAgent.On("Dial", "tcp", "127.0.0.2:9042").Return(nil, errors.New("connection refused"))
+
+	dialer := &sshDialer{agent: mockedSSHAgent}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "127.0.0.1:9042")
+	assert.NoError(t, err)
+	assert.Equal(t, local, conn)
+
+	_, err = dialer.DialContext(context.Background(), "tcp", "127.0.0.2:9042")
+	assert.EqualError(t, err, "connection refused")
+}
+
+func TestSSHDialer_DialContextTimeout(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("Dial", "tcp", "127.0.0.1:9042").After(200*time.Millisecond).Return(local, nil)
+
+	dialer := &sshDialer{agent: mockedSSHAgent}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err := dialer.DialContext(ctx, "tcp", "127.0.0.1:9042")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(started) < 200*time.Millisecond)
+
+	// The late connection is closed
+	remote.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = remote.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"errors"
+	"github.com/spf13/afero"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+Settings
+*/
+type CustomTaskSettings struct {
+	Name string `yaml:"name"`
+	// Either a shell command or a remote file glob, the glob is matched on the file names only
+	Command string `yaml:"command,omitempty"`
+	Files   string `yaml:"files,omitempty"`
+	// Command output file name (default <name>.txt) or the folder of the received files (default <name>)
+	Output  string        `yaml:"output,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// A failed fatal task stops the remaining custom tasks and fails the node
+	Fatal bool `yaml:"fatal,omitempty"`
+}
+
+/*
+Collector
+*/
+
+// collectCustomTasks runs the tasks in order to custom/, a failed fatal task fails the node
+func (collector *NodeCollector) collectCustomTasks(agent SSHCollectingAgent) error {
+	dest, err := collector.makeFolder(agent.GetHost(), "custom")
+	if err != nil {
+		return err
+	}
+
+	// A second task of the same name would overwrite the output of the first one
+	names := make(map[string]bool)
+	for _, task := range collector.Settings.CustomTasks {
+		collector.log.Info("Running custom task '" + task.Name + "'...")
+		if names[task.Name] {
+			err = errors.New("Invalid custom task '" + task.Name + "', the name is already used")
+		} else {
+			names[task.Name] = true
+			err = collector.runCustomTask(agent, task, dest)
+		}
+		if err != nil {
+			if task.Fatal {
+				return &FatalError{Err: err}
+			}
+			collector.log.Error(err)
+			continue
+		}
+		collector.log.Info("Running custom task '" + task.Name + "' completed.")
+	}
+
+	return nil
+}
+
+func (collector *NodeCollector) runCustomTask(agent SSHCollectingAgent, task CustomTaskSettings, dest string) error {
+	if len(task.Name) == 0 || strings.ContainsAny(task.Name, `/\`) || strings.ContainsAny(task.Output, `/\`) {
+		return errors.New("Invalid custom task '" + task.Name + "', the name is required and neither the name " +
+			"nor the output may contain a path separator")
+	}
+	if (len(task.Command) > 0) == (len(task.Files) > 0) {
+		return errors.New("Invalid custom task '" + task.Name + "', exactly one of command and files is required")
+	}
+
+	if len(task.Command) > 0 {
+		output := task.Output
+		if len(output) == 0 {
+			output = task.Name + ".txt"
+		}
+
+		sout, _, err := agent.ExecuteCommand(withTimeout(shellCommandTemplate+ShellQuote(task.Command), task.Timeout))
+		if err != nil {
+			return errors.New("Failed to execute custom task '" + task.Name + "' (" + err.Error() + ")")
+		}
+
+		err = afero.WriteFile(collector.AppFs, filepath.Join(dest, output), sout.Bytes(), os.ModePerm)
+		if err != nil {
+			return errors.New("Failed to save custom task '" + task.Name + "' data (" + err.Error() + ")")
+		}
+		return nil
+	}
+
+	return collector.receiveCustomTaskFiles(agent, task, dest)
+}
+
+func (collector *NodeCollector) receiveCustomTaskFiles(agent SSHCollectingAgent, task CustomTaskSettings, dest string) error {
+	folder := task.Output
+	if len(folder) == 0 {
+		folder = task.Name
+	}
+	folder = filepath.Join(dest, folder)
+
+	entries, err := agent.ListDirectory(path.Dir(task.Files))
+	if err != nil {
+		return errors.New("Failed to list custom task '" + task.Name + "' files (" + err.Error() + ")")
+	}
+	entries = collector.matchFiles(entries, []string{path.Base(task.Files)})
+	if len(entries) == 0 {
+		return errors.New("Failed to find custom task '" + task.Name + "' files, nothing matches '" + task.Files + "'")
+	}
+
+	err = collector.AppFs.MkdirAll(folder, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to create custom task '" + task.Name + "' folder (" + err.Error() + ")")
+	}
+
+	// The timeout is checked between the files, a download in progress is not cut
+	deadline := time.Now().Add(task.Timeout)
+	for _, entry := range entries {
+		if task.Timeout > 0 && time.Now().After(deadline) {
+			return errors.New("Failed to receive custom task '" + task.Name + "' files (timed out)")
+		}
+
+		filename := filepath.Base(entry.Path)
+		err = agent.ReceiveFile(entry.Path, folder, func(copied int64, size int64, remaining time.Duration) {
+			collector.log.Info("Downloading '", filename, "' file ",
+				HumanSize(float64(copied)), " of ", HumanSize(float64(size)),
+				" (remaining ", remaining.Round(time.Second), ") ...")
+		})
+		if err != nil {
+			return errors.New("Failed to receive custom task '" + task.Name + "' file '" + entry.Path +
+				"' (" + err.Error() + ")")
+		}
+	}
+
+	return nil
+}
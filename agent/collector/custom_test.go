@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestNodeCollector_collectCustomTasks(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 30s sh -c 'curl -s localhost:4567/status'").
+		Return(bytes.NewBufferString("{\"status\":\"UP\"}"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "sh -c 'systemctl status backup-agent'").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), errors.New("exit status 4"))
+	mockedSSHAgent.
+		On("ListDirectory", "/var/log/backup-agent").
+		Return([]FileInfo{
+			{Path: "/var/log/backup-agent/agent.log"},
+			{Path: "/var/log/backup-agent/agent.log.1"},
+			{Path: "/var/log/backup-agent/archive", IdDir: true},
+		}, nil)
+	mockedSSHAgent.
+		On("ReceiveFile", "/var/log/backup-agent/agent.log", "some/path/node-test-host-1/custom/backup_agent",
+			mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.CustomTasks = []CustomTaskSettings{
+		{Name: "sidecar", Command: "curl -s localhost:4567/status", Output: "sidecar_status.json", Timeout: 30 * time.Second},
+		{Name: "backup_service", Command: "systemctl status backup-agent"},
+		{Name: "backup_agent", Files: "/var/log/backup-agent/*.log"},
+		{Name: "invalid", Command: "true", Files: "/tmp/*"},
+		{Name: "sidecar", Command: "true"},
+	}
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectCustomTasks(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	data, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/custom/sidecar_status.json")
+	assert.Equal(t, "{\"status\":\"UP\"}", string(data))
+	exists, _ := afero.Exists(appFs, "some/path/node-test-host-1/custom/backup_service.txt")
+	assert.False(t, exists)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	// The failed command and the invalid tasks are logged, the rest keeps going
+	messages := make([]string, 0)
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.ErrorLevel {
+			messages = append(messages, entry.Message)
+		}
+	}
+	if assert.Len(t, messages, 3) {
+		assert.Equal(t, "Invalid custom task 'sidecar', the name is already used", messages[2])
+	}
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectCustomTasksFatal(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ListDirectory", "/opt/sidecar/logs").
+		Return([]FileInfo{{Path: "/opt/sidecar/logs/sidecar.out"}}, nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.CustomTasks = []CustomTaskSettings{
+		{Name: "sidecar_logs", Files: "/opt/sidecar/logs/*.log", Fatal: true},
+		{Name: "sidecar", Command: "curl -s localhost:4567/status"},
+	}
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectCustomTasks(mockedSSHAgent)
+	if assert.Error(t, err) {
+		assert.Equal(t, "Failed to find custom task 'sidecar_logs' files, nothing matches '/opt/sidecar/logs/*.log'",
+			err.Error())
+	}
+
+	// The task after the fatal one is not run
+	mockedSSHAgent.AssertNotCalled(t, "ExecuteCommand", mock.Anything)
+
+	hook.Reset()
+}
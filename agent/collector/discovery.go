@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"path"
+	"strings"
+)
+
+/*
+Constants
+*/
+const processArgumentsCommandTemplate = "tr '\\0' '\\n' < /proc/%d/cmdline"
+const cassandraConfigFileName = "cassandra.yaml"
+
+const (
+	cassandraConfigProperty     = "-Dcassandra.config="
+	cassandraLogDirProperty     = "-Dcassandra.logdir="
+	cassandraStorageDirProperty = "-Dcassandra.storagedir="
+	gcLogOption                 = "-Xloggc:"
+	unifiedLogOption            = "-Xlog:"
+)
+
+/*
+Collector
+*/
+
+// cassandraConfig holds the paths read from the discovered cassandra.yaml
+type cassandraConfig struct {
+	DataFileDirectories []string `yaml:"data_file_directories"`
+	CommitLogDirectory  string   `yaml:"commitlog_directory"`
+	HintsDirectory      string   `yaml:"hints_directory"`
+}
+
+// discoverCassandraPaths returns the Cassandra settings with the paths found from the running process
+// and its cassandra.yaml, the configured paths are kept for anything not found.
+func (collector *NodeCollector) discoverCassandraPaths(agent SSHCollectingAgent) (CassandraSettings, error) {
+	settings := collector.Settings.Cassandra
+
+	process, err := collector.findJavaProcess(agent)
+	if err != nil {
+		return settings, err
+	}
+
+	command := fmt.Sprintf(processArgumentsCommandTemplate, process.pid)
+	sout, _, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return settings, errors.New("Failed to read Cassandra process arguments (" + err.Error() + ")")
+	}
+	args := strings.Split(strings.TrimRight(sout.String(), "\n"), "\n")
+
+	configFile := path.Join(settings.ConfigPath, cassandraConfigFileName)
+	storageDir := ""
+	for index, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, cassandraConfigProperty):
+			configFile = configFilePath(strings.TrimPrefix(arg, cassandraConfigProperty))
+			settings.ConfigPath = path.Dir(configFile)
+		case strings.HasPrefix(arg, cassandraLogDirProperty):
+			settings.LogPath = strings.TrimPrefix(arg, cassandraLogDirProperty)
+		case strings.HasPrefix(arg, cassandraStorageDirProperty):
+			storageDir = strings.TrimPrefix(arg, cassandraStorageDirProperty)
+		case strings.HasPrefix(arg, gcLogOption):
+			settings.GCPath = path.Dir(strings.TrimPrefix(arg, gcLogOption))
+		case strings.HasPrefix(arg, unifiedLogOption):
+			file := unifiedLogFile(strings.TrimPrefix(arg, unifiedLogOption))
+			if len(file) > 0 {
+				settings.GCPath = path.Dir(file)
+			}
+		case (arg == "-cp" || arg == "-classpath") && index+1 < len(args):
+			// Without cassandra.config the yaml is loaded from the classpath, the conf folder goes first
+			if !hasArgumentPrefix(args, cassandraConfigProperty) {
+				folder := classpathConfigFolder(args[index+1])
+				if len(folder) > 0 {
+					settings.ConfigPath = folder
+					configFile = path.Join(folder, cassandraConfigFileName)
+				}
+			}
+		}
+	}
+
+	// Cassandra defaults to the storage dir when the yaml leaves the directories out
+	if len(storageDir) > 0 {
+		settings.DataPath = []string{path.Join(storageDir, "data")}
+		settings.CommitLogPath = path.Join(storageDir, "commitlog")
+		settings.HintsPath = path.Join(storageDir, "hints")
+	}
+
+	content, err := agent.GetContent(configFile)
+	if err != nil {
+		collector.log.Warn("Failed to read '" + configFile + "' (" + err.Error() + ")")
+		return settings, nil
+	}
+
+	var config cassandraConfig
+	err = yaml.Unmarshal(content.Bytes(), &config)
+	if err != nil {
+		collector.log.Warn("Failed to parse '" + configFile + "' (" + err.Error() + ")")
+		return settings, nil
+	}
+
+	if len(config.DataFileDirectories) > 0 {
+		settings.DataPath = config.DataFileDirectories
+	}
+	if len(config.CommitLogDirectory) > 0 {
+		settings.CommitLogPath = config.CommitLogDirectory
+	}
+	if len(config.HintsDirectory) > 0 {
+		settings.HintsPath = config.HintsDirectory
+	}
+
+	return settings, nil
+}
+
+// configFilePath accepts both cassandra.config forms, a file URL and a plain path
+func configFilePath(value string) string {
+	location, err := url.Parse(value)
+	if err == nil && location.Scheme == "file" {
+		if len(location.Path) > 0 {
+			return location.Path
+		}
+		return location.Opaque
+	}
+	return value
+}
+
+// unifiedLogFile returns the file of -Xlog:<selectors>:<output>:..., e.g. -Xlog:gc*:file=/var/log/gc.log:time
+func unifiedLogFile(value string) string {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "gc") {
+		return ""
+	}
+
+	output := strings.Trim(strings.TrimPrefix(parts[1], "file="), "\"")
+	if output == "stdout" || output == "stderr" || !strings.HasPrefix(output, "/") {
+		return ""
+	}
+	return output
+}
+
+func classpathConfigFolder(classpath string) string {
+	for _, entry := range strings.Split(classpath, ":") {
+		if len(entry) > 0 && !strings.HasSuffix(entry, ".jar") && !strings.HasSuffix(entry, "*") &&
+			!strings.HasSuffix(entry, "/classes") {
+			return strings.TrimSuffix(entry, "/")
+		}
+	}
+	return ""
+}
+
+func hasArgumentPrefix(args []string, prefix string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
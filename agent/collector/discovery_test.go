@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const tarballProcessArguments = `java
+-Xloggc:/opt/cassandra/logs/gc.log
+-Dcassandra.logdir=/opt/cassandra/logs
+-Dcassandra.storagedir=/opt/cassandra/data
+-cp
+/opt/cassandra/conf:/opt/cassandra/build/classes/main:/opt/cassandra/lib/airline-0.8.jar
+org.apache.cassandra.service.CassandraDaemon
+`
+
+const customProcessArguments = `/usr/lib/jvm/java-11/bin/java
+-Xlog:gc=info,heap*=trace:file=/data/gc/gc.log:time,uptime:filecount=10,filesize=10485760
+-Dcassandra.config=file:///srv/cassandra/conf/cassandra-node.yaml
+-Dcassandra.logdir=/data/logs
+-cp
+/etc/cassandra:/usr/share/cassandra/lib/*
+org.apache.cassandra.service.CassandraDaemon
+`
+
+const customCassandraYaml = `cluster_name: 'Test Cluster'
+data_file_directories:
+    - /data/disk1/cassandra
+    - /data/disk2/cassandra
+commitlog_directory: /data/commitlog
+# hints_directory: /var/lib/cassandra/hints
+`
+
+func TestNodeCollector_discoverCassandraPaths(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString(listProcessesOutput), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "tr '\\0' '\\n' < /proc/2345/cmdline").
+		Return(bytes.NewBufferString(customProcessArguments), bytes.NewBufferString(""), nil).
+		Once()
+	mockedSSHAgent.
+		On("GetContent", "/srv/cassandra/conf/cassandra-node.yaml").
+		Return(bytes.NewBufferString(customCassandraYaml), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	collector := NodeCollector{
+		Settings: NodeCollectorDefaultSettings(),
+		Logger:   logger,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	settings, err := collector.discoverCassandraPaths(mockedSSHAgent)
+	assert.NoError(t, err)
+	assert.Equal(t, "/srv/cassandra/conf", settings.ConfigPath)
+	assert.Equal(t, "/data/logs", settings.LogPath)
+	assert.Equal(t, "/data/gc", settings.GCPath)
+	assert.Equal(t, []string{"/data/disk1/cassandra", "/data/disk2/cassandra"}, settings.DataPath)
+	assert.Equal(t, "/data/commitlog", settings.CommitLogPath)
+	assert.Equal(t, "/var/lib/cassandra/hints", settings.HintsPath)
+
+	// Tarball install, the yaml is found on the classpath and the directories default to the storage dir
+	mockedSSHAgent.
+		On("ExecuteCommand", "tr '\\0' '\\n' < /proc/2345/cmdline").
+		Return(bytes.NewBufferString(tarballProcessArguments), bytes.NewBufferString(""), nil).
+		Once()
+	mockedSSHAgent.
+		On("GetContent", "/opt/cassandra/conf/cassandra.yaml").
+		Return(bytes.NewBufferString("cluster_name: 'Test Cluster'\n"), nil)
+
+	settings, err = collector.discoverCassandraPaths(mockedSSHAgent)
+	assert.NoError(t, err)
+	assert.Equal(t, "/opt/cassandra/conf", settings.ConfigPath)
+	assert.Equal(t, "/opt/cassandra/logs", settings.LogPath)
+	assert.Equal(t, "/opt/cassandra/logs", settings.GCPath)
+	assert.Equal(t, []string{"/opt/cassandra/data/data"}, settings.DataPath)
+	assert.Equal(t, "/opt/cassandra/data/commitlog", settings.CommitLogPath)
+	assert.Equal(t, "/opt/cassandra/data/hints", settings.HintsPath)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_discoverCassandraPathsOnProcessNotFound(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), errors.New("ps failed"))
+
+	logger, hook := test.NewNullLogger()
+
+	collector := NodeCollector{
+		Settings: NodeCollectorDefaultSettings(),
+		Logger:   logger,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	settings, err := collector.discoverCassandraPaths(mockedSSHAgent)
+	assert.EqualError(t, err, "Failed to list processes (ps failed)")
+	assert.Equal(t, NodeCollectorDefaultSettings().Cassandra, settings)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
@@ -0,0 +1,197 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+const dataInventoryFileName = "data_inventory.json"
+
+// Lists "<size> <relative path>" of the files, idle IO and the lowest CPU priority when requested
+const listDataFilesScriptTemplate = "%sfind %s -mindepth 1 -maxdepth %d -type f -printf '%%s %%P\\n'"
+const lowPriorityPrefix = "if command -v ionice >/dev/null 2>&1; then io='ionice -c3'; fi; $io nice -n 19 "
+
+const snapshotsFolderName = "snapshots"
+const backupsFolderName = "backups"
+
+// Table folders are named <table>-<id>, the id is missing in the old versions
+var tableFolderPattern = regexp.MustCompile(`^(.+)-([0-9a-f]{32})$`)
+
+// SSTable data files: nb-1-big-Data.db, nb-3g1h_0t8b_3ko402ctevm8ml0sle-big-Data.db, keyspace-table-ka-1-Data.db
+var sstableDataFilePattern = regexp.MustCompile(`(?:^|-)([0-9a-z_]+)-(?:big-|bti-)?Data\.db$`)
+
+/*
+Settings
+*/
+type DataInventorySettings struct {
+	Enabled bool `yaml:"enabled"`
+	// keyspace/table/snapshots/<name>/<file> is 5 levels deep
+	MaxDepth    int           `yaml:"max-depth"`
+	Timeout     time.Duration `yaml:"timeout"`
+	LowPriority bool          `yaml:"low-priority"`
+}
+
+func DataInventoryDefaultSettings() DataInventorySettings {
+	return DataInventorySettings{
+		Enabled:     true,
+		MaxDepth:    5,
+		Timeout:     5 * time.Minute,
+		LowPriority: true,
+	}
+}
+
+/*
+Collector
+*/
+type DataInventory struct {
+	Path string `json:"path"`
+	// False when the walk was cut by the timeout or failed part way, e.g. on permissions
+	Complete bool             `json:"complete"`
+	Error    string           `json:"error,omitempty"`
+	Tables   []TableInventory `json:"tables"`
+}
+
+// TableInventory sizes are the apparent sizes, snapshots hard link the live SSTables
+type TableInventory struct {
+	Keyspace      string `json:"keyspace"`
+	Table         string `json:"table"`
+	Id            string `json:"id,omitempty"`
+	SSTables      int    `json:"sstables"`
+	Size          int64  `json:"size"`
+	MinGeneration *int64 `json:"min-generation,omitempty"`
+	MaxGeneration *int64 `json:"max-generation,omitempty"`
+	Snapshots     int    `json:"snapshots"`
+	SnapshotsSize int64  `json:"snapshots-size"`
+	BackupsSize   int64  `json:"backups-size"`
+}
+
+func (collector *NodeCollector) collectDataInventory(agent SSHCollectingAgent, path string) error {
+	settings := collector.Settings.Collecting.DataInventory
+
+	inventories := make([]DataInventory, 0)
+	for _, dataPath := range collector.Settings.Cassandra.DataPath {
+		prefix := ""
+		if settings.LowPriority {
+			prefix = lowPriorityPrefix
+		}
+		script := fmt.Sprintf(listDataFilesScriptTemplate, prefix, ShellQuote(dataPath), settings.MaxDepth)
+
+		// The files listed before a failure are still worth the inventory
+		inventory := DataInventory{Path: dataPath, Complete: true}
+		sout, _, err := agent.ExecuteCommand(withTimeout(shellCommandTemplate+ShellQuote(script), settings.Timeout))
+		if err != nil {
+			collector.log.Warn("Failed to list data files of '" + dataPath + "' (" + err.Error() + ")")
+			inventory.Complete = false
+			inventory.Error = err.Error()
+		}
+		if sout != nil {
+			inventory.Tables = buildTableInventory(sout.String())
+		}
+		inventories = append(inventories, inventory)
+	}
+
+	data, err := json.MarshalIndent(inventories, "", "  ")
+	if err != nil {
+		return errors.New("Failed to marshal data inventory (" + err.Error() + ")")
+	}
+	err = afero.WriteFile(collector.AppFs, filepath.Join(path, dataInventoryFileName), data, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to save data inventory (" + err.Error() + ")")
+	}
+
+	return nil
+}
+
+func buildTableInventory(listing string) []TableInventory {
+	tables := make(map[string]*TableInventory)
+	snapshots := make(map[string]map[string]bool)
+
+	for _, line := range strings.Split(listing, "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		size, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		// keyspace/table/file, keyspace/table/backups/file or keyspace/table/snapshots/name/file
+		elements := strings.Split(parts[1], "/")
+		if len(elements) < 3 {
+			continue
+		}
+
+		key := elements[0] + "/" + elements[1]
+		table, ok := tables[key]
+		if !ok {
+			table = &TableInventory{Keyspace: elements[0], Table: elements[1]}
+			match := tableFolderPattern.FindStringSubmatch(elements[1])
+			if match != nil {
+				table.Table, table.Id = match[1], match[2]
+			}
+			tables[key] = table
+			snapshots[key] = make(map[string]bool)
+		}
+
+		switch {
+		case len(elements) > 3 && elements[2] == snapshotsFolderName:
+			table.SnapshotsSize += size
+			snapshots[key][elements[3]] = true
+		case len(elements) > 3 && elements[2] == backupsFolderName:
+			table.BackupsSize += size
+		default:
+			table.Size += size
+			if len(elements) == 3 {
+				table.countSSTable(elements[2])
+			}
+		}
+	}
+
+	inventory := make([]TableInventory, 0, len(tables))
+	for key, table := range tables {
+		table.Snapshots = len(snapshots[key])
+		inventory = append(inventory, *table)
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		if inventory[i].Keyspace != inventory[j].Keyspace {
+			return inventory[i].Keyspace < inventory[j].Keyspace
+		}
+		return inventory[i].Table < inventory[j].Table
+	})
+
+	return inventory
+}
+
+// countSSTable counts the data file, the generations are tracked for the numeric ones only
+func (table *TableInventory) countSSTable(name string) {
+	match := sstableDataFilePattern.FindStringSubmatch(name)
+	if match == nil {
+		return
+	}
+	table.SSTables++
+
+	generation, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return
+	}
+	if table.MinGeneration == nil || generation < *table.MinGeneration {
+		table.MinGeneration = &generation
+	}
+	if table.MaxGeneration == nil || generation > *table.MaxGeneration {
+		value := generation
+		table.MaxGeneration = &value
+	}
+}
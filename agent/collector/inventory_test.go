@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const dataFilesListing = `100 ks1/table1-0123456789abcdef0123456789abcdef/nb-1-big-Data.db
+10 ks1/table1-0123456789abcdef0123456789abcdef/nb-1-big-Index.db
+300 ks1/table1-0123456789abcdef0123456789abcdef/nb-7-big-Data.db
+30 ks1/table1-0123456789abcdef0123456789abcdef/nb-7-big-Index.db
+5 ks1/table1-0123456789abcdef0123456789abcdef/.table1_idx/nb-2-big-Data.db
+100 ks1/table1-0123456789abcdef0123456789abcdef/snapshots/before-upgrade/nb-1-big-Data.db
+100 ks1/table1-0123456789abcdef0123456789abcdef/snapshots/truncated-1600000000000-table1/nb-1-big-Data.db
+300 ks1/table1-0123456789abcdef0123456789abcdef/backups/nb-7-big-Data.db
+400 ks1/table2-fedcba9876543210fedcba9876543210/nb-3g1h_0t8b_3ko402ctevm8ml0sle-big-Data.db
+50 ks0/legacy/ks0-legacy-ka-12-Data.db
+find: 'ks2': Permission denied
+`
+
+func TestBuildTableInventory(t *testing.T) {
+	one, seven, twelve := int64(1), int64(7), int64(12)
+
+	assert.Equal(t, []TableInventory{
+		{
+			Keyspace: "ks0", Table: "legacy", SSTables: 1, Size: 50,
+			MinGeneration: &twelve, MaxGeneration: &twelve,
+		},
+		{
+			Keyspace: "ks1", Table: "table1", Id: "0123456789abcdef0123456789abcdef", SSTables: 2, Size: 445,
+			MinGeneration: &one, MaxGeneration: &seven,
+			Snapshots: 2, SnapshotsSize: 200, BackupsSize: 300,
+		},
+		{
+			Keyspace: "ks1", Table: "table2", Id: "fedcba9876543210fedcba9876543210", SSTables: 1, Size: 400,
+		},
+	}, buildTableInventory(dataFilesListing))
+}
+
+func TestNodeCollector_collectDataInventory(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s sh -c 'find /data/disk1 -mindepth 1 -maxdepth 3 -type f -printf '\"'\"'%s %P\\n'\"'\"''").
+		Return(bytes.NewBufferString(dataFilesListing), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s sh -c 'find /data/disk2 -mindepth 1 -maxdepth 3 -type f -printf '\"'\"'%s %P\\n'\"'\"''").
+		Return(bytes.NewBufferString("400 ks1/table2-fedcba9876543210fedcba9876543210/nb-2-big-Data.db\n"),
+			bytes.NewBufferString(""), errors.New("exit status 124"))
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Cassandra.DataPath = []string{"/data/disk1", "/data/disk2"}
+	settings.Collecting.DataInventory = DataInventorySettings{Enabled: true, MaxDepth: 3, Timeout: 60e9, LowPriority: false}
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectDataInventory(mockedSSHAgent, "some/path/info")
+	assert.NoError(t, err)
+
+	var inventories []DataInventory
+	data, _ := afero.ReadFile(appFs, "some/path/info/data_inventory.json")
+	assert.NoError(t, json.Unmarshal(data, &inventories))
+	if assert.Len(t, inventories, 2) {
+		assert.True(t, inventories[0].Complete)
+		assert.Len(t, inventories[0].Tables, 3)
+		assert.False(t, inventories[1].Complete)
+		assert.Equal(t, "exit status 124", inventories[1].Error)
+		assert.Len(t, inventories[1].Tables, 1)
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
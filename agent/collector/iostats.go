@@ -0,0 +1,405 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+const ioSampleMarker = "@sample"
+
+// Prints the counters with the node clock time stamp, count+1 times to get count intervals
+const ioSamplingScriptTemplate = "for i in $(seq 0 %d); do echo \"" + ioSampleMarker + " $(date +%%s.%%N)\"; " +
+	"cat /proc/stat /proc/diskstats; if [ $i -lt %d ]; then sleep %s; fi; done"
+const ioSamplingTimeoutMargin = 30 * time.Second
+
+const iostatCommandTemplate = "iostat -x -m -t -y -z %d %d"
+
+// /proc/diskstats counts 512 bytes sectors whatever the device sector size is
+const diskSectorSize = 512
+
+// Virtual devices without real IO
+var ignoredDevicePrefixes = []string{"loop", "ram", "zram"}
+
+/*
+Settings
+*/
+type IOStatsSettings struct {
+	Duration time.Duration `yaml:"duration"`
+	Interval time.Duration `yaml:"interval"`
+	// Run sysstat iostat too, saved to info/iostat.info
+	Iostat bool `yaml:"iostat"`
+}
+
+func IOStatsDefaultSettings() IOStatsSettings {
+	return IOStatsSettings{
+		Duration: 30 * time.Second,
+		Interval: 5 * time.Second,
+		Iostat:   false,
+	}
+}
+
+/*
+Collector
+*/
+type IOStatsSample struct {
+	Timestamp time.Time       `json:"timestamp"`
+	CPU       CPUUtilization  `json:"cpu"`
+	Devices   []DeviceIOStats `json:"devices"`
+}
+
+// CPUUtilization is the percentage of the CPU time over the interval
+type CPUUtilization struct {
+	User   float64 `json:"user"`
+	Nice   float64 `json:"nice"`
+	System float64 `json:"system"`
+	IOWait float64 `json:"iowait"`
+	Steal  float64 `json:"steal"`
+	Idle   float64 `json:"idle"`
+}
+
+// DeviceIOStats follows the iostat -x -m columns
+type DeviceIOStats struct {
+	Device             string  `json:"device"`
+	ReadsPerSec        float64 `json:"reads-per-sec"`
+	WritesPerSec       float64 `json:"writes-per-sec"`
+	ReadMBPerSec       float64 `json:"read-mb-per-sec"`
+	WriteMBPerSec      float64 `json:"write-mb-per-sec"`
+	ReadAwaitMs        float64 `json:"read-await-ms"`
+	WriteAwaitMs       float64 `json:"write-await-ms"`
+	QueueSize          float64 `json:"queue-size"`
+	UtilizationPercent float64 `json:"util-percent"`
+}
+
+type cpuCounters []uint64
+
+type diskCounters struct {
+	reads         uint64
+	sectorsRead   uint64
+	readTicks     uint64
+	writes        uint64
+	sectorsWrite  uint64
+	writeTicks    uint64
+	ioTicks       uint64
+	weightedTicks uint64
+}
+
+type ioCountersSnapshot struct {
+	timestamp time.Time
+	cpu       cpuCounters
+	disks     map[string]diskCounters
+	order     []string
+}
+
+func (collector *NodeCollector) collectIOStats(agent SSHCollectingAgent) error {
+	settings := collector.Settings.Collecting.IOStats
+
+	path, err := collector.makeFolder(agent.GetHost(), "info")
+	if err != nil {
+		return err
+	}
+
+	if settings.Interval <= 0 || settings.Duration < settings.Interval {
+		return errors.New("Invalid IO stats duration " + settings.Duration.String() + " and interval " + settings.Interval.String())
+	}
+	count := int(settings.Duration / settings.Interval)
+
+	if settings.Iostat {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			collector.collectIostat(agent, path, count)
+		}()
+		defer func() { <-done }()
+	}
+
+	script := fmt.Sprintf(ioSamplingScriptTemplate, count, count,
+		strconv.FormatFloat(settings.Interval.Seconds(), 'f', -1, 64))
+	sout, _, err := agent.ExecuteCommand(withTimeout(shellCommandTemplate+ShellQuote(script), settings.Duration+ioSamplingTimeoutMargin))
+	if err != nil {
+		return errors.New("Failed to sample IO stats (" + err.Error() + ")")
+	}
+
+	samples := computeIOStats(parseIOCounters(sout.String()))
+	if len(samples) == 0 {
+		return errors.New("Failed to sample IO stats (no complete interval)")
+	}
+
+	files := map[string]func([]IOStatsSample) ([]byte, error){
+		"io_stat.info": formatIOStats,
+		"io_stat.csv":  formatIOStatsCSV,
+		"io_stat.json": func(samples []IOStatsSample) ([]byte, error) {
+			return json.MarshalIndent(samples, "", "  ")
+		},
+	}
+	for name, format := range files {
+		data, err := format(samples)
+		if err != nil {
+			return errors.New("Failed to format '" + name + "' (" + err.Error() + ")")
+		}
+		err = afero.WriteFile(collector.AppFs, filepath.Join(path, name), data, os.ModePerm)
+		if err != nil {
+			return errors.New("Failed to save '" + name + "' (" + err.Error() + ")")
+		}
+	}
+
+	return nil
+}
+
+// collectIostat runs sysstat iostat alongside, it is missing on many nodes so failures are warnings only
+func (collector *NodeCollector) collectIostat(agent SSHCollectingAgent, path string, count int) {
+	settings := collector.Settings.Collecting.IOStats
+
+	interval := int64(settings.Interval.Seconds())
+	if interval < 1 {
+		interval = 1
+	}
+	command := fmt.Sprintf(iostatCommandTemplate, interval, count)
+	sout, _, err := agent.ExecuteCommand(withTimeout(command, settings.Duration+ioSamplingTimeoutMargin))
+	if err != nil {
+		collector.log.Warn("Failed to execute '" + command + "' (" + err.Error() + ")")
+		return
+	}
+
+	err = afero.WriteFile(collector.AppFs, filepath.Join(path, "iostat.info"), sout.Bytes(), os.ModePerm)
+	if err != nil {
+		collector.log.Warn("Failed to save iostat info (" + err.Error() + ")")
+	}
+}
+
+func parseIOCounters(output string) []ioCountersSnapshot {
+	snapshots := make([]ioCountersSnapshot, 0)
+
+	var current *ioCountersSnapshot
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == ioSampleMarker && len(fields) == 2 {
+			seconds, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				current = nil
+				continue
+			}
+			snapshots = append(snapshots, ioCountersSnapshot{
+				timestamp: time.Unix(0, int64(seconds*float64(time.Second))).UTC(),
+				disks:     make(map[string]diskCounters),
+			})
+			current = &snapshots[len(snapshots)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		if fields[0] == "cpu" {
+			current.cpu = parseCounters(fields[1:])
+			continue
+		}
+
+		// major minor name reads merged sectors ticks writes merged sectors ticks in-flight io-ticks weighted
+		if len(fields) >= 14 && isNumber(fields[0]) && isNumber(fields[1]) && !isIgnoredDevice(fields[2]) {
+			values := parseCounters(fields[3:14])
+			current.disks[fields[2]] = diskCounters{
+				reads:         values[0],
+				sectorsRead:   values[2],
+				readTicks:     values[3],
+				writes:        values[4],
+				sectorsWrite:  values[6],
+				writeTicks:    values[7],
+				ioTicks:       values[9],
+				weightedTicks: values[10],
+			}
+			current.order = append(current.order, fields[2])
+		}
+	}
+
+	return snapshots
+}
+
+// computeIOStats turns the counters of the consecutive snapshots into rates, the idle devices are left out
+func computeIOStats(snapshots []ioCountersSnapshot) []IOStatsSample {
+	samples := make([]IOStatsSample, 0)
+	for i := 1; i < len(snapshots); i++ {
+		previous, current := snapshots[i-1], snapshots[i]
+		seconds := current.timestamp.Sub(previous.timestamp).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+
+		sample := IOStatsSample{
+			Timestamp: current.timestamp,
+			CPU:       cpuUtilization(previous.cpu, current.cpu),
+			Devices:   make([]DeviceIOStats, 0),
+		}
+
+		for _, device := range current.order {
+			before, ok := previous.disks[device]
+			if !ok {
+				continue
+			}
+			after := current.disks[device]
+
+			reads := delta(before.reads, after.reads)
+			writes := delta(before.writes, after.writes)
+			if reads == 0 && writes == 0 && delta(before.ioTicks, after.ioTicks) == 0 {
+				continue
+			}
+
+			stats := DeviceIOStats{
+				Device:             device,
+				ReadsPerSec:        reads / seconds,
+				WritesPerSec:       writes / seconds,
+				ReadMBPerSec:       delta(before.sectorsRead, after.sectorsRead) * diskSectorSize / (1024 * 1024) / seconds,
+				WriteMBPerSec:      delta(before.sectorsWrite, after.sectorsWrite) * diskSectorSize / (1024 * 1024) / seconds,
+				QueueSize:          delta(before.weightedTicks, after.weightedTicks) / (seconds * 1000),
+				UtilizationPercent: delta(before.ioTicks, after.ioTicks) / (seconds * 10),
+			}
+			if reads > 0 {
+				stats.ReadAwaitMs = delta(before.readTicks, after.readTicks) / reads
+			}
+			if writes > 0 {
+				stats.WriteAwaitMs = delta(before.writeTicks, after.writeTicks) / writes
+			}
+			if stats.UtilizationPercent > 100 {
+				stats.UtilizationPercent = 100
+			}
+			sample.Devices = append(sample.Devices, stats)
+		}
+
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// cpuUtilization takes /proc/stat cpu line counters: user nice system idle iowait irq softirq steal
+func cpuUtilization(before cpuCounters, after cpuCounters) CPUUtilization {
+	if len(before) < 8 || len(after) < 8 {
+		return CPUUtilization{}
+	}
+
+	deltas := make([]float64, 8)
+	total := 0.0
+	for i := range deltas {
+		deltas[i] = delta(before[i], after[i])
+		total += deltas[i]
+	}
+	if total == 0 {
+		return CPUUtilization{}
+	}
+
+	return CPUUtilization{
+		User:   100 * deltas[0] / total,
+		Nice:   100 * deltas[1] / total,
+		System: 100 * (deltas[2] + deltas[5] + deltas[6]) / total,
+		IOWait: 100 * deltas[4] / total,
+		Steal:  100 * deltas[7] / total,
+		Idle:   100 * deltas[3] / total,
+	}
+}
+
+func formatIOStats(samples []IOStatsSample) ([]byte, error) {
+	var report bytes.Buffer
+	for _, sample := range samples {
+		fmt.Fprintf(&report, "%s\n", sample.Timestamp.Format(time.RFC3339))
+		fmt.Fprintf(&report, "avg-cpu:  %%user   %%nice %%system %%iowait  %%steal   %%idle\n")
+		fmt.Fprintf(&report, "         %6.2f  %6.2f  %6.2f  %6.2f  %6.2f  %6.2f\n\n",
+			sample.CPU.User, sample.CPU.Nice, sample.CPU.System, sample.CPU.IOWait, sample.CPU.Steal, sample.CPU.Idle)
+
+		fmt.Fprintf(&report, "%-16s %9s %9s %9s %9s %9s %9s %9s %7s\n",
+			"Device", "r/s", "w/s", "rMB/s", "wMB/s", "r_await", "w_await", "aqu-sz", "%util")
+		for _, device := range sample.Devices {
+			fmt.Fprintf(&report, "%-16s %9.2f %9.2f %9.2f %9.2f %9.2f %9.2f %9.2f %7.2f\n",
+				device.Device, device.ReadsPerSec, device.WritesPerSec, device.ReadMBPerSec, device.WriteMBPerSec,
+				device.ReadAwaitMs, device.WriteAwaitMs, device.QueueSize, device.UtilizationPercent)
+		}
+		report.WriteString("\n")
+	}
+	return report.Bytes(), nil
+}
+
+func formatIOStatsCSV(samples []IOStatsSample) ([]byte, error) {
+	var report bytes.Buffer
+	writer := csv.NewWriter(&report)
+
+	err := writer.Write([]string{"timestamp", "device", "r/s", "w/s", "rMB/s", "wMB/s", "r_await", "w_await", "aqu-sz", "%util",
+		"%user", "%system", "%iowait", "%steal", "%idle"})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sample := range samples {
+		for _, device := range sample.Devices {
+			err = writer.Write([]string{
+				sample.Timestamp.Format(time.RFC3339),
+				device.Device,
+				formatRate(device.ReadsPerSec),
+				formatRate(device.WritesPerSec),
+				formatRate(device.ReadMBPerSec),
+				formatRate(device.WriteMBPerSec),
+				formatRate(device.ReadAwaitMs),
+				formatRate(device.WriteAwaitMs),
+				formatRate(device.QueueSize),
+				formatRate(device.UtilizationPercent),
+				formatRate(sample.CPU.User),
+				formatRate(sample.CPU.System),
+				formatRate(sample.CPU.IOWait),
+				formatRate(sample.CPU.Steal),
+				formatRate(sample.CPU.Idle),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	writer.Flush()
+	return report.Bytes(), writer.Error()
+}
+
+func formatRate(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+func parseCounters(fields []string) []uint64 {
+	values := make([]uint64, len(fields))
+	for i, field := range fields {
+		values[i], _ = strconv.ParseUint(field, 10, 64)
+	}
+	return values
+}
+
+// delta of the counters, a counter wrapped or reset on the way gives zero
+func delta(before uint64, after uint64) float64 {
+	if after < before {
+		return 0
+	}
+	return float64(after - before)
+}
+
+func isNumber(value string) bool {
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err == nil
+}
+
+func isIgnoredDevice(name string) bool {
+	for _, prefix := range ignoredDevicePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
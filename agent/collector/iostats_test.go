@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const ioCountersOutput = `@sample 1600000000.000000000
+cpu  1000 0 500 8000 100 0 0 0 0 0
+cpu0 500 0 250 4000 50 0 0 0 0 0
+intr 123456 0 0 0
+ctxt 987654
+   7       0 loop0 10 0 20 0 0 0 0 0 0 0 0 0 0 0 0
+   8       0 sda 1000 0 8000 2000 500 0 4000 1000 0 1500 3000 0 0 0 0
+   8       1 sda1 10 0 80 20 5 0 40 10 0 15 30 0 0 0 0
+@sample 1600000005.000000000
+cpu  1300 0 600 8500 200 0 0 0 0 0
+cpu0 650 0 300 4250 100 0 0 0 0 0
+intr 123999 0 0 0
+ctxt 999999
+   7       0 loop0 20 0 40 0 0 0 0 0 0 0 0 0 0 0 0
+   8       0 sda 1500 0 18240 3000 1500 0 14240 6000 0 3000 8000 0 0 0 0
+   8       1 sda1 10 0 80 20 5 0 40 10 0 15 30 0 0 0 0
+`
+
+func TestComputeIOStats(t *testing.T) {
+	samples := computeIOStats(parseIOCounters(ioCountersOutput))
+
+	assert.Equal(t, []IOStatsSample{
+		{
+			Timestamp: time.Date(2020, 9, 13, 12, 26, 45, 0, time.UTC),
+			CPU:       CPUUtilization{User: 30, System: 10, IOWait: 10, Idle: 50},
+			Devices: []DeviceIOStats{
+				{
+					Device:             "sda",
+					ReadsPerSec:        100,
+					WritesPerSec:       200,
+					ReadMBPerSec:       1,
+					WriteMBPerSec:      1,
+					ReadAwaitMs:        2,
+					WriteAwaitMs:       5,
+					QueueSize:          1,
+					UtilizationPercent: 30,
+				},
+			},
+		},
+	}, samples)
+}
+
+func TestNodeCollector_collectIOStats(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 40s sh -c 'for i in $(seq 0 2); do echo \"@sample $(date +%s.%N)\"; "+
+			"cat /proc/stat /proc/diskstats; if [ $i -lt 2 ]; then sleep 5; fi; done'").
+		Return(bytes.NewBufferString(ioCountersOutput), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 40s iostat -x -m -t -y -z 5 2").
+		Return(bytes.NewBufferString("iostat"), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.IOStats = IOStatsSettings{Duration: 10 * time.Second, Interval: 5 * time.Second, Iostat: true}
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectIOStats(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	data, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/info/io_stat.info")
+	assert.Equal(t, `2020-09-13T12:26:45Z
+avg-cpu:  %user   %nice %system %iowait  %steal   %idle
+          30.00    0.00   10.00   10.00    0.00   50.00
+
+Device                 r/s       w/s     rMB/s     wMB/s   r_await   w_await    aqu-sz   %util
+sda                 100.00    200.00      1.00      1.00      2.00      5.00      1.00   30.00
+
+`, string(data))
+
+	data, _ = afero.ReadFile(appFs, "some/path/node-test-host-1/info/io_stat.csv")
+	assert.Equal(t, "timestamp,device,r/s,w/s,rMB/s,wMB/s,r_await,w_await,aqu-sz,%util,%user,%system,%iowait,%steal,%idle\n"+
+		"2020-09-13T12:26:45Z,sda,100.00,200.00,1.00,1.00,2.00,5.00,1.00,30.00,30.00,10.00,10.00,0.00,50.00\n", string(data))
+
+	var samples []IOStatsSample
+	data, _ = afero.ReadFile(appFs, "some/path/node-test-host-1/info/io_stat.json")
+	assert.NoError(t, json.Unmarshal(data, &samples))
+	assert.Len(t, samples, 1)
+
+	data, _ = afero.ReadFile(appFs, "some/path/node-test-host-1/info/iostat.info")
+	assert.Equal(t, "iostat", string(data))
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
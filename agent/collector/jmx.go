@@ -0,0 +1,188 @@
+package collector
+
+import (
+	"agent/jmx"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+/*
+Constants
+*/
+const jmxFileNameTemplate = "jmx_%s.json"
+
+/*
+Settings
+*/
+type JMXSettings struct {
+	Enabled bool               `yaml:"enabled"`
+	Host    string             `yaml:"host"`
+	Port    int                `yaml:"port"`
+	Timeout time.Duration      `yaml:"timeout"`
+	MBeans  []JMXMBeanSettings `yaml:"mbeans"`
+}
+
+// MBeans matching the object name patterns are dumped to one file
+type JMXMBeanSettings struct {
+	Name       string   `yaml:"name"`
+	Queries    []string `yaml:"queries"`
+	Attributes []string `yaml:"attributes"`
+}
+
+var jmxMetricAttributes = []string{
+	"Value", "Count", "Mean", "Min", "Max", "StdDev",
+	"50thPercentile", "75thPercentile", "95thPercentile", "98thPercentile", "99thPercentile", "999thPercentile",
+	"MeanRate", "OneMinuteRate", "FiveMinuteRate", "FifteenMinuteRate", "DurationUnit", "RateUnit",
+}
+
+var jmxTableMetrics = []string{
+	"LiveDiskSpaceUsed", "TotalDiskSpaceUsed", "LiveSSTableCount", "PendingCompactions",
+	"ReadLatency", "WriteLatency", "RangeLatency", "CoordinatorReadLatency",
+	"EstimatedPartitionCount", "MaxPartitionSize", "MeanPartitionSize",
+	"TombstoneScannedHistogram", "LiveScannedHistogram", "SSTablesPerReadHistogram",
+	"BloomFilterFalseRatio", "CompressionRatio", "SpeculativeRetries", "DroppedMutations",
+}
+
+func JMXDefaultSettings() JMXSettings {
+	tableQueries := make([]string, 0, len(jmxTableMetrics))
+	for _, metric := range jmxTableMetrics {
+		tableQueries = append(tableQueries, "org.apache.cassandra.metrics:type=Table,name="+metric+",*")
+	}
+
+	return JMXSettings{
+		Enabled: false,
+		Host:    "127.0.0.1",
+		Port:    7199,
+		Timeout: time.Minute,
+		MBeans: []JMXMBeanSettings{
+			{
+				Name:    "storage_service",
+				Queries: []string{"org.apache.cassandra.db:type=StorageService"},
+				Attributes: []string{
+					"ClusterName", "ReleaseVersion", "SchemaVersion", "LocalHostId", "OperationMode",
+					"Initialized", "Joined", "Drained", "Draining", "GossipRunning", "NativeTransportRunning",
+					"LiveNodes", "UnreachableNodes", "JoiningNodes", "LeavingNodes", "MovingNodes",
+					"LoadString", "LoadMap", "Keyspaces", "Tokens", "IncrementalBackupsEnabled",
+					"CompactionThroughputMbPerSec", "StreamThroughputMbPerSec", "ConcurrentCompactors",
+				},
+			},
+			{
+				Name:    "compaction_manager",
+				Queries: []string{"org.apache.cassandra.db:type=CompactionManager"},
+				Attributes: []string{
+					"Compactions", "CompactionSummary", "CoreCompactorThreads", "MaximumCompactorThreads",
+					"CoreValidationThreads", "MaximumValidatorThreads",
+				},
+			},
+			{
+				Name:       "compaction",
+				Queries:    []string{"org.apache.cassandra.metrics:type=Compaction,*"},
+				Attributes: jmxMetricAttributes,
+			},
+			{
+				Name:       "thread_pools",
+				Queries:    []string{"org.apache.cassandra.metrics:type=ThreadPools,*"},
+				Attributes: jmxMetricAttributes,
+			},
+			{
+				Name:       "dropped_messages",
+				Queries:    []string{"org.apache.cassandra.metrics:type=DroppedMessage,*"},
+				Attributes: jmxMetricAttributes,
+			},
+			{
+				Name:       "tables",
+				Queries:    tableQueries,
+				Attributes: jmxMetricAttributes,
+			},
+			{
+				Name: "jvm",
+				Queries: []string{
+					"java.lang:type=Runtime",
+					"java.lang:type=Memory",
+					"java.lang:type=GarbageCollector,*",
+					"java.lang:type=Threading",
+				},
+				Attributes: []string{
+					"VmName", "VmVendor", "VmVersion", "Uptime", "StartTime", "InputArguments",
+					"HeapMemoryUsage", "NonHeapMemoryUsage", "CollectionCount", "CollectionTime",
+					"ThreadCount", "PeakThreadCount", "DaemonThreadCount",
+				},
+			},
+		},
+	}
+}
+
+/*
+Collector
+*/
+func (collector *NodeCollector) collectJMXInfo(agent SSHCollectingAgent) error {
+	path, err := collector.makeFolder(agent.GetHost(), "info")
+	if err != nil {
+		return err
+	}
+
+	settings := collector.Settings.Collecting.JMX
+	address := net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port))
+
+	var credentials []string
+	if len(collector.Settings.Cassandra.Username) > 0 {
+		credentials = []string{collector.Settings.Cassandra.Username, collector.Settings.Cassandra.Password}
+	}
+
+	client, err := jmx.Connect(agent.Dial, address, credentials, settings.Timeout)
+	if err != nil {
+		return errors.New("Failed to connect JMX at '" + address + "' (" + err.Error() + ")")
+	}
+	defer func() {
+		err := client.Close()
+		if err != nil {
+			collector.log.Warn("Failed to close JMX connection (" + err.Error() + ")")
+		}
+	}()
+
+	// The java.lang:type=Runtime InputArguments carry the secrets passed as -D options
+	findings := make([]redactionFinding, 0)
+
+	for _, mbean := range settings.MBeans {
+		values := make(map[string]map[string]interface{})
+
+		for _, query := range mbean.Queries {
+			names, err := client.QueryNames(query)
+			if err != nil {
+				collector.log.Warn("Failed to query MBeans '" + query + "' (" + err.Error() + ")")
+				continue
+			}
+
+			for _, name := range names {
+				attributes, err := client.GetAttributes(name, mbean.Attributes)
+				if err != nil {
+					collector.log.Warn("Failed to get attributes of MBean '" + name + "' (" + err.Error() + ")")
+					continue
+				}
+				values[name] = attributes
+			}
+		}
+
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			collector.log.Warn("Failed to encode MBeans '" + mbean.Name + "' (" + err.Error() + ")")
+			continue
+		}
+
+		fileName := fmt.Sprintf(jmxFileNameTemplate, mbean.Name)
+		data = collector.redactOutput(fileName, data, &findings)
+		err = afero.WriteFile(collector.AppFs, filepath.Join(path, fileName), data, os.ModePerm)
+		if err != nil {
+			collector.log.Warn("Failed to write JMX info '" + fileName + "' (" + err.Error() + ")")
+		}
+	}
+
+	return collector.saveOutputsRedactionReport(path, findings)
+}
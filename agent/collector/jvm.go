@@ -0,0 +1,247 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+// The user column is widened, ps cuts the names longer than 8 characters otherwise (e.g. cassand+)
+const listProcessesCommand = "ps -eo pid=,user:64=,args="
+const currentUserCommand = "id -un"
+const javaExecutableCommandTemplate = "readlink -f /proc/%d/exe"
+const runAsUserTemplate = "sudo -n -u %s "
+const toolsPathTemplate = "env PATH=%s:$PATH "
+const flightRecordingName = "support"
+
+/*
+Settings
+*/
+type JVMSettings struct {
+	Enabled bool `yaml:"enabled"`
+	// Matched against the process command line
+	ProcessPattern string `yaml:"process-pattern"`
+	// User to run the tools as, the process owner when empty
+	User     string        `yaml:"user"`
+	JavaHome string        `yaml:"java-home"`
+	Timeout  time.Duration `yaml:"timeout"`
+
+	ThreadDumps        int           `yaml:"thread-dumps"`
+	ThreadDumpInterval time.Duration `yaml:"thread-dump-interval"`
+	HeapHistogram      bool          `yaml:"heap-histogram"`
+	Jcmd               []string      `yaml:"jcmd"`
+	// Java Flight Recorder capture length, zero disables it
+	FlightRecording         time.Duration `yaml:"flight-recording"`
+	FlightRecordingSettings string        `yaml:"flight-recording-settings"`
+}
+
+func JVMDefaultSettings() JVMSettings {
+	return JVMSettings{
+		Enabled:                 false,
+		ProcessPattern:          "org.apache.cassandra.service.CassandraDaemon",
+		User:                    "",
+		JavaHome:                "",
+		Timeout:                 time.Minute,
+		ThreadDumps:             3,
+		ThreadDumpInterval:      10 * time.Second,
+		HeapHistogram:           true,
+		Jcmd:                    []string{"VM.flags", "VM.system_properties", "VM.command_line"},
+		FlightRecording:         0,
+		FlightRecordingSettings: "profile",
+	}
+}
+
+/*
+Collector
+*/
+type javaProcess struct {
+	pid  int
+	user string
+}
+
+func (collector *NodeCollector) collectJVMInfo(agent SSHCollectingAgent) error {
+	settings := collector.Settings.Collecting.JVM
+
+	dest, err := collector.makeFolder(agent.GetHost(), "jvm")
+	if err != nil {
+		return err
+	}
+
+	process, err := collector.findJavaProcess(agent)
+	if err != nil {
+		return err
+	}
+	collector.log.Info("Found Cassandra process ", process.pid, " of user '", process.user, "'")
+
+	prefix, err := collector.jvmToolsPrefix(agent, process)
+	if err != nil {
+		return err
+	}
+
+	// VM.system_properties and VM.command_line carry the secrets passed as -D options
+	findings := make([]redactionFinding, 0)
+
+	for i := 1; i <= settings.ThreadDumps; i++ {
+		if i > 1 {
+			time.Sleep(settings.ThreadDumpInterval)
+		}
+		collector.runJVMTool(agent, prefix, fmt.Sprintf("jstack -l %d", process.pid), dest,
+			fmt.Sprintf("jstack_%d.txt", i), &findings)
+	}
+
+	if settings.HeapHistogram {
+		collector.runJVMTool(agent, prefix, fmt.Sprintf("jmap -histo %d", process.pid), dest, "jmap_histo.txt", &findings)
+	}
+
+	for _, command := range settings.Jcmd {
+		collector.runJVMTool(agent, prefix, fmt.Sprintf("jcmd %d %s", process.pid, command), dest,
+			"jcmd_"+strings.ReplaceAll(command, " ", "_")+".txt", &findings)
+	}
+
+	err = collector.saveOutputsRedactionReport(dest, findings)
+	if err != nil {
+		collector.log.Error(err)
+	}
+
+	if settings.FlightRecording > 0 {
+		err = collector.collectFlightRecording(agent, prefix, process, dest)
+		if err != nil {
+			collector.log.Error(err)
+		}
+	}
+
+	return nil
+}
+
+func (collector *NodeCollector) findJavaProcess(agent SSHCollectingAgent) (*javaProcess, error) {
+	sout, _, err := agent.ExecuteCommand(listProcessesCommand)
+	if err != nil {
+		return nil, errors.New("Failed to list processes (" + err.Error() + ")")
+	}
+
+	for _, line := range strings.Split(sout.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.Contains(line, collector.Settings.Collecting.JVM.ProcessPattern) {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		return &javaProcess{pid: pid, user: fields[1]}, nil
+	}
+
+	return nil, errors.New("Failed to find Cassandra process matching '" + collector.Settings.Collecting.JVM.ProcessPattern + "'")
+}
+
+// jvmToolsPrefix runs the tools as the JVM user, required to attach to it, and finds them next to the JVM executable
+func (collector *NodeCollector) jvmToolsPrefix(agent SSHCollectingAgent, process *javaProcess) (string, error) {
+	settings := collector.Settings.Collecting.JVM
+
+	user := settings.User
+	if len(user) == 0 {
+		user = process.user
+	}
+
+	sout, _, err := agent.ExecuteCommand(currentUserCommand)
+	if err != nil {
+		return "", errors.New("Failed to check current user (" + err.Error() + ")")
+	}
+
+	var prefix strings.Builder
+	if strings.TrimSpace(sout.String()) != user {
+		prefix.WriteString(fmt.Sprintf(runAsUserTemplate, ShellQuote(user)))
+	}
+
+	toolsPath := ""
+	if len(settings.JavaHome) > 0 {
+		toolsPath = path.Join(settings.JavaHome, "bin")
+	} else {
+		sout, _, err = agent.ExecuteCommand(prefix.String() + fmt.Sprintf(javaExecutableCommandTemplate, process.pid))
+		if err != nil {
+			collector.log.Warn("Failed to locate JVM executable, using tools on PATH (" + err.Error() + ")")
+		} else if executable := strings.TrimSpace(sout.String()); len(executable) > 0 {
+			toolsPath = path.Dir(executable)
+		}
+	}
+
+	if len(toolsPath) > 0 {
+		prefix.WriteString(fmt.Sprintf(toolsPathTemplate, ShellQuote(toolsPath)))
+	}
+
+	return prefix.String(), nil
+}
+
+func (collector *NodeCollector) runJVMTool(agent SSHCollectingAgent, prefix string, command string, dest string, fileName string,
+	findings *[]redactionFinding) {
+	sout, _, err := agent.ExecuteCommand(withTimeout(prefix+command, collector.Settings.Collecting.JVM.Timeout))
+	if err != nil {
+		collector.log.Error("Failed to execute '" + command + "' (" + err.Error() + ")")
+		return
+	}
+
+	data := collector.redactOutput(fileName, sout.Bytes(), findings)
+	err = afero.WriteFile(collector.AppFs, filepath.Join(dest, fileName), data, os.ModePerm)
+	if err != nil {
+		collector.log.Error("Failed to save '" + command + "' data (" + err.Error() + ")")
+	}
+}
+
+// The recording is written by the JVM, so the staging folder is made and removed as the JVM user too
+func (collector *NodeCollector) collectFlightRecording(agent SSHCollectingAgent, prefix string, process *javaProcess, dest string) error {
+	settings := collector.Settings.Collecting.JVM
+	timeout := settings.Timeout
+
+	sout, _, err := agent.ExecuteCommand(prefix + "mktemp -d")
+	if err != nil {
+		return errors.New("Failed to create flight recording folder (" + err.Error() + ")")
+	}
+	folder := strings.TrimSpace(sout.String())
+	defer func() {
+		_, _, err := agent.ExecuteCommand(prefix + "rm -rf " + ShellQuote(folder))
+		if err != nil {
+			collector.log.Warn("Failed to remove flight recording folder '" + folder + "' (" + err.Error() + ")")
+		}
+	}()
+
+	recording := path.Join(folder, "recording.jfr")
+
+	collector.log.Info("Recording JVM for ", settings.FlightRecording, "...")
+	_, _, err = agent.ExecuteCommand(withTimeout(prefix+fmt.Sprintf("jcmd %d JFR.start name=%s settings=%s",
+		process.pid, flightRecordingName, ShellQuote(settings.FlightRecordingSettings)), timeout))
+	if err != nil {
+		return errors.New("Failed to start flight recording (" + err.Error() + ")")
+	}
+
+	time.Sleep(settings.FlightRecording)
+
+	_, _, dumpErr := agent.ExecuteCommand(withTimeout(prefix+fmt.Sprintf("jcmd %d JFR.dump name=%s filename=%s",
+		process.pid, flightRecordingName, ShellQuote(recording)), timeout))
+
+	_, _, err = agent.ExecuteCommand(withTimeout(prefix+fmt.Sprintf("jcmd %d JFR.stop name=%s",
+		process.pid, flightRecordingName), timeout))
+	if err != nil {
+		collector.log.Warn("Failed to stop flight recording (" + err.Error() + ")")
+	}
+
+	if dumpErr != nil {
+		return errors.New("Failed to dump flight recording (" + dumpErr.Error() + ")")
+	}
+
+	err = agent.ReceiveCommandOutput(prefix+"cat "+ShellQuote(recording), filepath.Join(dest, "recording.jfr"), nil)
+	if err != nil {
+		return errors.New("Failed to download flight recording (" + err.Error() + ")")
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package collector
+
+import (
+	"bytes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+// ps -eo pid=,user:64=,args= output
+const listProcessesOutput = `    1 root                                                             /sbin/init
+ 2345 cassandra                                                        java -ea -Xms8G -Xmx8G -cp /usr/share/cassandra/* org.apache.cassandra.service.CassandraDaemon
+ 3456 ubuntu                                                           -bash
+`
+
+func TestNodeCollector_collectJVMInfo(t *testing.T) {
+	prefix := "sudo -n -u cassandra env PATH=/usr/lib/jvm/java-11/bin:$PATH "
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString(listProcessesOutput), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "id -un").
+		Return(bytes.NewBufferString("ubuntu\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "sudo -n -u cassandra readlink -f /proc/2345/exe").
+		Return(bytes.NewBufferString("/usr/lib/jvm/java-11/bin/java\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s "+prefix+"jstack -l 2345").
+		Return(bytes.NewBufferString("threads"), bytes.NewBufferString(""), nil).
+		Twice()
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s "+prefix+"jmap -histo 2345").
+		Return(bytes.NewBufferString("histogram"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s "+prefix+"jcmd 2345 VM.flags").
+		Return(bytes.NewBufferString("flags"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s "+prefix+"jcmd 2345 VM.system_properties").
+		Return(bytes.NewBufferString("2345:\n#Tue Oct 18 12:00:00 UTC 2026\n"+
+			"javax.net.ssl.keyStorePassword=s3cret\njava.version=11.0.8\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s "+prefix+"jcmd 2345 VM.command_line").
+		Return(bytes.NewBufferString("2345:\njvm_args: -Xmx8G -Dcom.sun.management.jmxremote.password=s3cret -Dcassandra.jmx.local.port=7199\n"),
+			bytes.NewBufferString(""), nil)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", prefix+"mktemp -d").
+		Return(bytes.NewBufferString("/tmp/tmp.jfr\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s "+prefix+"jcmd 2345 JFR.start name=support settings=profile").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s "+prefix+"jcmd 2345 JFR.dump name=support filename=/tmp/tmp.jfr/recording.jfr").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s "+prefix+"jcmd 2345 JFR.stop name=support").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ReceiveCommandOutput", prefix+"cat /tmp/tmp.jfr/recording.jfr", "some/path/node-test-host-1/jvm/recording.jfr", mock.Anything).
+		Return(nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", prefix+"rm -rf /tmp/tmp.jfr").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.JVM.Enabled = true
+	settings.Collecting.JVM.ThreadDumps = 2
+	settings.Collecting.JVM.ThreadDumpInterval = 0
+	settings.Collecting.JVM.Jcmd = []string{"VM.flags", "VM.system_properties", "VM.command_line"}
+	settings.Collecting.JVM.FlightRecording = time.Millisecond
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectJVMInfo(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	properties, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/jvm/jcmd_VM.system_properties.txt")
+	assert.Equal(t, "2345:\n#Tue Oct 18 12:00:00 UTC 2026\njavax.net.ssl.keyStorePassword=<redacted>\njava.version=11.0.8\n",
+		string(properties))
+	commandLine, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/jvm/jcmd_VM.command_line.txt")
+	assert.Equal(t, "2345:\njvm_args: -Xmx8G -Dcom.sun.management.jmxremote.password=<redacted> -Dcassandra.jmx.local.port=7199\n",
+		string(commandLine))
+	report, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/jvm/redaction.json")
+	assert.JSONEq(t, `[
+		{"file": "jcmd_VM.system_properties.txt", "line": 3, "rule": "properties-secret"},
+		{"file": "jcmd_VM.command_line.txt", "line": 2, "rule": "jvm-secret-property"}
+	]`, string(report))
+
+	for _, name := range []string{"jstack_1.txt", "jstack_2.txt", "jmap_histo.txt", "jcmd_VM.flags.txt"} {
+		exists, _ := afero.Exists(appFs, "some/path/node-test-host-1/jvm/"+name)
+		assert.True(t, exists, name)
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectJVMInfoWithoutProcess(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString("    1 root     /sbin/init\n"), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	collector := NodeCollector{
+		Settings: NodeCollectorDefaultSettings(),
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectJVMInfo(mockedSSHAgent)
+	assert.EqualError(t, err, "Failed to find Cassandra process matching 'org.apache.cassandra.service.CassandraDaemon'")
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_jvmToolsPrefixWithLongUserName(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString(" 2345 cassandra-service                                                java "+
+			"-cp /usr/share/cassandra/* org.apache.cassandra.service.CassandraDaemon\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "id -un").
+		Return(bytes.NewBufferString("ubuntu\n"), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.JVM.JavaHome = "/usr/lib/jvm/java-11"
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	process, err := collector.findJavaProcess(mockedSSHAgent)
+	assert.NoError(t, err)
+	assert.Equal(t, &javaProcess{pid: 2345, user: "cassandra-service"}, process)
+
+	prefix, err := collector.jvmToolsPrefix(mockedSSHAgent, process)
+	assert.NoError(t, err)
+	assert.Equal(t, "sudo -n -u cassandra-service env PATH=/usr/lib/jvm/java-11/bin:$PATH ", prefix)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
@@ -0,0 +1,361 @@
+package collector
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"github.com/spf13/afero"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+const nodeTimezoneCommand = "date +%z"
+const logTimestampLayout = "2006-01-02 15:04:05"
+
+// A failed decompressor (corrupt archive, missing unzip) fails the pipeline, not only a failed awk. The dash
+// of older distributions has no pipefail, so the pipeline runs in bash.
+const pipefailShellTemplate = "bash -o pipefail -c "
+
+// Keeps the lines timestamped within the window, lines without a timestamp (e.g. stack traces) follow
+// the preceding line. Timestamps lead the line of Cassandra ("LEVEL [thread] timestamp") and GC logs.
+const logWindowFilter = `BEGIN { keep = 1 } ` +
+	`match($0, /^([A-Z]+ +\[[^]]*\] +|\[)?[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9][ T][0-9][0-9]:[0-9][0-9]:[0-9][0-9]/) ` +
+	`{ t = substr($0, RSTART + RLENGTH - 19, 19); sub(/T/, " ", t); keep = (t >= from && t <= to) } keep`
+
+func (collector *NodeCollector) collectLogFiles(agent SSHCollectingAgent) error {
+	dest, err := collector.makeFolder(agent.GetHost(), "logs")
+	if err != nil {
+		return err
+	}
+
+	entries, err := agent.ListDirectory(collector.Settings.Cassandra.LogPath)
+	if err != nil {
+		return errors.New("Failed to check log directory (" + err.Error() + ")")
+	}
+
+	entries = collector.matchFiles(entries, collector.Settings.Collecting.Logs)
+	if collector.hasTimeWindow() {
+		return collector.receiveLogsInTimeWindow(agent, entries, dest, "log")
+	}
+
+	for _, entry := range entries {
+		filename := filepath.Base(entry.Path)
+		err = agent.ReceiveFile(entry.Path, dest, func(copied int64, size int64, remaining time.Duration) {
+			collector.log.Info("Downloading '", filename, "' log file ",
+				HumanSize(float64(copied)), " of ", HumanSize(float64(size)),
+				" (remaining ", remaining.Round(time.Second), ") ...")
+		})
+		if err != nil {
+			collector.log.Warn("Failed to receive log file '" + entry.Path + "' (" + err.Error() + ")")
+			continue
+		}
+
+		if collector.Settings.Collecting.LogArchives == DecompressLogArchives {
+			err = decompressLogArchive(collector.AppFs, filepath.Join(dest, filename))
+			if err != nil {
+				collector.log.Warn("Failed to decompress log file '" + filename + "' (" + err.Error() + ")")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (collector *NodeCollector) collectGCLogFiles(agent SSHCollectingAgent) error {
+	dest, err := collector.makeFolder(agent.GetHost(), "gc_logs")
+	if err != nil {
+		return err
+	}
+
+	entries, err := agent.ListDirectory(collector.Settings.Cassandra.GCPath)
+	if err != nil {
+		return errors.New("Failed to check GC log directory (" + err.Error() + ")")
+	}
+
+	entries = collector.matchFiles(entries, collector.Settings.Collecting.GCLogPatterns)
+	if collector.hasTimeWindow() {
+		return collector.receiveLogsInTimeWindow(agent, entries, dest, "GC log")
+	}
+
+	for _, entry := range entries {
+		filename := filepath.Base(entry.Path)
+		err := agent.ReceiveFile(entry.Path, dest, func(copied int64, size int64, remaining time.Duration) {
+			collector.log.Info("Downloading '", filename, "' GC log file ",
+				HumanSize(float64(copied)), " of ", HumanSize(float64(size)),
+				" (remaining ", remaining.Round(time.Second), ") ...")
+		})
+		if err != nil {
+			collector.log.Warn("Failed to receive GC log file (" + err.Error() + ")")
+		}
+	}
+
+	return nil
+}
+
+// matchFiles selects the files matching any of the patterns (See filepath.Match).
+func (collector *NodeCollector) matchFiles(entries []FileInfo, patterns []string) []FileInfo {
+	matched := make([]FileInfo, 0)
+	for _, entry := range entries {
+		if entry.IdDir {
+			continue
+		}
+
+		filename := filepath.Base(entry.Path)
+		for _, pattern := range patterns {
+			match, err := filepath.Match(pattern, filename)
+			if err != nil {
+				collector.log.Warn("Failed to check file '" + entry.Path + "' pattern '" + pattern +
+					"' matching (" + err.Error() + ")")
+				continue
+			}
+
+			if match {
+				matched = append(matched, entry)
+				break
+			}
+		}
+	}
+
+	return matched
+}
+
+func (collector *NodeCollector) hasTimeWindow() bool {
+	return !collector.TimestampFrom.IsZero() || !collector.TimestampTo.IsZero()
+}
+
+// receiveLogsInTimeWindow downloads the lines of the files within the time window only, the lines are filtered
+// on the node while streaming. Archives are decompressed there as well, and compressed back with gzip when
+// they are kept (a .zip archive is saved as .gz).
+func (collector *NodeCollector) receiveLogsInTimeWindow(agent SSHCollectingAgent, entries []FileInfo, dest string, kind string) error {
+	location := collector.nodeLocation(agent)
+
+	for _, entry := range selectTimeWindow(entries, collector.TimestampFrom, collector.TimestampTo) {
+		filename := filepath.Base(entry.Path)
+		if isLogArchive(filename) {
+			filename = strings.TrimSuffix(filename, filepath.Ext(filename))
+			if collector.keepLogArchives() {
+				filename += ".gz"
+			}
+		}
+
+		command := collector.logWindowCommand(entry.Path, location)
+		err := agent.ReceiveCommandOutput(command, filepath.Join(dest, filename), func(copied int64, size int64, remaining time.Duration) {
+			collector.log.Info("Downloading '", filename, "' ", kind, " file lines ", HumanSize(float64(copied)), " ...")
+		})
+		if err != nil {
+			collector.log.Warn("Failed to receive " + kind + " file '" + entry.Path + "' (" + err.Error() + ")")
+		}
+	}
+
+	return nil
+}
+
+// nodeLocation returns the node timezone, Cassandra logs in local time.
+func (collector *NodeCollector) nodeLocation(agent SSHCollectingAgent) *time.Location {
+	sout, _, err := agent.ExecuteCommand(nodeTimezoneCommand)
+	if err == nil {
+		location, err := parseTimezoneOffset(strings.TrimSpace(sout.String()))
+		if err == nil {
+			return location
+		}
+	}
+
+	collector.log.Warn("Failed to check node timezone, assuming UTC")
+	return time.UTC
+}
+
+func parseTimezoneOffset(offset string) (*time.Location, error) {
+	if len(offset) != 5 || (offset[0] != '+' && offset[0] != '-') {
+		return nil, errors.New("invalid timezone offset '" + offset + "'")
+	}
+
+	hours, err := strconv.Atoi(offset[1:3])
+	if err != nil {
+		return nil, err
+	}
+	minutes, err := strconv.Atoi(offset[3:5])
+	if err != nil {
+		return nil, err
+	}
+
+	seconds := hours*3600 + minutes*60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return time.FixedZone(offset, seconds), nil
+}
+
+func (collector *NodeCollector) logWindowCommand(path string, location *time.Location) string {
+	from := ""
+	if !collector.TimestampFrom.IsZero() {
+		from = collector.TimestampFrom.In(location).Format(logTimestampLayout)
+	}
+	to := "9999"
+	if !collector.TimestampTo.IsZero() {
+		to = collector.TimestampTo.In(location).Format(logTimestampLayout)
+	}
+
+	filter := "awk -v from=" + ShellQuote(from) + " -v to=" + ShellQuote(to) + " " + ShellQuote(logWindowFilter)
+
+	if isLogArchive(path) && collector.keepLogArchives() {
+		filter += " | gzip -c"
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		return pipefailShellTemplate + ShellQuote("gzip -dc "+ShellQuote(path)+" | "+filter)
+	case ".zip":
+		return pipefailShellTemplate + ShellQuote("unzip -p "+ShellQuote(path)+" | "+filter)
+	}
+	return filter + " " + ShellQuote(path)
+}
+
+func (collector *NodeCollector) keepLogArchives() bool {
+	return collector.Settings.Collecting.LogArchives != DecompressLogArchives
+}
+
+func isLogArchive(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".gz" || ext == ".zip"
+}
+
+// selectTimeWindow selects the files which may contain lines within the window, a rotated file spans from
+// the modification time of the preceding file of the same log to its own modification time.
+func selectTimeWindow(entries []FileInfo, from time.Time, to time.Time) []FileInfo {
+	groups := make(map[string][]FileInfo)
+	for _, entry := range entries {
+		group := logGroup(filepath.Base(entry.Path))
+		groups[group] = append(groups[group], entry)
+	}
+
+	selected := make(map[string]bool)
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].ModTime.Before(group[j].ModTime)
+		})
+
+		for i, entry := range group {
+			if !from.IsZero() && entry.ModTime.Before(from) {
+				continue
+			}
+			if !to.IsZero() && i > 0 && group[i-1].ModTime.After(to) {
+				continue
+			}
+			selected[entry.Path] = true
+		}
+	}
+
+	matched := make([]FileInfo, 0)
+	for _, entry := range entries {
+		if selected[entry.Path] {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// logGroup is the log name shared by the rotated files, e.g. system.log of system.log.1.zip
+func logGroup(filename string) string {
+	index := strings.Index(filename, ".log")
+	if index < 0 {
+		return filename
+	}
+	return filename[:index+len(".log")]
+}
+
+// decompressLogArchive replaces gzip and zip archives (as rotated by logback) with their content,
+// other files are left as they are.
+func decompressLogArchive(fs afero.Fs, path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		err := gunzipFile(fs, path, strings.TrimSuffix(path, filepath.Ext(path)))
+		if err != nil {
+			return err
+		}
+	case ".zip":
+		err := unzipFile(fs, path, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	return fs.Remove(path)
+}
+
+func gunzipFile(fs afero.Fs, src string, dest string) error {
+	file, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return writeFile(fs, dest, reader)
+}
+
+func unzipFile(fs afero.Fs, src string, dest string) error {
+	file, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		content, err := entry.Open()
+		if err != nil {
+			return err
+		}
+
+		// Entries are flattened, archive paths never leave the destination
+		err = writeFile(fs, filepath.Join(dest, filepath.Base(entry.Name)), content)
+		_ = content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFile(fs afero.Fs, path string, reader io.Reader) error {
+	file, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestSelectTimeWindow(t *testing.T) {
+	day := func(day int) time.Time {
+		return time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	entries := []FileInfo{
+		{Path: "/var/log/cassandra/system.log", ModTime: day(20)},
+		{Path: "/var/log/cassandra/system.log.1.zip", ModTime: day(10)},
+		{Path: "/var/log/cassandra/system.log.2.zip", ModTime: day(5)},
+		{Path: "/var/log/cassandra/system.log.3.zip", ModTime: day(1)},
+		{Path: "/var/log/cassandra/debug.log", ModTime: day(20)},
+		{Path: "/var/log/cassandra/debug.log.1.zip", ModTime: day(6)},
+	}
+
+	// Lines of 7th to 8th are in system.log.1.zip (5th to 10th) and debug.log (6th to 20th)
+	selected := selectTimeWindow(entries, day(7), day(8))
+	assert.Equal(t, []FileInfo{entries[1], entries[4]}, selected)
+
+	selected = selectTimeWindow(entries, day(15), time.Time{})
+	assert.Equal(t, []FileInfo{entries[0], entries[4]}, selected)
+
+	selected = selectTimeWindow(entries, time.Time{}, day(3))
+	assert.Equal(t, []FileInfo{entries[2], entries[3], entries[5]}, selected)
+}
+
+func TestParseTimezoneOffset(t *testing.T) {
+	location, err := parseTimezoneOffset("-0730")
+	assert.NoError(t, err)
+	_, offset := time.Date(2020, 1, 1, 0, 0, 0, 0, location).Zone()
+	assert.Equal(t, -(7*3600 + 30*60), offset)
+
+	_, err = parseTimezoneOffset("UTC")
+	assert.Error(t, err)
+}
+
+func TestNodeCollector_collectLogFilesInTimeWindow(t *testing.T) {
+	filter := "awk -v from='2020-01-28 22:00:00' -v to='2020-01-28 23:00:00' " + ShellQuote(logWindowFilter)
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ListDirectory", "/var/log/cassandra").
+		Return([]FileInfo{
+			{Path: "/var/log/cassandra/system.log", ModTime: time.Date(2020, 1, 29, 0, 0, 0, 0, time.UTC)},
+			{Path: "/var/log/cassandra/system.log.1.gz", ModTime: time.Date(2020, 1, 28, 21, 0, 0, 0, time.UTC)},
+			{Path: "/var/log/cassandra/system.log.2.gz", ModTime: time.Date(2020, 1, 27, 0, 0, 0, 0, time.UTC)},
+		}, nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "date +%z").
+		Return(bytes.NewBufferString("+0200\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ReceiveCommandOutput", filter+" /var/log/cassandra/system.log",
+			"some/path/node-test-host-1/logs/system.log", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
+	// The archives are kept (the default), the filtered lines are compressed back
+	mockedSSHAgent.
+		On("ReceiveCommandOutput", "bash -o pipefail -c "+ShellQuote("gzip -dc /var/log/cassandra/system.log.1.gz | "+filter+" | gzip -c"),
+			"some/path/node-test-host-1/logs/system.log.1.gz", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
+
+	logger, hook := test.NewNullLogger()
+
+	collector := NodeCollector{
+		Settings:      NodeCollectorDefaultSettings(),
+		Logger:        logger,
+		Path:          "some/path",
+		TimestampFrom: time.Date(2020, 1, 28, 20, 0, 0, 0, time.UTC),
+		TimestampTo:   time.Date(2020, 1, 28, 21, 0, 0, 0, time.UTC),
+		AppFs:         afero.NewMemMapFs(),
+		log:           logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectLogFiles(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectLogFilesInTimeWindowWithCorruptArchive(t *testing.T) {
+	filter := "awk -v from='2020-01-28 22:00:00' -v to=9999 " + ShellQuote(logWindowFilter)
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ListDirectory", "/var/log/cassandra").
+		Return([]FileInfo{
+			{Path: "/var/log/cassandra/system.log", ModTime: time.Date(2020, 1, 29, 0, 0, 0, 0, time.UTC)},
+			{Path: "/var/log/cassandra/system.log.1.zip", ModTime: time.Date(2020, 1, 28, 21, 0, 0, 0, time.UTC)},
+		}, nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "date +%z").
+		Return(bytes.NewBufferString("+0200\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ReceiveCommandOutput", filter+" /var/log/cassandra/system.log",
+			"some/path/node-test-host-1/logs/system.log", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
+	// The awk filter succeeds on the partial input, the unzip failure fails the pipeline
+	mockedSSHAgent.
+		On("ReceiveCommandOutput", "bash -o pipefail -c "+ShellQuote("unzip -p /var/log/cassandra/system.log.1.zip | "+filter),
+			"some/path/node-test-host-1/logs/system.log.1", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(errors.New("Process exited with status 9 End-of-central-directory signature not found"))
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.LogArchives = DecompressLogArchives
+	collector := NodeCollector{
+		Settings:      settings,
+		Logger:        logger,
+		Path:          "some/path",
+		TimestampFrom: time.Date(2020, 1, 28, 20, 0, 0, 0, time.UTC),
+		AppFs:         afero.NewMemMapFs(),
+		log:           logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectLogFiles(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, "Failed to receive log file '/var/log/cassandra/system.log.1.zip' "+
+		"(Process exited with status 9 End-of-central-directory signature not found)", hook.LastEntry().Message)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
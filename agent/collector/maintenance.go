@@ -0,0 +1,190 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+const segmentsFileName = "segments.json"
+
+// Prints the node time, then "<size> <modification time> <name>" of each segment
+const listSegmentsScriptTemplate = "date +%%s; find %s -maxdepth 1 -type f -name %s -printf '%%s %%T@ %%f\\n'"
+
+const commitLogSegmentPattern = "CommitLog-*.log"
+const hintsSegmentPattern = "*.hints"
+
+// Hints files are named <target host id>-<timestamp>-<version>.hints
+const hostIdLength = 36
+
+var repairHistoryTables = []string{
+	"system_distributed.repair_history",
+	"system_distributed.parent_repair_history",
+}
+
+/*
+Settings
+*/
+type MaintenanceSettings struct {
+	Enabled bool          `yaml:"enabled"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Rows read from each repair history table over CQL, the tables are skipped when CQL is disabled
+	RepairHistoryLimit int                       `yaml:"repair-history-limit"`
+	NodeTool           []NodeToolCommandSettings `yaml:"nodetool"`
+}
+
+func MaintenanceDefaultSettings() MaintenanceSettings {
+	return MaintenanceSettings{
+		Enabled:            true,
+		Timeout:            time.Minute,
+		RepairHistoryLimit: 1000,
+		NodeTool: []NodeToolCommandSettings{
+			{Command: "netstats", Timeout: time.Minute},
+			{Command: "compactionhistory", Timeout: 5 * time.Minute},
+		},
+	}
+}
+
+/*
+Collector
+*/
+
+// SegmentsInventory describes the commitlog or hints backlog of a node
+type SegmentsInventory struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+	// Age of the oldest segment by the node clock
+	OldestFile       string `json:"oldest-file,omitempty"`
+	OldestAgeSeconds int64  `json:"oldest-age-seconds"`
+	// Hints files per target host id
+	Hosts map[string]int `json:"hosts,omitempty"`
+}
+
+func (collector *NodeCollector) collectMaintenanceInfo(agent SSHCollectingAgent) error {
+	settings := collector.Settings.Collecting.Maintenance
+
+	dest, err := collector.makeFolder(agent.GetHost(), "maintenance")
+	if err != nil {
+		return err
+	}
+
+	segments := []SegmentsInventory{
+		collector.listSegments(agent, "commitlog", collector.Settings.Cassandra.CommitLogPath, commitLogSegmentPattern),
+		collector.listSegments(agent, "hints", collector.Settings.Cassandra.HintsPath, hintsSegmentPattern),
+	}
+	data, err := json.MarshalIndent(segments, "", "  ")
+	if err != nil {
+		return errors.New("Failed to marshal segments inventory (" + err.Error() + ")")
+	}
+	err = afero.WriteFile(collector.AppFs, filepath.Join(dest, segmentsFileName), data, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to save segments inventory (" + err.Error() + ")")
+	}
+
+	if collector.Settings.Collecting.CQL.Enabled && settings.RepairHistoryLimit > 0 {
+		collector.collectRepairHistory(agent, dest)
+	}
+
+	if len(settings.NodeTool) > 0 {
+		err = collector.runNodeToolCommands(agent, settings.NodeTool, dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (collector *NodeCollector) listSegments(agent SSHCollectingAgent, name string, path string,
+	pattern string) SegmentsInventory {
+	inventory := SegmentsInventory{Name: name, Path: path}
+	if len(path) == 0 {
+		inventory.Error = "no path configured"
+		return inventory
+	}
+
+	script := fmt.Sprintf(listSegmentsScriptTemplate, ShellQuote(path), ShellQuote(pattern))
+	command := withTimeout(shellCommandTemplate+ShellQuote(script), collector.Settings.Collecting.Maintenance.Timeout)
+	sout, _, err := agent.ExecuteCommand(command)
+	if err != nil {
+		collector.log.Warn("Failed to list " + name + " segments of '" + path + "' (" + err.Error() + ")")
+		inventory.Error = err.Error()
+	}
+	if sout == nil {
+		return inventory
+	}
+
+	lines := strings.Split(strings.TrimSpace(sout.String()), "\n")
+	now, err := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return inventory
+	}
+
+	var oldest float64
+	for _, line := range lines[1:] {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		modified, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+
+		inventory.Files++
+		inventory.Size += size
+		if len(inventory.OldestFile) == 0 || modified < oldest {
+			oldest = modified
+			inventory.OldestFile = fields[2]
+			inventory.OldestAgeSeconds = now - int64(modified)
+		}
+
+		if pattern == hintsSegmentPattern && len(fields[2]) > hostIdLength {
+			if inventory.Hosts == nil {
+				inventory.Hosts = make(map[string]int)
+			}
+			inventory.Hosts[fields[2][:hostIdLength]]++
+		}
+	}
+
+	return inventory
+}
+
+func (collector *NodeCollector) collectRepairHistory(agent SSHCollectingAgent, dest string) {
+	session, err := collector.createCQLSession(agent)
+	if err != nil {
+		collector.log.Warn("Skipped the repair history (" + err.Error() + ")")
+		return
+	}
+	defer session.Close()
+
+	findings := make([]redactionFinding, 0)
+	for _, table := range repairHistoryTables {
+		query := fmt.Sprintf(selectTableQueryTemplate+" LIMIT %d", table, collector.Settings.Collecting.Maintenance.RepairHistoryLimit)
+		err = collector.collectCQLQuery(session, dest, table, query, &findings)
+		if err != nil {
+			collector.log.Warn(err)
+		}
+	}
+
+	err = collector.saveOutputsRedactionReport(dest, findings)
+	if err != nil {
+		collector.log.Warn(err)
+	}
+}
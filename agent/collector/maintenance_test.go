@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const listCommitLogCommand = "timeout 30s sh -c 'date +%s; find /var/lib/cassandra/commitlog -maxdepth 1 -type f " +
+	"-name '\"'\"'CommitLog-*.log'\"'\"' -printf '\"'\"'%s %T@ %f\\n'\"'\"''"
+const listHintsCommand = "timeout 30s sh -c 'date +%s; find /var/lib/cassandra/hints -maxdepth 1 -type f " +
+	"-name '\"'\"'*.hints'\"'\"' -printf '\"'\"'%s %T@ %f\\n'\"'\"''"
+
+const commitLogListing = `1700000000
+33554432 1699999940.5000000000 CommitLog-7-1699999000001.log
+33554432 1699996400.2500000000 CommitLog-7-1699999000000.log
+`
+
+const hintsListing = `1700000000
+1024 1699990000.0000000000 0f4c1e2a-1111-2222-3333-444455556666-1699990000000-2.hints
+2048 1699999000.0000000000 0f4c1e2a-1111-2222-3333-444455556666-1699999000000-2.hints
+512 1699999500.0000000000 9a8b7c6d-1111-2222-3333-444455556666-1699999500000-2.hints
+`
+
+func TestNodeCollector_collectMaintenanceInfo(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", listCommitLogCommand).
+		Return(bytes.NewBufferString(commitLogListing), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", listHintsCommand).
+		Return(bytes.NewBufferString(hintsListing), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("Dial", "tcp", collectCQLAddress).
+		Return(nil, errors.New("connect failed"))
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s nodetool netstats").
+		Return(bytes.NewBufferString("Mode: NORMAL\n"), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.Maintenance.Timeout = 30 * time.Second
+	settings.Collecting.Maintenance.NodeTool = []NodeToolCommandSettings{{Command: "netstats", Timeout: time.Minute}}
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectMaintenanceInfo(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	var segments []SegmentsInventory
+	data, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/maintenance/segments.json")
+	assert.NoError(t, json.Unmarshal(data, &segments))
+	assert.Equal(t, []SegmentsInventory{
+		{
+			Name: "commitlog", Path: "/var/lib/cassandra/commitlog", Files: 2, Size: 67108864,
+			OldestFile: "CommitLog-7-1699999000000.log", OldestAgeSeconds: 3600,
+		},
+		{
+			Name: "hints", Path: "/var/lib/cassandra/hints", Files: 3, Size: 3584,
+			OldestFile:       "0f4c1e2a-1111-2222-3333-444455556666-1699990000000-2.hints",
+			OldestAgeSeconds: 10000,
+			Hosts: map[string]int{
+				"0f4c1e2a-1111-2222-3333-444455556666": 2,
+				"9a8b7c6d-1111-2222-3333-444455556666": 1,
+			},
+		},
+	}, segments)
+
+	data, _ = afero.ReadFile(appFs, "some/path/node-test-host-1/maintenance/netstats.info")
+	assert.Equal(t, "Mode: NORMAL\n", string(data))
+
+	// The repair history needs CQL, the rest is collected without it
+	exists, _ := afero.Exists(appFs, "some/path/node-test-host-1/maintenance/system_distributed.repair_history.json")
+	assert.False(t, exists)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
@@ -1,47 +1,96 @@
 package collector
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 /*
 Constants
 */
-const prometheusSnapshotSuccess = "success"
-const prometheusSnapshotFolder = "snapshots"
-const prometheusCreateSnapshotTemplate = "curl -s -XPOST http://localhost:%d/api/v1/admin/tsdb/snapshot"
-const temporalSnapshotTarballPath = "/tmp/InstaclustrCollection.tar"
-const createSnapshotTarballTemplate = "tar -cf %s -C %s ."
-const snapshotMetadataFileName = "meta.json"
+const (
+	PrometheusBackend      = "prometheus"
+	VictoriaMetricsBackend = "victoriametrics"
+	ThanosBackend          = "thanos"
+	MimirBackend           = "mimir"
+)
+
+const (
+	NoCompression   = "none"
+	GzipCompression = "gzip"
+)
+
+const snapshotTarballName = "InstaclustrCollection.tar"
+const createStagingFolderTemplate = "mktemp -d %s"
 
 /*
 Settings
 */
 type MetricsCollectorSettings struct {
-	Prometheus     PrometheusSettings `yaml:"prometheus"`
-	CopyCompressed bool               `yaml:"copy_compressed"`
-}
-
-type PrometheusSettings struct {
-	Port     int16  `yaml:"port"`
-	DataPath string `yaml:"data-path"`
+	Backend         string                  `yaml:"backend"`
+	Prometheus      PrometheusSettings      `yaml:"prometheus"`
+	VictoriaMetrics VictoriaMetricsSettings `yaml:"victoriametrics"`
+	Thanos          QueryRangeSettings      `yaml:"thanos"`
+	Mimir           QueryRangeSettings      `yaml:"mimir"`
+	CopyCompressed  bool                    `yaml:"copy_compressed"`
+	Streaming       bool                    `yaml:"streaming"`
+	Compression     string                  `yaml:"compression"`
+	StagingPath     string                  `yaml:"staging-path"`
+	Preflight       bool                    `yaml:"preflight"`
+	ExportRules     bool                    `yaml:"export-rules"`
 }
 
 func MetricsCollectorDefaultSettings() *MetricsCollectorSettings {
 	return &MetricsCollectorSettings{
+		Backend: PrometheusBackend,
 		Prometheus: PrometheusSettings{
 			Port:     9090,
 			DataPath: "/var/data",
 		},
+		VictoriaMetrics: VictoriaMetricsSettings{
+			Port:     8428,
+			DataPath: "/victoria-metrics-data",
+			Mode:     victoriaMetricsExportMode,
+			Match: []string{
+				`{__name__!=""}`,
+			},
+		},
+		Thanos: QueryRangeSettings{
+			URL:          "http://localhost:10902",
+			Queries:      defaultQueryRangeQueries(),
+			Step:         time.Minute,
+			DefaultRange: 24 * time.Hour,
+		},
+		Mimir: QueryRangeSettings{
+			URL:          "http://localhost:8080/prometheus",
+			Queries:      defaultQueryRangeQueries(),
+			Step:         time.Minute,
+			DefaultRange: 24 * time.Hour,
+		},
 		CopyCompressed: true,
+		Streaming:      true,
+		Compression:    NoCompression,
+		StagingPath:    "/tmp",
+		Preflight:      true,
+		ExportRules:    true,
 	}
 }
 
+/*
+Metrics source
+*/
+type MetricsSource interface {
+	Name() string
+	API() MetricsAPI
+	Collect(agent SSHCollectingAgent) error
+}
+
 /*
 Collector
 */
@@ -53,6 +102,13 @@ type MetricsCollector struct {
 	TimestampFrom time.Time
 	TimestampTo   time.Time
 
+	AppFs afero.Fs
+
+	// Tasks selected by name, see TaskNames
+	Tasks TaskFilter
+	// Per task outcome of all the hosts, optional
+	Summary *CollectingSummary
+
 	log *logrus.Entry
 }
 
@@ -63,222 +119,295 @@ func (collector *MetricsCollector) Collect(agent SSHCollectingAgent) error {
 	collector.log = log
 	log.Info("Metrics collecting started")
 
-	err := agent.Connect()
+	source, err := collector.newSource()
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	log.Info("Creating snapshot...")
-	snapshot, err := collector.createSnapshot(agent)
+	tasks := collector.enabledTasks(source)
+	if len(tasks) == 0 {
+		log.Info("No metrics tasks selected")
+		return nil
+	}
+
+	summary := HostSummary{Host: agent.GetHost(), Kind: MetricsHost, Tasks: make([]TaskStatus, 0)}
+	defer func() { collector.Summary.Record(summary) }()
+
+	err = agent.Connect()
 	if err != nil {
 		log.Error(err)
+		summary.Error = err.Error()
 		return err
 	}
-	log.Info("Creating snapshot  OK")
-	log.Info("Snapshot name: ", snapshot)
 
-	resourceName := "snapshot"
-	src := filepath.Join(collector.Settings.Prometheus.DataPath, prometheusSnapshotFolder, snapshot)
+	log.Info("Metrics backend: ", source.Name())
+	sink := &FolderSink{AppFs: collector.AppFs, Path: collector.Path}
+	// One task at a time, the rules export does not compete with the metrics transfer
+	statuses, err := RunTasks(tasks, 1, agent, sink, log)
+	if err != nil {
+		log.Error(err)
+		summary.Error = err.Error()
+		return err
+	}
+	summary.Tasks = statuses
 
-	{
-		log.Info("Lightening snapshot...")
-		err := collector.lightenSnapshot(agent, src)
-		if err != nil {
-			log.Warn("Failed to lighten snapshot: " + err.Error())
-		}
-		log.Info("Lightening snapshot  OK")
+	err = tasksError(statuses)
+	if err != nil {
+		return err
 	}
 
-	if collector.Settings.CopyCompressed {
-		log.Info("Creating snapshot tarball...")
-		tarballErr := collector.tarballSnapshot(agent, src, temporalSnapshotTarballPath)
-		if tarballErr != nil {
-			log.Error(tarballErr)
-		} else {
-			log.Info("Creating snapshot tarball  OK")
-		}
+	log.Info("Metrics collecting completed")
+	return nil
+}
 
-		log.Info("Cleanup snapshot...")
-		err = collector.removeResource(agent, src)
-		if err != nil {
-			log.Error(err)
-		} else {
-			log.Info("Cleanup snapshot  OK")
-		}
+func (collector *MetricsCollector) taskRegistry(source MetricsSource) *TaskRegistry {
+	// Each task runs on a copy of the collector, writing through the task sink and logging with the task logger
+	task := func(sink OutputSink, log *logrus.Entry) *MetricsCollector {
+		task := *collector
+		task.AppFs = sink.Fs()
+		task.log = log
+		return &task
+	}
+
+	registry := NewTaskRegistry()
+	registry.MustRegister(&funcTask{name: "metrics",
+		run: func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+			// The source refers the collector it was created for
+			source, err := task(sink, log).newSource()
+			if err == nil {
+				err = source.Collect(agent)
+			}
+			var warning *WarningError
+			if err != nil && !errors.As(err, &warning) {
+				return &FatalError{Err: err}
+			}
+			return err
+		}})
+	// The rules, alerts and config come from the HTTP API only, they are exported even when the metrics fail
+	registry.MustRegister(&funcTask{name: "rules",
+		run: func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+			return task(sink, log).exportRules(agent, source.API())
+		}})
+
+	return registry
+}
+
+// TaskNames lists the metrics tasks, for the task selection
+func (collector *MetricsCollector) TaskNames() []string {
+	return collector.taskRegistry(nil).Names()
+}
 
-		if tarballErr != nil {
-			return tarballErr
+func (collector *MetricsCollector) enabledTasks(source MetricsSource) []Task {
+	tasks := make([]Task, 0)
+	for _, task := range collector.taskRegistry(source).Select(collector.Tasks) {
+		if task.Name() == "rules" && !collector.Settings.ExportRules {
+			continue
 		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
 
-		src = temporalSnapshotTarballPath
-		resourceName = "snapshot tarball"
+// CollectsSnapshot tells whether the metrics are collected as a binary database snapshot, the anonymization
+// can not rewrite it
+func (collector *MetricsCollector) CollectsSnapshot() bool {
+	if !collector.Tasks.Selects("metrics") {
+		return false
 	}
 
-	dest := filepath.Join(collector.Path, "snapshot")
+	switch strings.ToLower(strings.TrimSpace(collector.Settings.Backend)) {
+	case "", PrometheusBackend:
+		return true
+	case VictoriaMetricsBackend:
+		return collector.Settings.VictoriaMetrics.Mode == victoriaMetricsSnapshotMode
+	}
+	return false
+}
 
-	log.Info("Downloading snapshot...")
-	err = collector.downloadSnapshot(agent, src, dest)
-	if err != nil {
-		log.Error(err)
-	} else {
-		log.Info("Downloading snapshot  OK")
+func (collector *MetricsCollector) newSource() (MetricsSource, error) {
+	backend := strings.ToLower(strings.TrimSpace(collector.Settings.Backend))
+
+	switch backend {
+	case "", PrometheusBackend:
+		return &prometheusSource{collector: collector}, nil
+	case VictoriaMetricsBackend:
+		return &victoriaMetricsSource{collector: collector}, nil
+	case ThanosBackend:
+		return &queryRangeSource{collector: collector, name: ThanosBackend, settings: &collector.Settings.Thanos}, nil
+	case MimirBackend:
+		return &queryRangeSource{collector: collector, name: MimirBackend, settings: &collector.Settings.Mimir}, nil
 	}
 
-	log.Info(fmt.Sprint("Cleanup ", resourceName, "..."))
-	err = collector.removeResource(agent, src)
+	return nil, errors.New("Unsupported metrics backend '" + collector.Settings.Backend + "'")
+}
+
+func (collector *MetricsCollector) downloadResource(agent SSHCollectingAgent, name string, src string, dest string) error {
+	err := agent.ReceiveDir(src, dest, func(copied int64, size int64, remaining time.Duration) {
+		collector.log.Info("Downloading ", name, " ", HumanSize(float64(copied)), " of ", HumanSize(float64(size)),
+			" (remaining ", remaining.Round(time.Second), ") ...")
+	})
 	if err != nil {
-		log.Error(err)
-		return err
+		return errors.New("Failed to receive " + name + " (" + err.Error() + ")")
 	}
-	log.Info(fmt.Sprint("Cleanup ", resourceName, "  OK"))
 
-	log.Info("Metrics collecting completed")
 	return nil
 }
 
-func (collector *MetricsCollector) createSnapshot(agent SSHCollectingAgent) (string, error) {
-	createSnapshotCommand := fmt.Sprintf(prometheusCreateSnapshotTemplate, collector.Settings.Prometheus.Port)
-	sout, serr, err := agent.ExecuteCommand(createSnapshotCommand)
+func (collector *MetricsCollector) streamResource(agent SSHCollectingAgent, name string, command string, dest string) error {
+	err := agent.ReceiveCommandOutput(command, dest, func(copied int64, size int64, remaining time.Duration) {
+		collector.log.Info("Streaming ", name, " ", HumanSize(float64(copied)), " ...")
+	})
 	if err != nil {
-		return "", err
-	}
-	if serr.Len() > 0 {
-		return "", errors.New("Failed to create prometheus snapshot: " + serr.String())
+		return errors.New("Failed to stream " + name + " (" + err.Error() + ")")
 	}
 
-	type PrometheusSnapshotResponse struct {
-		Status string
-		Data   struct {
-			Name string
-		}
-		Error string
-	}
+	return nil
+}
 
-	var response PrometheusSnapshotResponse
-	err = json.Unmarshal(sout.Bytes(), &response)
+func (collector *MetricsCollector) streamTarball(agent SSHCollectingAgent, src string, dest string, dereference bool) error {
+	log := collector.log
+
+	command, err := collector.tarballCommand(src, "-", dereference)
 	if err != nil {
-		return "", errors.New("Failed to unmarshal snapshot command output (" + err.Error() + ")")
+		return err
 	}
 
-	if response.Status != prometheusSnapshotSuccess {
-		return "", errors.New("Failed to create prometheus snapshot (status: " + response.Status + " '" + response.Error + "')")
+	log.Info("Streaming snapshot tarball...")
+	err = collector.streamResource(agent, "snapshot tarball", command, dest)
+	if err != nil {
+		return err
 	}
+	log.Info("Streaming snapshot tarball  OK")
 
-	return response.Data.Name, nil
+	return nil
 }
 
-func (collector *MetricsCollector) lightenSnapshot(agent SSHCollectingAgent, src string) error {
+func (collector *MetricsCollector) stageTarball(agent SSHCollectingAgent, src string, dest string, dereference bool) error {
+	log := collector.log
 
-	blocks, err := getBlockList(agent, src)
+	log.Info("Creating staging folder...")
+	staging, err := collector.createStagingFolder(agent, src)
 	if err != nil {
 		return err
 	}
+	log.Info("Creating staging folder  OK (", staging, ")")
 
-	for index, block := range blocks {
-		metadata, err := getBlockMetadata(agent, block)
-		if err != nil {
-			collector.Logger.Warn("Ignoring block (" + block + "): " + err.Error())
-			continue
-		}
+	tarball := filepath.Join(staging, collector.tarballName())
 
-		if metadata.Version != 1 {
-			collector.Logger.Warn("Ignoring block (", block, "): version #", metadata.Version, " unsupported")
-			continue
-		}
+	log.Info("Creating snapshot tarball...")
+	err = collector.createTarball(agent, src, tarball, dereference)
+	if err == nil {
+		log.Info("Creating snapshot tarball  OK")
 
-		blockMinTimestamp := time.Unix(metadata.MinTime/int64(1000), (metadata.MinTime%int64(1000))*int64(1000000)).UTC()
-		blockMaxTimestamp := time.Unix(metadata.MaxTime/int64(1000), (metadata.MaxTime%int64(1000))*int64(1000000)).UTC()
+		log.Info("Downloading snapshot tarball...")
+		err = collector.downloadResource(agent, "snapshot tarball", tarball, dest)
+		if err == nil {
+			log.Info("Downloading snapshot tarball  OK")
+		}
+	}
 
-		fallsIntoTheSelectedTimeRange := false
-		logMessage := "will be skipped"
+	log.Info("Cleanup staging folder...")
+	cleanupErr := collector.removeResource(agent, staging)
+	if cleanupErr != nil {
+		log.Error(cleanupErr)
+	} else {
+		log.Info("Cleanup staging folder  OK")
+	}
 
-		if (blockMinTimestamp.After(collector.TimestampFrom) || blockMaxTimestamp.After(collector.TimestampFrom)) &&
-			(blockMinTimestamp.Before(collector.TimestampTo) || blockMaxTimestamp.Before(collector.TimestampTo)) {
-			fallsIntoTheSelectedTimeRange = true
-			logMessage = "falls into the time span"
-		}
+	return err
+}
 
-		collector.Logger.Info("Block ", index+1, "/", len(blocks), " ", metadata.Ulid, "  ", blockMinTimestamp, " .. ", blockMaxTimestamp, ": ", logMessage)
+func (collector *MetricsCollector) createTarball(agent SSHCollectingAgent, src string, dest string, dereference bool) error {
+	command, err := collector.tarballCommand(src, dest, dereference)
+	if err != nil {
+		return err
+	}
 
-		if !fallsIntoTheSelectedTimeRange {
-			err := collector.removeResource(agent, block)
-			if err != nil {
-				collector.Logger.Warn("Failed to drop snapshot block: " + err.Error())
-			}
-		}
+	_, serr, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return err
+	}
+	if serr.Len() > 0 {
+		return errors.New("Failed to create snapshot tarball: " + serr.String())
 	}
 
 	return nil
 }
 
-func getBlockList(agent SSHCollectingAgent, src string) ([]string, error) {
+// tarballCommand builds the command that archives the src directory into the dest file
+// or into stdout when dest is '-'.
+func (collector *MetricsCollector) tarballCommand(src string, dest string, dereference bool) (string, error) {
+	flags := "-c"
+	if dereference {
+		flags += "h"
+	}
 
-	entries, err := agent.ListDirectory(src)
-	if err != nil {
-		return nil, errors.New("Failed to get block list of prometheus snapshot: " + err.Error())
+	switch collector.Settings.Compression {
+	case "", NoCompression:
+	case GzipCompression:
+		flags += "z"
+	default:
+		return "", errors.New("Unsupported compression '" + collector.Settings.Compression + "'")
 	}
 
-	directories := make([]string, 0)
-	for _, entry := range entries {
-		if entry.IdDir {
-			directories = append(directories, entry.Path)
-		}
+	if dest != "-" {
+		dest = ShellQuote(dest)
 	}
 
-	return directories, nil
+	return fmt.Sprintf("tar %sf %s -C %s .", flags, dest, ShellQuote(src)), nil
 }
 
-type blockMetadata struct {
-	Ulid    string
-	Version int
-	MinTime int64
-	MaxTime int64
-	Stats   struct {
-		NumSamples uint64
-		NumSeries  uint64
-		NumChunks  uint64
-	}
-}
+// createStagingFolder creates a uniquely named remote folder for the src tarball,
+// after checking that the staging filesystem can hold it.
+func (collector *MetricsCollector) createStagingFolder(agent SSHCollectingAgent, src string) (string, error) {
+	stagingPath := strings.TrimSuffix(collector.Settings.StagingPath, "/")
 
-func getBlockMetadata(agent SSHCollectingAgent, path string) (*blockMetadata, error) {
-	content, err := agent.GetContent(filepath.Join(path, snapshotMetadataFileName))
+	required, err := getUsedSpace(agent, src)
 	if err != nil {
-		return nil, errors.New("Failed to get block metadata (" + err.Error() + ")")
+		return "", err
 	}
 
-	var metadata blockMetadata
-	err = json.Unmarshal(content.Bytes(), &metadata)
+	available, err := getFreeSpace(agent, stagingPath)
 	if err != nil {
-		return nil, errors.New("Failed to unmarshal block metadata (" + err.Error() + ")")
+		return "", err
 	}
 
-	return &metadata, nil
-}
+	if required >= available {
+		return "", errors.New("Insufficient free space in staging path '" + stagingPath + "' (required " +
+			HumanSize(float64(required)) + ", available " + HumanSize(float64(available)) + "), consider enabling streaming")
+	}
 
-func (collector *MetricsCollector) tarballSnapshot(agent SSHCollectingAgent, src string, dest string) error {
-	createTarballCommand := fmt.Sprintf(createSnapshotTarballTemplate, dest, src)
-	_, serr, err := agent.ExecuteCommand(createTarballCommand)
+	template := filepath.Join(stagingPath, "InstaclustrCollection.XXXXXX")
+	sout, serr, err := agent.ExecuteCommand(fmt.Sprintf(createStagingFolderTemplate, ShellQuote(template)))
 	if err != nil {
-		return err
+		return "", errors.New("Failed to create staging folder (" + err.Error() + ")")
 	}
 	if serr.Len() > 0 {
-		return errors.New("Failed to create snapshot tarball: " + serr.String())
+		return "", errors.New("Failed to create staging folder: " + serr.String())
 	}
 
-	return nil
+	return strings.TrimSpace(sout.String()), nil
 }
 
-func (collector *MetricsCollector) downloadSnapshot(agent SSHCollectingAgent, src string, dest string) error {
-	err := agent.ReceiveDir(src, dest, func(copied int64, size int64, remaining time.Duration) {
-		collector.log.Info("Downloading snapshot ", HumanSize(float64(copied)), " of ", HumanSize(float64(size)),
-			" (remaining ", remaining.Round(time.Second), ") ...")
-	})
-	if err != nil {
-		return errors.New("Failed to receive snapshot (" + err.Error() + ")")
+func (collector *MetricsCollector) tarballName() string {
+	if collector.Settings.Compression == GzipCompression {
+		return snapshotTarballName + ".gz"
 	}
 
-	return nil
+	return snapshotTarballName
+}
+
+// snapshotError reports the failed snapshot cleanup along with the transfer error, or as a warning when the
+// snapshot was collected
+func snapshotError(err error, cleanupErr error) error {
+	if cleanupErr == nil {
+		return err
+	}
+	if err != nil {
+		return errors.New(err.Error() + "; " + cleanupErr.Error())
+	}
+	return &WarningError{Err: cleanupErr}
 }
 
 func (collector *MetricsCollector) removeResource(agent SSHCollectingAgent, path string) error {
@@ -289,3 +418,13 @@ func (collector *MetricsCollector) removeResource(agent SSHCollectingAgent, path
 
 	return nil
 }
+
+func (collector *MetricsCollector) makeFolder(name string) (string, error) {
+	path := filepath.Join(collector.Path, name)
+	err := collector.AppFs.MkdirAll(path, os.ModePerm)
+	if err != nil {
+		return "", errors.New("Failed to create '" + name + "' folder (" + err.Error() + ")")
+	}
+
+	return path, nil
+}
@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+const metricsAPISuccess = "success"
+const metricsAPIRequestTemplate = "curl -s -G %s%s%s"
+const queryRangeArgsTemplate = " --data-urlencode %s -d start=%d -d end=%d -d step=%d"
+const queryRangeMaxPoints = 10000
+
+// MetricsAPI is the Prometheus compatible HTTP API of a metrics backend,
+// requested with curl on the metrics host.
+type MetricsAPI struct {
+	URL      string
+	TenantID string
+}
+
+type queryRangeIndexEntry struct {
+	Query string    `json:"query"`
+	File  string    `json:"file"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Step  string    `json:"step"`
+}
+
+func (api *MetricsAPI) command(path string, args string) string {
+	headers := ""
+	if len(api.TenantID) > 0 {
+		headers = " -H " + ShellQuote("X-Scope-OrgID: "+api.TenantID)
+	}
+
+	url := ShellQuote(strings.TrimSuffix(api.URL, "/") + path)
+	return fmt.Sprintf(metricsAPIRequestTemplate, url, headers, args)
+}
+
+// Get requests the API path and checks the response status.
+func (api *MetricsAPI) Get(agent SSHCollectingAgent, path string, args string) (*bytes.Buffer, error) {
+	sout, serr, err := agent.ExecuteCommand(api.command(path, args))
+	if err != nil {
+		return nil, err
+	}
+	if serr.Len() > 0 {
+		return nil, errors.New(serr.String())
+	}
+
+	var response struct {
+		Status string
+		Error  string
+	}
+	err = json.Unmarshal(sout.Bytes(), &response)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal '" + path + "' response (" + err.Error() + ")")
+	}
+
+	if response.Status != metricsAPISuccess {
+		return nil, errors.New("Failed to request '" + path + "' (status: " + response.Status + " '" + response.Error + "')")
+	}
+
+	return sout, nil
+}
+
+// ExportQueryRange saves the query results into the folder, split into chunks
+// the API can return within the points limit.
+func (api *MetricsAPI) ExportQueryRange(collector *MetricsCollector, agent SSHCollectingAgent, query string,
+	from time.Time, to time.Time, step time.Duration, path string, prefix string) []queryRangeIndexEntry {
+
+	index := make([]queryRangeIndexEntry, 0)
+	chunkSize := step * queryRangeMaxPoints
+
+	chunkIndex := 0
+	for start := from; start.Before(to); start = start.Add(chunkSize) {
+		end := start.Add(chunkSize)
+		if end.After(to) {
+			end = to
+		}
+
+		fileName := fmt.Sprintf("%s_%04d.json", prefix, chunkIndex+1)
+		chunkIndex++
+
+		args := fmt.Sprintf(queryRangeArgsTemplate, ShellQuote("query="+query), start.Unix(), end.Unix(), int64(step.Seconds()))
+		sout, err := api.Get(agent, "/api/v1/query_range", args)
+		if err == nil {
+			err = afero.WriteFile(collector.AppFs, filepath.Join(path, fileName), sout.Bytes(), os.ModePerm)
+		}
+		if err != nil {
+			collector.log.Error("Failed to export '" + query + "' (" + err.Error() + ")")
+			continue
+		}
+
+		index = append(index, queryRangeIndexEntry{
+			Query: query,
+			File:  fileName,
+			Start: start,
+			End:   end,
+			Step:  step.String(),
+		})
+	}
+
+	return index
+}
@@ -0,0 +1,308 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+/*
+Constants
+*/
+const prometheusSnapshotSuccess = "success"
+const prometheusSnapshotFolder = "snapshots"
+const prometheusCreateSnapshotTemplate = "curl -s -XPOST http://localhost:%d/api/v1/admin/tsdb/snapshot"
+const snapshotMetadataFileName = "meta.json"
+const blockNameLength = 26
+
+// Rough size of a compressed sample in TSDB blocks, used to estimate snapshot size from the block stats
+const estimatedBytesPerSample = 2
+
+/*
+Settings
+*/
+type PrometheusSettings struct {
+	Port     int16  `yaml:"port"`
+	DataPath string `yaml:"data-path"`
+}
+
+/*
+Source
+*/
+type prometheusSource struct {
+	collector *MetricsCollector
+
+	streaming bool
+}
+
+func (source *prometheusSource) Name() string {
+	return PrometheusBackend
+}
+
+func (source *prometheusSource) API() MetricsAPI {
+	return MetricsAPI{
+		URL: fmt.Sprintf("http://localhost:%d", source.collector.Settings.Prometheus.Port),
+	}
+}
+
+func (source *prometheusSource) Collect(agent SSHCollectingAgent) error {
+	collector := source.collector
+	log := collector.log
+
+	source.streaming = collector.Settings.Streaming
+
+	if collector.Settings.Preflight {
+		log.Info("Preflight checking...")
+		err := source.preflight(agent)
+		if err != nil {
+			return err
+		}
+		log.Info("Preflight checking  OK")
+	}
+
+	log.Info("Creating snapshot...")
+	snapshot, err := source.createSnapshot(agent)
+	if err != nil {
+		return err
+	}
+	log.Info("Creating snapshot  OK")
+	log.Info("Snapshot name: ", snapshot)
+
+	src := filepath.Join(collector.Settings.Prometheus.DataPath, prometheusSnapshotFolder, snapshot)
+
+	{
+		log.Info("Lightening snapshot...")
+		err := source.lightenSnapshot(agent, src)
+		if err != nil {
+			log.Warn("Failed to lighten snapshot: " + err.Error())
+		}
+		log.Info("Lightening snapshot  OK")
+	}
+
+	dest := filepath.Join(collector.Path, "snapshot")
+
+	if !collector.Settings.CopyCompressed {
+		log.Info("Downloading snapshot...")
+		err = collector.downloadResource(agent, "snapshot", src, dest)
+		if err == nil {
+			log.Info("Downloading snapshot  OK")
+		}
+	} else if source.streaming {
+		err = collector.streamTarball(agent, src, filepath.Join(dest, collector.tarballName()), false)
+	} else {
+		err = collector.stageTarball(agent, src, dest, false)
+	}
+
+	log.Info("Cleanup snapshot...")
+	cleanupErr := collector.removeResource(agent, src)
+	if cleanupErr == nil {
+		log.Info("Cleanup snapshot  OK")
+	}
+
+	return snapshotError(err, cleanupErr)
+}
+
+func (source *prometheusSource) createSnapshot(agent SSHCollectingAgent) (string, error) {
+	createSnapshotCommand := fmt.Sprintf(prometheusCreateSnapshotTemplate, source.collector.Settings.Prometheus.Port)
+	sout, serr, err := agent.ExecuteCommand(createSnapshotCommand)
+	if err != nil {
+		return "", err
+	}
+	if serr.Len() > 0 {
+		return "", errors.New("Failed to create prometheus snapshot: " + serr.String())
+	}
+
+	type PrometheusSnapshotResponse struct {
+		Status string
+		Data   struct {
+			Name string
+		}
+		Error string
+	}
+
+	var response PrometheusSnapshotResponse
+	err = json.Unmarshal(sout.Bytes(), &response)
+	if err != nil {
+		return "", errors.New("Failed to unmarshal snapshot command output (" + err.Error() + ")")
+	}
+
+	if response.Status != prometheusSnapshotSuccess {
+		return "", errors.New("Failed to create prometheus snapshot (status: " + response.Status + " '" + response.Error + "')")
+	}
+
+	return response.Data.Name, nil
+}
+
+func (source *prometheusSource) lightenSnapshot(agent SSHCollectingAgent, src string) error {
+	collector := source.collector
+
+	blocks, err := getBlockList(agent, src)
+	if err != nil {
+		return err
+	}
+
+	for index, block := range blocks {
+		metadata, err := getBlockMetadata(agent, block)
+		if err != nil {
+			collector.Logger.Warn("Ignoring block (" + block + "): " + err.Error())
+			continue
+		}
+
+		if metadata.Version != 1 {
+			collector.Logger.Warn("Ignoring block (", block, "): version #", metadata.Version, " unsupported")
+			continue
+		}
+
+		blockMinTimestamp, blockMaxTimestamp := metadata.timeRange()
+
+		fallsIntoTheSelectedTimeRange := source.fallsIntoTimeRange(metadata)
+		logMessage := "will be skipped"
+
+		if fallsIntoTheSelectedTimeRange {
+			logMessage = "falls into the time span"
+		}
+
+		collector.Logger.Info("Block ", index+1, "/", len(blocks), " ", metadata.Ulid, "  ", blockMinTimestamp, " .. ", blockMaxTimestamp, ": ", logMessage)
+
+		if !fallsIntoTheSelectedTimeRange {
+			err := collector.removeResource(agent, block)
+			if err != nil {
+				collector.Logger.Warn("Failed to drop snapshot block: " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+func (source *prometheusSource) fallsIntoTimeRange(metadata *blockMetadata) bool {
+	collector := source.collector
+	blockMinTimestamp, blockMaxTimestamp := metadata.timeRange()
+
+	return (blockMinTimestamp.After(collector.TimestampFrom) || blockMaxTimestamp.After(collector.TimestampFrom)) &&
+		(blockMinTimestamp.Before(collector.TimestampTo) || blockMaxTimestamp.Before(collector.TimestampTo))
+}
+
+// preflight estimates the snapshot size from the TSDB blocks stats and checks it against
+// the free space of the snapshot, staging and local filesystems. Insufficient staging space
+// degrades to streaming, other shortages refuse the collecting.
+func (source *prometheusSource) preflight(agent SSHCollectingAgent) error {
+	collector := source.collector
+	log := collector.log
+	dataPath := collector.Settings.Prometheus.DataPath
+
+	blocks, err := getBlockList(agent, dataPath)
+	if err != nil {
+		return err
+	}
+
+	var estimated, latest int64
+	var latestMaxTime int64
+	for _, block := range blocks {
+		if len(filepath.Base(block)) != blockNameLength {
+			continue
+		}
+
+		metadata, err := getBlockMetadata(agent, block)
+		if err != nil {
+			log.Warn("Ignoring block (" + block + ") in preflight: " + err.Error())
+			continue
+		}
+
+		size := int64(metadata.Stats.NumSamples) * estimatedBytesPerSample
+		if metadata.MaxTime > latestMaxTime {
+			latestMaxTime = metadata.MaxTime
+			latest = size
+		}
+		if source.fallsIntoTimeRange(metadata) {
+			estimated += size
+		}
+	}
+
+	log.Info("Estimated snapshot size: ", HumanSize(float64(estimated)))
+
+	// Blocks are hard-linked, only the head block is written out and it is about the size of the latest block
+	available, err := getFreeSpace(agent, dataPath)
+	if err != nil {
+		return err
+	}
+	if available <= latest {
+		return errors.New("Insufficient free space for snapshot in '" + dataPath + "' (required " +
+			HumanSize(float64(latest)) + ", available " + HumanSize(float64(available)) + ")")
+	}
+
+	if collector.Settings.CopyCompressed && !source.streaming {
+		available, err := getFreeSpace(agent, collector.Settings.StagingPath)
+		if err != nil {
+			return err
+		}
+		if available <= estimated {
+			log.Warn("Insufficient free space in staging path '", collector.Settings.StagingPath, "' (required ",
+				HumanSize(float64(estimated)), ", available ", HumanSize(float64(available)), "), switching to streaming")
+			source.streaming = true
+		}
+	}
+
+	available, err = getLocalFreeSpaceOf(collector.Path)
+	if err != nil {
+		log.Warn(err)
+	} else if available <= estimated {
+		return errors.New("Insufficient local free space in '" + collector.Path + "' (required " +
+			HumanSize(float64(estimated)) + ", available " + HumanSize(float64(available)) + ")")
+	}
+
+	return nil
+}
+
+func getBlockList(agent SSHCollectingAgent, src string) ([]string, error) {
+
+	entries, err := agent.ListDirectory(src)
+	if err != nil {
+		return nil, errors.New("Failed to get block list of prometheus snapshot: " + err.Error())
+	}
+
+	directories := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IdDir {
+			directories = append(directories, entry.Path)
+		}
+	}
+
+	return directories, nil
+}
+
+type blockMetadata struct {
+	Ulid    string
+	Version int
+	MinTime int64
+	MaxTime int64
+	Stats   struct {
+		NumSamples uint64
+		NumSeries  uint64
+		NumChunks  uint64
+	}
+}
+
+func (metadata *blockMetadata) timeRange() (time.Time, time.Time) {
+	minTimestamp := time.Unix(metadata.MinTime/int64(1000), (metadata.MinTime%int64(1000))*int64(1000000)).UTC()
+	maxTimestamp := time.Unix(metadata.MaxTime/int64(1000), (metadata.MaxTime%int64(1000))*int64(1000000)).UTC()
+
+	return minTimestamp, maxTimestamp
+}
+
+func getBlockMetadata(agent SSHCollectingAgent, path string) (*blockMetadata, error) {
+	content, err := agent.GetContent(filepath.Join(path, snapshotMetadataFileName))
+	if err != nil {
+		return nil, errors.New("Failed to get block metadata (" + err.Error() + ")")
+	}
+
+	var metadata blockMetadata
+	err = json.Unmarshal(content.Bytes(), &metadata)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal block metadata (" + err.Error() + ")")
+	}
+
+	return &metadata, nil
+}
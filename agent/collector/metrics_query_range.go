@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+Constants
+*/
+const queryRangeFolderName = "query_range"
+const queryRangeIndexFileName = "index.json"
+
+/*
+Settings
+*/
+type QueryRangeSettings struct {
+	URL          string        `yaml:"url"`
+	TenantID     string        `yaml:"tenant-id"`
+	Queries      []string      `yaml:"queries"`
+	Step         time.Duration `yaml:"step"`
+	DefaultRange time.Duration `yaml:"default-range"`
+}
+
+func defaultQueryRangeQueries() []string {
+	return []string{
+		`up`,
+		`{__name__=~"cassandra_.+"}`,
+	}
+}
+
+/*
+Source
+*/
+type queryRangeSource struct {
+	collector *MetricsCollector
+	name      string
+	settings  *QueryRangeSettings
+}
+
+func (source *queryRangeSource) Name() string {
+	return source.name
+}
+
+func (source *queryRangeSource) API() MetricsAPI {
+	return MetricsAPI{
+		URL:      source.settings.URL,
+		TenantID: source.settings.TenantID,
+	}
+}
+
+func (source *queryRangeSource) Collect(agent SSHCollectingAgent) error {
+	collector := source.collector
+	log := collector.log
+
+	step := source.settings.Step
+	if step < time.Second {
+		return errors.New("Invalid query range step '" + step.String() + "'")
+	}
+
+	path, err := collector.makeFolder(queryRangeFolderName)
+	if err != nil {
+		return err
+	}
+
+	from, to := source.timeRange()
+	log.Info("Query range time span: ", from, " ... ", to)
+
+	api := source.API()
+	index := make([]queryRangeIndexEntry, 0)
+
+	for queryIndex, query := range source.settings.Queries {
+		log.Info("Exporting '", query, "'...")
+		prefix := fmt.Sprintf("query_%02d", queryIndex+1)
+		index = append(index, api.ExportQueryRange(collector, agent, query, from, to, step, path, prefix)...)
+		log.Info("Exporting '", query, "'  OK")
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errors.New("Failed to marshal query range index (" + err.Error() + ")")
+	}
+
+	err = afero.WriteFile(collector.AppFs, filepath.Join(path, queryRangeIndexFileName), data, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to save query range index (" + err.Error() + ")")
+	}
+
+	return nil
+}
+
+func (source *queryRangeSource) timeRange() (time.Time, time.Time) {
+	from := source.collector.TimestampFrom
+	to := source.collector.TimestampTo
+
+	// Long-term stores keep years of data, so an unbounded window is narrowed
+	if from.Unix() <= 0 && source.settings.DefaultRange > 0 {
+		from = to.Add(-source.settings.DefaultRange)
+	}
+
+	return from.UTC(), to.UTC()
+}
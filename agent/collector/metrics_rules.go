@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+Constants
+*/
+const rulesFolderName = "rules"
+const ruleFileName = "rules.yml"
+const alertsSeriesQuery = "ALERTS"
+const alertsSeriesStep = time.Minute
+const defaultAlertsRange = 7 * 24 * time.Hour
+
+var rulesEndpoints = []struct {
+	path string
+	file string
+}{
+	{"/api/v1/rules", "rules.json"},
+	{"/api/v1/alerts", "alerts.json"},
+	{"/api/v1/status/config", "config.json"},
+}
+
+type rulesResponse struct {
+	Data struct {
+		Groups []struct {
+			Name     string
+			Interval float64
+			Rules    []apiRule
+		}
+	}
+}
+
+type apiRule struct {
+	Name        string
+	Query       string
+	Type        string
+	Duration    float64
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name     string `yaml:"name"`
+	Interval string `yaml:"interval,omitempty"`
+	Rules    []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// exportRules saves the rules, alerts and configuration of the metrics backend together with the ALERTS series
+// of the time span. The rules are also converted into a rule file loaded by the analysis Prometheus.
+func (collector *MetricsCollector) exportRules(agent SSHCollectingAgent, api MetricsAPI) error {
+	log := collector.log
+
+	path, err := collector.makeFolder(rulesFolderName)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range rulesEndpoints {
+		sout, err := api.Get(agent, endpoint.path, "")
+		if err != nil {
+			log.Warn("Failed to export '" + endpoint.path + "' (" + err.Error() + ")")
+			continue
+		}
+
+		err = afero.WriteFile(collector.AppFs, filepath.Join(path, endpoint.file), sout.Bytes(), os.ModePerm)
+		if err != nil {
+			log.Warn("Failed to save '" + endpoint.file + "' (" + err.Error() + ")")
+			continue
+		}
+
+		if endpoint.path == "/api/v1/rules" {
+			err = collector.saveRuleFile(sout.Bytes(), filepath.Join(path, ruleFileName))
+			if err != nil {
+				log.Warn(err)
+			}
+		}
+	}
+
+	from := collector.TimestampFrom
+	to := collector.TimestampTo
+	if from.Unix() <= 0 {
+		from = to.Add(-defaultAlertsRange)
+	}
+
+	api.ExportQueryRange(collector, agent, alertsSeriesQuery, from.UTC(), to.UTC(), alertsSeriesStep, path, alertsSeriesQuery)
+
+	return nil
+}
+
+func (collector *MetricsCollector) saveRuleFile(data []byte, dest string) error {
+	var response rulesResponse
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		return errors.New("Failed to unmarshal rules (" + err.Error() + ")")
+	}
+
+	file := ruleFile{Groups: make([]ruleGroup, 0)}
+	for _, group := range response.Data.Groups {
+		converted := ruleGroup{Name: group.Name, Rules: make([]rule, 0)}
+		if group.Interval > 0 {
+			converted.Interval = fmt.Sprintf("%gs", group.Interval)
+		}
+
+		for _, item := range group.Rules {
+			converted.Rules = append(converted.Rules, item.convert())
+		}
+
+		file.Groups = append(file.Groups, converted)
+	}
+
+	content, err := yaml.Marshal(&file)
+	if err != nil {
+		return errors.New("Failed to marshal rule file (" + err.Error() + ")")
+	}
+
+	err = afero.WriteFile(collector.AppFs, dest, content, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to save rule file (" + err.Error() + ")")
+	}
+
+	return nil
+}
+
+func (item *apiRule) convert() rule {
+	converted := rule{Expr: item.Query, Labels: item.Labels}
+	if item.Type == "alerting" {
+		converted.Alert = item.Name
+		converted.Annotations = item.Annotations
+		if item.Duration > 0 {
+			converted.For = fmt.Sprintf("%gs", item.Duration)
+		}
+	} else {
+		converted.Record = item.Name
+	}
+
+	return converted
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"errors"
 	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"strings"
 	"testing"
 	"time"
 )
@@ -23,10 +25,10 @@ const createSnapshotsResponse = `
 const snapshotPath = "/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f"
 
 var snapshotSubdirectoriesList = []FileInfo{
-	{"/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E444CMB0HSK01H0GSRE20NV1", true},
-	{"/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E444CNCYHACHCQPN2ERCGQPP", true},
-	{"/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E48F42Q6VHY4E8KBK02E7QE2", true},
-	{"/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E48FKDW67J37AEQ0N2S0ZBCZ", true},
+	{Path: "/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E444CMB0HSK01H0GSRE20NV1", IdDir: true},
+	{Path: "/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E444CNCYHACHCQPN2ERCGQPP", IdDir: true},
+	{Path: "/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E48F42Q6VHY4E8KBK02E7QE2", IdDir: true},
+	{Path: "/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E48FKDW67J37AEQ0N2S0ZBCZ", IdDir: true},
 }
 
 const snapshotMeta1Path = "/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f/01E444CMB0HSK01H0GSRE20NV1/meta.json"
@@ -113,9 +115,91 @@ const snapshotMeta4Content = `
 	}
 `
 
-const createTarballCommand = "tar -cf /tmp/InstaclustrCollection.tar -C /var/data/snapshots/20200325T090812Z-78629a0f5f3f164f ."
+const streamTarballCommand = "tar -cf - -C /var/data/snapshots/20200325T090812Z-78629a0f5f3f164f ."
 const removeSnapshotPath = "/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f"
-const removeTarballPath = "/tmp/InstaclustrCollection.tar"
+
+const createStagingFolderCommand = "mktemp -d /tmp/InstaclustrCollection.XXXXXX"
+const stagingFolderPath = "/tmp/InstaclustrCollection.a1b2c3"
+const snapshotUsedSpaceCommand = "du -sk /var/data/snapshots/20200325T090812Z-78629a0f5f3f164f"
+const stagingFreeSpaceCommand = "df -Pk /tmp"
+const stagingFreeSpaceResponse = `Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/sda1         10255636 5253636   4461476      55% /
+`
+const createStagedTarballCommand = "tar -czf /tmp/InstaclustrCollection.a1b2c3/InstaclustrCollection.tar.gz -C /var/data/snapshots/20200325T090812Z-78629a0f5f3f164f ."
+
+var dataSubdirectoriesList = []FileInfo{
+	{Path: "/var/data/01E444CMB0HSK01H0GSRE20NV1", IdDir: true},
+	{Path: "/var/data/chunks_head", IdDir: true},
+	{Path: "/var/data/snapshots", IdDir: true},
+	{Path: "/var/data/wal", IdDir: true},
+}
+
+const dataBlockMetaPath = "/var/data/01E444CMB0HSK01H0GSRE20NV1/meta.json"
+const dataFreeSpaceCommand = "df -Pk /var/data"
+
+func mockPreflight(mockedSSHAgent *mockedSSHAgentObject, freeSpaceResponse string) {
+	mockedSSHAgent.
+		On("ListDirectory", "/var/data").
+		Return(dataSubdirectoriesList, nil)
+	mockedSSHAgent.
+		On("GetContent", dataBlockMetaPath).
+		Return(bytes.NewBufferString(snapshotMeta1Content), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", dataFreeSpaceCommand).
+		Return(bytes.NewBufferString(freeSpaceResponse), bytes.NewBufferString(""), nil)
+}
+
+const rulesResponseContent = `
+	{
+		"status": "success",
+		"data": {
+			"groups": [
+				{
+					"name": "cassandra",
+					"file": "/etc/prometheus/rules.yml",
+					"interval": 60,
+					"rules": [
+						{"name": "cassandra:reads:rate1m", "query": "rate(cassandra_reads_total[1m])", "type": "recording"},
+						{"name": "CassandraDown", "query": "up == 0", "duration": 300, "type": "alerting",
+							"labels": {"severity": "critical"}, "annotations": {"summary": "Node down"}}
+					]
+				}
+			]
+		}
+	}
+`
+
+const expectedRuleFileContent = `groups:
+    - name: cassandra
+      interval: 60s
+      rules:
+        - record: cassandra:reads:rate1m
+          expr: rate(cassandra_reads_total[1m])
+        - alert: CassandraDown
+          expr: up == 0
+          for: 300s
+          labels:
+            severity: critical
+          annotations:
+            summary: Node down
+`
+
+func mockRulesExport(mockedSSHAgent *mockedSSHAgentObject, url string, headers string) {
+	mockedSSHAgent.
+		On("ExecuteCommand", "curl -s -G "+url+"/api/v1/rules"+headers).
+		Return(bytes.NewBufferString(rulesResponseContent), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "curl -s -G "+url+"/api/v1/alerts"+headers).
+		Return(bytes.NewBufferString(`{"status":"success","data":{"alerts":[]}}`), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "curl -s -G "+url+"/api/v1/status/config"+headers).
+		Return(bytes.NewBufferString(`{"status":"success","data":{"yaml":""}}`), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", mock.MatchedBy(func(command string) bool {
+			return strings.HasPrefix(command, "curl -s -G "+url+"/api/v1/query_range"+headers+" --data-urlencode query=ALERTS")
+		})).
+		Return(bytes.NewBufferString(`{"status":"success","data":{"resultType":"matrix","result":[]}}`), bytes.NewBufferString(""), nil)
+}
 
 func TestMetricsCollector_Collect(t *testing.T) {
 
@@ -123,6 +207,8 @@ func TestMetricsCollector_Collect(t *testing.T) {
 	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
 	mockedSSHAgent.On("Connect").Return(nil)
 
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
 	mockedSSHAgent.
 		On("ExecuteCommand", createSnapshotCommand).
 		Return(bytes.NewBufferString(createSnapshotsResponse), bytes.NewBufferString(""), nil)
@@ -145,30 +231,196 @@ func TestMetricsCollector_Collect(t *testing.T) {
 		Return(bytes.NewBufferString(snapshotMeta4Content), nil)
 
 	mockedSSHAgent.
-		On("ExecuteCommand", createTarballCommand).
-		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), nil)
+		On("ReceiveCommandOutput",
+			streamTarballCommand, "/some/metrics/path/snapshot/InstaclustrCollection.tar", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
 
 	mockedSSHAgent.
 		On("Remove", removeSnapshotPath).
 		Return(nil)
 
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
+	logger, hook := test.NewNullLogger()
+
+	appFs := afero.NewMemMapFs()
+	collector := MetricsCollector{
+		Settings:      MetricsCollectorDefaultSettings(),
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(0, 0).UTC(),
+		TimestampTo:   time.Now().UTC(),
+		AppFs:         appFs,
+	}
+
+	err := collector.Collect(mockedSSHAgent)
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	}
+
+	ruleFile, err := afero.ReadFile(appFs, "/some/metrics/path/rules/rules.yml")
+	if assert.NoError(t, err) {
+		assert.Equal(t, expectedRuleFileContent, string(ruleFile))
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestMetricsCollector_Collect_OnFailedTransferAndCleanup(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", createSnapshotCommand).
+		Return(bytes.NewBufferString(createSnapshotsResponse), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ListDirectory", snapshotPath).
+		Return([]FileInfo{}, nil)
+	mockedSSHAgent.
+		On("ReceiveCommandOutput",
+			streamTarballCommand, "/some/metrics/path/snapshot/InstaclustrCollection.tar", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(errors.New("connection lost"))
+	mockedSSHAgent.
+		On("Remove", removeSnapshotPath).
+		Return(errors.New("permission denied"))
+
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
+	logger, hook := test.NewNullLogger()
+
+	collector := MetricsCollector{
+		Settings:      MetricsCollectorDefaultSettings(),
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(0, 0).UTC(),
+		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
+	}
+
+	// The transfer error comes first, the cleanup one is reported too
+	err := collector.Collect(mockedSSHAgent)
+	assert.EqualError(t, err, "Failed to stream snapshot tarball (connection lost); "+
+		"Failed to remove resource '"+removeSnapshotPath+"' (permission denied)")
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestMetricsCollector_Collect_OnFailedCleanup(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", createSnapshotCommand).
+		Return(bytes.NewBufferString(createSnapshotsResponse), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ListDirectory", snapshotPath).
+		Return([]FileInfo{}, nil)
+	mockedSSHAgent.
+		On("ReceiveCommandOutput",
+			streamTarballCommand, "/some/metrics/path/snapshot/InstaclustrCollection.tar", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
+	mockedSSHAgent.
+		On("Remove", removeSnapshotPath).
+		Return(errors.New("permission denied"))
+
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
+	logger, hook := test.NewNullLogger()
+
+	collector := MetricsCollector{
+		Settings:      MetricsCollectorDefaultSettings(),
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(0, 0).UTC(),
+		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
+	}
+
+	summary := &CollectingSummary{}
+	collector.Summary = summary
+
+	// The snapshot is collected, the failed cleanup is a warning of the task
+	err := collector.Collect(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	hosts := summary.sorted()
+	if assert.Len(t, hosts, 1) && assert.Len(t, hosts[0].Tasks, 2) {
+		assert.Equal(t, TaskWarning, hosts[0].Tasks[0].Status)
+		assert.Equal(t, "Failed to remove resource '"+removeSnapshotPath+"' (permission denied)", hosts[0].Tasks[0].Error)
+		assert.False(t, hosts[0].Tasks[0].Fatal)
+		assert.Equal(t, TaskOK, hosts[0].Tasks[1].Status)
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestMetricsCollector_CollectOnStreamingDisabled(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", createSnapshotCommand).
+		Return(bytes.NewBufferString(createSnapshotsResponse), bytes.NewBufferString(""), nil)
+
+	mockedSSHAgent.
+		On("ListDirectory", snapshotPath).
+		Return([]FileInfo{}, nil)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", snapshotUsedSpaceCommand).
+		Return(bytes.NewBufferString("1024\t/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", stagingFreeSpaceCommand).
+		Return(bytes.NewBufferString(stagingFreeSpaceResponse), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", createStagingFolderCommand).
+		Return(bytes.NewBufferString(stagingFolderPath+"\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", createStagedTarballCommand).
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), nil)
+
 	mockedSSHAgent.
 		On("ReceiveDir",
-			"/tmp/InstaclustrCollection.tar", "/some/metrics/path/snapshot", mock.AnythingOfType("collector.ProgressFunc")).
+			stagingFolderPath+"/InstaclustrCollection.tar.gz", "/some/metrics/path/snapshot", mock.AnythingOfType("collector.ProgressFunc")).
 		Return(nil)
 
 	mockedSSHAgent.
-		On("Remove", removeTarballPath).
+		On("Remove", stagingFolderPath).
 		Return(nil)
+	mockedSSHAgent.
+		On("Remove", removeSnapshotPath).
+		Return(nil)
+
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
 
 	logger, hook := test.NewNullLogger()
 
+	metricsCollectorSettings := MetricsCollectorDefaultSettings()
+	metricsCollectorSettings.Streaming = false
+	metricsCollectorSettings.Compression = GzipCompression
 	collector := MetricsCollector{
-		Settings:      MetricsCollectorDefaultSettings(),
+		Settings:      metricsCollectorSettings,
 		Logger:        logger,
 		Path:          "/some/metrics/path",
 		TimestampFrom: time.Unix(0, 0).UTC(),
 		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
 	}
 
 	err := collector.Collect(mockedSSHAgent)
@@ -181,12 +433,66 @@ func TestMetricsCollector_Collect(t *testing.T) {
 	hook.Reset()
 }
 
+func TestMetricsCollector_CollectOnInsufficientStagingSpace(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", createSnapshotCommand).
+		Return(bytes.NewBufferString(createSnapshotsResponse), bytes.NewBufferString(""), nil)
+
+	mockedSSHAgent.
+		On("ListDirectory", snapshotPath).
+		Return([]FileInfo{}, nil)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", snapshotUsedSpaceCommand).
+		Return(bytes.NewBufferString("8000000\t/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", stagingFreeSpaceCommand).
+		Return(bytes.NewBufferString(stagingFreeSpaceResponse), bytes.NewBufferString(""), nil)
+
+	mockedSSHAgent.
+		On("Remove", removeSnapshotPath).
+		Return(nil)
+
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
+	logger, hook := test.NewNullLogger()
+
+	metricsCollectorSettings := MetricsCollectorDefaultSettings()
+	metricsCollectorSettings.Streaming = false
+	collector := MetricsCollector{
+		Settings:      metricsCollectorSettings,
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(0, 0).UTC(),
+		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
+	}
+
+	err := collector.Collect(mockedSSHAgent)
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "Insufficient free space in staging path '/tmp' (required 8.192 GB, available 4.569 GB), consider enabling streaming")
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
 func TestMetricsCollector_CollectOnCompressionDisabled(t *testing.T) {
 
 	mockedSSHAgent := new(mockedSSHAgentObject)
 	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
 	mockedSSHAgent.On("Connect").Return(nil)
 
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
 	mockedSSHAgent.
 		On("ExecuteCommand", createSnapshotCommand).
 		Return(bytes.NewBufferString(createSnapshotsResponse), bytes.NewBufferString(""), nil)
@@ -217,6 +523,8 @@ func TestMetricsCollector_CollectOnCompressionDisabled(t *testing.T) {
 			"/var/data/snapshots/20200325T090812Z-78629a0f5f3f164f", "/some/metrics/path/snapshot", mock.AnythingOfType("collector.ProgressFunc")).
 		Return(nil)
 
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
 	logger, hook := test.NewNullLogger()
 
 	metricsCollectorSettings := MetricsCollectorDefaultSettings()
@@ -227,6 +535,7 @@ func TestMetricsCollector_CollectOnCompressionDisabled(t *testing.T) {
 		Path:          "/some/metrics/path",
 		TimestampFrom: time.Unix(0, 0).UTC(),
 		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
 	}
 
 	err := collector.Collect(mockedSSHAgent)
@@ -257,6 +566,7 @@ func TestMetricsCollector_Collect_OnFailedToConnect(t *testing.T) {
 		Path:          "/some/metrics/path",
 		TimestampFrom: time.Unix(0, 0).UTC(),
 		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
 	}
 
 	err := collector.Collect(mockedSSHAgent)
@@ -279,10 +589,14 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByError(t *testing.T)
 		On("Connect").
 		Return(nil)
 
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
 	mockedSSHAgent.
 		On("ExecuteCommand", createSnapshotCommand).
 		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), errors.New("some test error"))
 
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
 	logger, hook := test.NewNullLogger()
 
 	collector := MetricsCollector{
@@ -291,6 +605,7 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByError(t *testing.T)
 		Path:          "/some/metrics/path",
 		TimestampFrom: time.Unix(0, 0).UTC(),
 		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
 	}
 
 	err := collector.Collect(mockedSSHAgent)
@@ -313,11 +628,16 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByStdoutMessage(t *tes
 		On("Connect").
 		Return(nil)
 
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
 	mockedSSHAgent.
 		On("ExecuteCommand",
 			createSnapshotCommand).
 		Return(bytes.NewBufferString(""), bytes.NewBufferString("we can not do that"), nil)
 
+	// The rules are exported from the API in any case
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
 	logger, hook := test.NewNullLogger()
 
 	collector := MetricsCollector{
@@ -326,13 +646,25 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByStdoutMessage(t *tes
 		Path:          "/some/metrics/path",
 		TimestampFrom: time.Unix(0, 0).UTC(),
 		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
 	}
 
+	summary := &CollectingSummary{}
+	collector.Summary = summary
+
 	err := collector.Collect(mockedSSHAgent)
 	if assert.Error(t, err) {
 		assert.EqualError(t, err, "Failed to create prometheus snapshot: we can not do that")
 	}
 
+	// The rules are exported without the metrics
+	hosts := summary.sorted()
+	if assert.Len(t, hosts, 1) && assert.Len(t, hosts[0].Tasks, 2) {
+		assert.Equal(t, TaskFailed, hosts[0].Tasks[0].Status)
+		assert.Equal(t, "rules", hosts[0].Tasks[1].Name)
+		assert.Equal(t, TaskOK, hosts[0].Tasks[1].Status)
+	}
+
 	mockedSSHAgent.AssertExpectations(t)
 
 	hook.Reset()
@@ -348,10 +680,14 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByInvalidResponse(t *t
 		On("Connect").
 		Return(nil)
 
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
 	mockedSSHAgent.
 		On("ExecuteCommand", createSnapshotCommand).
 		Return(bytes.NewBufferString(`{ "xxx": "blablabla", sdfgsdf gsdfgsdfg } `), bytes.NewBufferString(""), nil)
 
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
 	logger, hook := test.NewNullLogger()
 
 	collector := MetricsCollector{
@@ -360,6 +696,7 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByInvalidResponse(t *t
 		Path:          "/some/metrics/path",
 		TimestampFrom: time.Unix(0, 0).UTC(),
 		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
 	}
 
 	err := collector.Collect(mockedSSHAgent)
@@ -382,10 +719,14 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByInvalidStatus(t *tes
 		On("Connect").
 		Return(nil)
 
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+
 	mockedSSHAgent.
 		On("ExecuteCommand", createSnapshotCommand).
 		Return(bytes.NewBufferString(`{ "xxx": "blablabla" } `), bytes.NewBufferString(""), nil)
 
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
 	logger, hook := test.NewNullLogger()
 
 	collector := MetricsCollector{
@@ -394,6 +735,7 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByInvalidStatus(t *tes
 		Path:          "/some/metrics/path",
 		TimestampFrom: time.Unix(0, 0).UTC(),
 		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
 	}
 
 	err := collector.Collect(mockedSSHAgent)
@@ -405,3 +747,219 @@ func TestMetricsCollector_Collect_OnFailedToCreateSnapshotByInvalidStatus(t *tes
 
 	hook.Reset()
 }
+
+func TestMetricsCollector_CollectVictoriaMetricsExport(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+
+	mockedSSHAgent.
+		On("ReceiveCommandOutput",
+			"curl -sf -G http://localhost:8428/api/v1/export -d start=1584957600 -d end=1584986400"+
+				" --data-urlencode 'match[]={__name__!=\"\"}'",
+			"/some/metrics/path/export/export.jsonl", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
+
+	mockRulesExport(mockedSSHAgent, "http://localhost:8428", "")
+
+	logger, hook := test.NewNullLogger()
+
+	settings := MetricsCollectorDefaultSettings()
+	settings.Backend = VictoriaMetricsBackend
+	collector := MetricsCollector{
+		Settings:      settings,
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(1584957600, 0).UTC(),
+		TimestampTo:   time.Unix(1584986400, 0).UTC(),
+		AppFs:         afero.NewMemMapFs(),
+	}
+
+	err := collector.Collect(mockedSSHAgent)
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestMetricsCollector_CollectMimirQueryRange(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", "curl -s -G http://localhost:8080/prometheus/api/v1/query_range -H 'X-Scope-OrgID: tenant-1'"+
+			" --data-urlencode query=up -d start=1584957600 -d end=1584986400 -d step=60").
+		Return(bytes.NewBufferString(`{"status":"success","data":{"resultType":"matrix","result":[]}}`), bytes.NewBufferString(""), nil)
+
+	mockRulesExport(mockedSSHAgent, "http://localhost:8080/prometheus", " -H 'X-Scope-OrgID: tenant-1'")
+
+	logger, hook := test.NewNullLogger()
+
+	settings := MetricsCollectorDefaultSettings()
+	settings.Backend = MimirBackend
+	settings.Mimir.TenantID = "tenant-1"
+	settings.Mimir.Queries = []string{"up"}
+
+	appFs := afero.NewMemMapFs()
+	collector := MetricsCollector{
+		Settings:      settings,
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(1584957600, 0).UTC(),
+		TimestampTo:   time.Unix(1584986400, 0).UTC(),
+		AppFs:         appFs,
+	}
+
+	err := collector.Collect(mockedSSHAgent)
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	}
+
+	exists, _ := afero.Exists(appFs, "/some/metrics/path/query_range/query_01_0001.json")
+	assert.True(t, exists)
+	exists, _ = afero.Exists(appFs, "/some/metrics/path/query_range/index.json")
+	assert.True(t, exists)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestMetricsCollector_Collect_OnUnsupportedBackend(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+
+	logger, hook := test.NewNullLogger()
+
+	settings := MetricsCollectorDefaultSettings()
+	settings.Backend = "graphite"
+	collector := MetricsCollector{
+		Settings:      settings,
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(0, 0).UTC(),
+		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
+	}
+
+	err := collector.Collect(mockedSSHAgent)
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "Unsupported metrics backend 'graphite'")
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+const lowFreeSpaceResponse = `Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/sda1         10255636 10255620       16     100% /
+`
+
+func TestMetricsCollector_CollectOnPreflightSwitchingToStreaming(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+
+	mockPreflight(mockedSSHAgent, stagingFreeSpaceResponse)
+	mockedSSHAgent.
+		On("ExecuteCommand", stagingFreeSpaceCommand).
+		Return(bytes.NewBufferString(lowFreeSpaceResponse), bytes.NewBufferString(""), nil)
+
+	mockedSSHAgent.
+		On("ExecuteCommand", createSnapshotCommand).
+		Return(bytes.NewBufferString(createSnapshotsResponse), bytes.NewBufferString(""), nil)
+
+	mockedSSHAgent.
+		On("ListDirectory", snapshotPath).
+		Return([]FileInfo{}, nil)
+
+	mockedSSHAgent.
+		On("ReceiveCommandOutput",
+			streamTarballCommand, "/some/metrics/path/snapshot/InstaclustrCollection.tar", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
+
+	mockedSSHAgent.
+		On("Remove", removeSnapshotPath).
+		Return(nil)
+
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
+	logger, hook := test.NewNullLogger()
+
+	metricsCollectorSettings := MetricsCollectorDefaultSettings()
+	metricsCollectorSettings.Streaming = false
+	collector := MetricsCollector{
+		Settings:      metricsCollectorSettings,
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(0, 0).UTC(),
+		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
+	}
+
+	err := collector.Collect(mockedSSHAgent)
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestMetricsCollector_Collect_OnPreflightInsufficientSnapshotSpace(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("metrics-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+
+	mockPreflight(mockedSSHAgent, lowFreeSpaceResponse)
+
+	mockRulesExport(mockedSSHAgent, "http://localhost:9090", "")
+
+	logger, hook := test.NewNullLogger()
+
+	collector := MetricsCollector{
+		Settings:      MetricsCollectorDefaultSettings(),
+		Logger:        logger,
+		Path:          "/some/metrics/path",
+		TimestampFrom: time.Unix(0, 0).UTC(),
+		TimestampTo:   time.Now().UTC(),
+		AppFs:         afero.NewMemMapFs(),
+	}
+
+	err := collector.Collect(mockedSSHAgent)
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "Insufficient free space for snapshot in '/var/data' (required 18.71 MB, available 16.38 kB)")
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestMetricsCollector_CollectsSnapshot(t *testing.T) {
+	collector := MetricsCollector{Settings: MetricsCollectorDefaultSettings()}
+	assert.True(t, collector.CollectsSnapshot())
+
+	collector.Tasks = TaskFilter{Skip: []string{"metrics"}}
+	assert.False(t, collector.CollectsSnapshot())
+	collector.Tasks = TaskFilter{}
+
+	collector.Settings.Backend = VictoriaMetricsBackend
+	assert.False(t, collector.CollectsSnapshot())
+	collector.Settings.VictoriaMetrics.Mode = victoriaMetricsSnapshotMode
+	assert.True(t, collector.CollectsSnapshot())
+
+	collector.Settings.Backend = ThanosBackend
+	assert.False(t, collector.CollectsSnapshot())
+}
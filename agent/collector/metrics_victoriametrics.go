@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Constants
+*/
+const victoriaMetricsSnapshotMode = "snapshot"
+const victoriaMetricsExportMode = "export"
+const victoriaMetricsStatusOk = "ok"
+const victoriaMetricsSnapshotFolder = "snapshots"
+const victoriaMetricsCreateSnapshotTemplate = "curl -s http://localhost:%d/snapshot/create"
+const victoriaMetricsDeleteSnapshotTemplate = "curl -s -G http://localhost:%d/snapshot/delete --data-urlencode %s"
+const victoriaMetricsExportTemplate = "curl -sf -G http://localhost:%d/api/v1/export -d start=%d -d end=%d%s"
+const victoriaMetricsExportFileName = "export.jsonl"
+
+/*
+Settings
+*/
+type VictoriaMetricsSettings struct {
+	Port     int16    `yaml:"port"`
+	DataPath string   `yaml:"data-path"`
+	Mode     string   `yaml:"mode"`
+	Match    []string `yaml:"match"`
+}
+
+/*
+Source
+*/
+type victoriaMetricsSource struct {
+	collector *MetricsCollector
+}
+
+func (source *victoriaMetricsSource) Name() string {
+	return VictoriaMetricsBackend
+}
+
+func (source *victoriaMetricsSource) API() MetricsAPI {
+	return MetricsAPI{
+		URL: fmt.Sprintf("http://localhost:%d", source.collector.Settings.VictoriaMetrics.Port),
+	}
+}
+
+func (source *victoriaMetricsSource) Collect(agent SSHCollectingAgent) error {
+	mode := source.collector.Settings.VictoriaMetrics.Mode
+
+	switch mode {
+	case "", victoriaMetricsExportMode:
+		return source.collectExport(agent)
+	case victoriaMetricsSnapshotMode:
+		return source.collectSnapshot(agent)
+	}
+
+	return errors.New("Unsupported victoriametrics collecting mode '" + mode + "'")
+}
+
+func (source *victoriaMetricsSource) collectSnapshot(agent SSHCollectingAgent) error {
+	collector := source.collector
+	settings := &collector.Settings.VictoriaMetrics
+	log := collector.log
+
+	log.Info("Creating snapshot...")
+	snapshot, err := source.createSnapshot(agent)
+	if err != nil {
+		return err
+	}
+	log.Info("Creating snapshot  OK")
+	log.Info("Snapshot name: ", snapshot)
+
+	// VictoriaMetrics snapshots consist of symlinks to the partitions, so they have to be dereferenced
+	src := filepath.Join(settings.DataPath, victoriaMetricsSnapshotFolder, snapshot)
+	dest := filepath.Join(collector.Path, "snapshot")
+
+	if collector.Settings.Streaming {
+		err = collector.streamTarball(agent, src, filepath.Join(dest, collector.tarballName()), true)
+	} else {
+		err = collector.stageTarball(agent, src, dest, true)
+	}
+
+	log.Info("Cleanup snapshot...")
+	cleanupErr := source.deleteSnapshot(agent, snapshot)
+	if cleanupErr == nil {
+		log.Info("Cleanup snapshot  OK")
+	}
+
+	return snapshotError(err, cleanupErr)
+}
+
+func (source *victoriaMetricsSource) collectExport(agent SSHCollectingAgent) error {
+	collector := source.collector
+	log := collector.log
+
+	log.Info("Streaming export...")
+	dest := filepath.Join(collector.Path, "export", victoriaMetricsExportFileName)
+	err := collector.streamResource(agent, "export", source.exportCommand(), dest)
+	if err != nil {
+		return err
+	}
+	log.Info("Streaming export  OK")
+
+	return nil
+}
+
+func (source *victoriaMetricsSource) exportCommand() string {
+	collector := source.collector
+	settings := &collector.Settings.VictoriaMetrics
+
+	var match strings.Builder
+	for _, selector := range settings.Match {
+		fmt.Fprintf(&match, " --data-urlencode %s", ShellQuote("match[]="+selector))
+	}
+
+	return fmt.Sprintf(victoriaMetricsExportTemplate, settings.Port,
+		collector.TimestampFrom.Unix(), collector.TimestampTo.Unix(), match.String())
+}
+
+type victoriaMetricsResponse struct {
+	Status   string
+	Snapshot string
+	Msg      string
+}
+
+func (source *victoriaMetricsSource) createSnapshot(agent SSHCollectingAgent) (string, error) {
+	command := fmt.Sprintf(victoriaMetricsCreateSnapshotTemplate, source.collector.Settings.VictoriaMetrics.Port)
+	response, err := source.executeRequest(agent, command)
+	if err != nil {
+		return "", errors.New("Failed to create victoriametrics snapshot (" + err.Error() + ")")
+	}
+
+	return response.Snapshot, nil
+}
+
+func (source *victoriaMetricsSource) deleteSnapshot(agent SSHCollectingAgent, snapshot string) error {
+	command := fmt.Sprintf(victoriaMetricsDeleteSnapshotTemplate, source.collector.Settings.VictoriaMetrics.Port,
+		ShellQuote("snapshot="+snapshot))
+	_, err := source.executeRequest(agent, command)
+	if err != nil {
+		return errors.New("Failed to delete victoriametrics snapshot '" + snapshot + "' (" + err.Error() + ")")
+	}
+
+	return nil
+}
+
+func (source *victoriaMetricsSource) executeRequest(agent SSHCollectingAgent, command string) (*victoriaMetricsResponse, error) {
+	sout, serr, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if serr.Len() > 0 {
+		return nil, errors.New(serr.String())
+	}
+
+	var response victoriaMetricsResponse
+	err = json.Unmarshal(sout.Bytes(), &response)
+	if err != nil {
+		return nil, errors.New("unmarshal response: " + err.Error())
+	}
+
+	if response.Status != victoriaMetricsStatusOk {
+		return nil, errors.New("status: " + response.Status + " '" + response.Msg + "'")
+	}
+
+	return &response, nil
+}
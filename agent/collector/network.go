@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+const NetworkLatencyFileName = "latency.json"
+
+const socketsCommandTemplate = "ss -tanp '( %s )'"
+const interfacesCommand = "ip -s -s link"
+const localAddressesCommand = "hostname -I"
+const pingCommandTemplate = "ping -c %d -i 0.2 -W 2 -q %s"
+
+var nodeToolStatusLinePattern = regexp.MustCompile(`^[UD][NLJM]\s+(\S+)`)
+var pingPacketsPattern = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+var pingRoundTripPattern = regexp.MustCompile(`= ([\d.]+)/([\d.]+)/([\d.]+)/([\d.]+) ms`)
+
+/*
+Settings
+*/
+type NetworkSettings struct {
+	Enabled bool          `yaml:"enabled"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Socket states are recorded for these local or remote ports
+	Ports []int `yaml:"ports"`
+	// Ping every other node of the cluster, as listed by nodetool status
+	Latency      bool `yaml:"latency"`
+	LatencyPings int  `yaml:"latency-pings"`
+}
+
+func NetworkDefaultSettings() NetworkSettings {
+	return NetworkSettings{
+		Enabled:      true,
+		Timeout:      time.Minute,
+		Ports:        []int{7000, 7001, 9042, 7199},
+		Latency:      false,
+		LatencyPings: 5,
+	}
+}
+
+/*
+Collector
+*/
+
+// NetworkLatency is the round trip time from the node to each peer, saved to network/latency.json
+type NetworkLatency struct {
+	Addresses []string                 `json:"addresses"`
+	Peers     map[string]PeerRoundTrip `json:"peers"`
+}
+
+type PeerRoundTrip struct {
+	Transmitted int     `json:"transmitted"`
+	Received    int     `json:"received"`
+	MinMs       float64 `json:"min-ms"`
+	AvgMs       float64 `json:"avg-ms"`
+	MaxMs       float64 `json:"max-ms"`
+	Error       string  `json:"error,omitempty"`
+}
+
+func (collector *NodeCollector) collectNetworkInfo(agent SSHCollectingAgent) error {
+	settings := collector.Settings.Collecting.Network
+
+	dest, err := collector.makeFolder(agent.GetHost(), "network")
+	if err != nil {
+		return err
+	}
+
+	if len(settings.Ports) > 0 {
+		filters := make([]string, 0, len(settings.Ports))
+		for _, port := range settings.Ports {
+			filters = append(filters, fmt.Sprintf("sport = :%d or dport = :%d", port, port))
+		}
+		command := fmt.Sprintf(socketsCommandTemplate, strings.Join(filters, " or "))
+		collector.runNetworkCommand(agent, command, filepath.Join(dest, "sockets.txt"))
+	}
+
+	collector.runNetworkCommand(agent, interfacesCommand, filepath.Join(dest, "interfaces.txt"))
+
+	if settings.Latency {
+		err = collector.collectNetworkLatency(agent, dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (collector *NodeCollector) runNetworkCommand(agent SSHCollectingAgent, command string, path string) {
+	sout, _, err := agent.ExecuteCommand(withTimeout(command, collector.Settings.Collecting.Network.Timeout))
+	if err != nil {
+		collector.log.Error("Failed to execute '" + command + "' (" + err.Error() + ")")
+		return
+	}
+
+	err = afero.WriteFile(collector.AppFs, path, sout.Bytes(), os.ModePerm)
+	if err != nil {
+		collector.log.Error("Failed to save '" + command + "' data (" + err.Error() + ")")
+	}
+}
+
+func (collector *NodeCollector) collectNetworkLatency(agent SSHCollectingAgent, dest string) error {
+	settings := collector.Settings.Collecting.Network
+
+	peers, err := collector.listClusterNodes(agent)
+	if err != nil {
+		return err
+	}
+
+	latency := NetworkLatency{Addresses: make([]string, 0), Peers: make(map[string]PeerRoundTrip)}
+	local := make(map[string]bool)
+
+	sout, _, err := agent.ExecuteCommand(localAddressesCommand)
+	if err != nil {
+		collector.log.Warn("Failed to list local addresses (" + err.Error() + ")")
+	} else {
+		for _, address := range strings.Fields(sout.String()) {
+			latency.Addresses = append(latency.Addresses, address)
+			local[address] = true
+		}
+	}
+
+	for _, peer := range peers {
+		if local[peer] {
+			continue
+		}
+
+		// ping exits with an error when a reply is missing, the summary is still printed
+		command := fmt.Sprintf(pingCommandTemplate, settings.LatencyPings, ShellQuote(peer))
+		sout, _, err := agent.ExecuteCommand(withTimeout(command, settings.Timeout))
+		roundTrip := PeerRoundTrip{}
+		if sout != nil {
+			roundTrip = parsePingSummary(sout.String())
+		}
+		if err != nil && roundTrip.Transmitted == 0 {
+			roundTrip.Error = err.Error()
+		}
+		latency.Peers[peer] = roundTrip
+	}
+
+	data, err := json.MarshalIndent(latency, "", "  ")
+	if err != nil {
+		return errors.New("Failed to marshal network latency (" + err.Error() + ")")
+	}
+	err = afero.WriteFile(collector.AppFs, filepath.Join(dest, NetworkLatencyFileName), data, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to save network latency (" + err.Error() + ")")
+	}
+
+	return nil
+}
+
+// listClusterNodes returns the addresses of all the nodes known to the node, down ones included
+func (collector *NodeCollector) listClusterNodes(agent SSHCollectingAgent) ([]string, error) {
+	credentials, err := collector.prepareNodeToolCredentials(agent)
+	if err != nil {
+		return nil, err
+	}
+	defer collector.cleanupNodeToolCredentials(agent, credentials)
+
+	command := withTimeout("nodetool "+credentials.args+"status", collector.Settings.Collecting.Network.Timeout)
+
+	var sout *bytes.Buffer
+	if credentials.input != nil {
+		sout, _, err = agent.ExecuteCommandWithInput(command, credentials.input)
+	} else {
+		sout, _, err = agent.ExecuteCommand(command)
+	}
+	if err != nil {
+		return nil, errors.New("Failed to list cluster nodes (" + err.Error() + ")")
+	}
+
+	nodes := make([]string, 0)
+	for _, line := range strings.Split(sout.String(), "\n") {
+		match := nodeToolStatusLinePattern.FindStringSubmatch(line)
+		if match != nil && net.ParseIP(match[1]) != nil {
+			nodes = append(nodes, match[1])
+		}
+	}
+
+	return nodes, nil
+}
+
+func parsePingSummary(output string) PeerRoundTrip {
+	roundTrip := PeerRoundTrip{}
+
+	match := pingPacketsPattern.FindStringSubmatch(output)
+	if match != nil {
+		roundTrip.Transmitted, _ = strconv.Atoi(match[1])
+		roundTrip.Received, _ = strconv.Atoi(match[2])
+	}
+
+	match = pingRoundTripPattern.FindStringSubmatch(output)
+	if match != nil {
+		roundTrip.MinMs, _ = strconv.ParseFloat(match[1], 64)
+		roundTrip.AvgMs, _ = strconv.ParseFloat(match[2], 64)
+		roundTrip.MaxMs, _ = strconv.ParseFloat(match[3], 64)
+	}
+
+	return roundTrip
+}
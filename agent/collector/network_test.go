@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const nodeToolStatusOutput = `Datacenter: dc1
+===============
+Status=Up/Down
+|/ State=Normal/Leaving/Joining/Moving
+--  Address    Load       Tokens  Owns (effective)  Host ID                               Rack
+UN  10.0.0.1   1.2 GiB    256     33.3%             d2b1b5e5-6c1e-4b8e-9a52-2f1e0d6f6a11  rack1
+UN  10.0.0.2   1.1 GiB    256     33.3%             0b9e2c4f-0c6b-4a1c-8f7b-7c9f5a1b2c22  rack1
+DN  10.0.0.3   1.3 GiB    256     33.3%             4c1a7d2e-9b3f-4e6a-a1d2-3e4f5a6b7c33  rack1
+`
+
+const pingOutput = `PING 10.0.0.2 (10.0.0.2) 56(84) bytes of data.
+
+--- 10.0.0.2 ping statistics ---
+5 packets transmitted, 4 received, 20% packet loss, time 812ms
+rtt min/avg/max/mdev = 0.210/0.345/0.502/0.101 ms
+`
+
+const pingUnreachableOutput = `PING 10.0.0.3 (10.0.0.3) 56(84) bytes of data.
+
+--- 10.0.0.3 ping statistics ---
+5 packets transmitted, 0 received, 100% packet loss, time 4093ms
+`
+
+func TestNodeCollector_collectNetworkInfo(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s ss -tanp '( sport = :7000 or dport = :7000 )'").
+		Return(bytes.NewBufferString("sockets"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", collectNetworkInterfacesCommand).
+		Return(bytes.NewBufferString("interfaces"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s nodetool status").
+		Return(bytes.NewBufferString(nodeToolStatusOutput), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "hostname -I").
+		Return(bytes.NewBufferString("10.0.0.1 172.17.0.1 \n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s ping -c 5 -i 0.2 -W 2 -q 10.0.0.2").
+		Return(bytes.NewBufferString(pingOutput), bytes.NewBufferString(""), errors.New("exit status 1"))
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s ping -c 5 -i 0.2 -W 2 -q 10.0.0.3").
+		Return(bytes.NewBufferString(pingUnreachableOutput), bytes.NewBufferString(""), errors.New("exit status 1"))
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.Network.Ports = []int{7000}
+	settings.Collecting.Network.Latency = true
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectNetworkInfo(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	data, err := afero.ReadFile(appFs, "some/path/node-test-host-1/network/latency.json")
+	if assert.NoError(t, err) {
+		var latency NetworkLatency
+		assert.NoError(t, json.Unmarshal(data, &latency))
+		assert.Equal(t, NetworkLatency{
+			Addresses: []string{"10.0.0.1", "172.17.0.1"},
+			Peers: map[string]PeerRoundTrip{
+				"10.0.0.2": {Transmitted: 5, Received: 4, MinMs: 0.21, AvgMs: 0.345, MaxMs: 0.502},
+				"10.0.0.3": {Transmitted: 5, Received: 0},
+			},
+		}, latency)
+	}
+
+	exists, _ := afero.Exists(appFs, "some/path/node-test-host-1/network/sockets.txt")
+	assert.True(t, exists)
+	exists, _ = afero.Exists(appFs, "some/path/node-test-host-1/network/interfaces.txt")
+	assert.True(t, exists)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
@@ -6,10 +6,10 @@ import (
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -17,41 +17,96 @@ import (
 Constants
 */
 const cassandraGCLogFolderName = "logs"
+const timeoutCommandTemplate = "timeout %ds %s"
+const createCredentialsFileCommand = "mktemp"
+const credentialsFileMode = 0600
+
+const (
+	FileCredentialsTransfer  = "file"
+	StdinCredentialsTransfer = "stdin"
+)
+
+const (
+	KeepLogArchives       = "keep"
+	DecompressLogArchives = "decompress"
+)
 
 /*
 Settings
 */
 type NodeCollectorSettings struct {
-	Cassandra  CassandraSettings  `yaml:"cassandra"`
-	Collecting CollectingSettings `yaml:"collecting"`
+	Cassandra   CassandraSettings    `yaml:"cassandra"`
+	Collecting  CollectingSettings   `yaml:"collecting"`
+	CustomTasks []CustomTaskSettings `yaml:"custom-tasks"`
+	// Tasks run at once on a node, each holds an SSH session (sshd allows 10 per connection by default)
+	MaxConcurrentTasks int `yaml:"max-concurrent-tasks"`
 }
 
 type CassandraSettings struct {
-	ConfigPath string   `yaml:"config-path"`
-	LogPath    string   `yaml:"log-path"`
-	GCPath     string   `yaml:"gc-path"`
-	DataPath   []string `yaml:"data-path"`
-	Username   string   `yaml:"username"`
-	Password   string   `yaml:"password"`
+	// Detect the paths from the running Cassandra process, the configured ones are the fallback
+	DiscoverPaths bool     `yaml:"discover-paths"`
+	ConfigPath    string   `yaml:"config-path"`
+	LogPath       string   `yaml:"log-path"`
+	GCPath        string   `yaml:"gc-path"`
+	DataPath      []string `yaml:"data-path"`
+	CommitLogPath string   `yaml:"commitlog-path"`
+	HintsPath     string   `yaml:"hints-path"`
+	Username      string   `yaml:"username"`
+	Password      string   `yaml:"password"`
+
+	// Remote JMX password file passed to nodetool as is
+	PasswordFile string `yaml:"password-file"`
+	// How the password is handed to nodetool: an uploaded temporary file or stdin
+	CredentialsTransfer string `yaml:"credentials-transfer"`
 }
 
 type CollectingSettings struct {
-	Configs       []string `yaml:"configs"`
-	Logs          []string `yaml:"logs"`
-	GCLogPatterns []string `yaml:"gc-log-patterns"`
+	Configs       []string                  `yaml:"configs"`
+	Redaction     RedactionSettings         `yaml:"redaction"`
+	Logs          []string                  `yaml:"logs"`
+	LogArchives   string                    `yaml:"log-archives"`
+	GCLogPatterns []string                  `yaml:"gc-log-patterns"`
+	NodeTool      []NodeToolCommandSettings `yaml:"nodetool"`
+	IOStats       IOStatsSettings           `yaml:"io-stats"`
+	DataInventory DataInventorySettings     `yaml:"data-inventory"`
+	SSTables      SSTableMetadataSettings   `yaml:"sstable-metadata"`
+	Maintenance   MaintenanceSettings       `yaml:"maintenance"`
+	JMX           JMXSettings               `yaml:"jmx"`
+	CQL           CQLSettings               `yaml:"cql"`
+	JVM           JVMSettings               `yaml:"jvm"`
+	OS            OSSettings                `yaml:"os"`
+	Network       NetworkSettings           `yaml:"network"`
+}
+
+type NodeToolCommandSettings struct {
+	Command string        `yaml:"command"`
+	Flags   string        `yaml:"flags,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+func (settings *NodeToolCommandSettings) String() string {
+	if len(settings.Flags) > 0 {
+		return settings.Command + " " + settings.Flags
+	}
+	return settings.Command
 }
 
 func NodeCollectorDefaultSettings() *NodeCollectorSettings {
 	return &NodeCollectorSettings{
 		Cassandra: CassandraSettings{
-			ConfigPath: "/etc/cassandra",
-			LogPath:    "/var/log/cassandra",
-			GCPath:     "/var/log/cassandra",
+			DiscoverPaths: true,
+			ConfigPath:    "/etc/cassandra",
+			LogPath:       "/var/log/cassandra",
+			GCPath:        "/var/log/cassandra",
 			DataPath: []string{
 				"/var/lib/cassandra/data",
 			},
-			Username: "",
-			Password: "",
+			CommitLogPath:       "/var/lib/cassandra/commitlog",
+			HintsPath:           "/var/lib/cassandra/hints",
+			Username:            "",
+			Password:            "",
+			PasswordFile:        "",
+			CredentialsTransfer: FileCredentialsTransfer,
 		},
 		Collecting: CollectingSettings{
 			Configs: []string{
@@ -61,12 +116,35 @@ func NodeCollectorDefaultSettings() *NodeCollectorSettings {
 				"logback.xml",
 			},
 			Logs: []string{
-				"system.log",
+				"system.log*",
+				"debug.log*",
 			},
+			LogArchives: KeepLogArchives,
+			Redaction:   RedactionDefaultSettings(),
 			GCLogPatterns: []string{
 				"gc*",
 			},
+			NodeTool: []NodeToolCommandSettings{
+				{Command: "info", Timeout: time.Minute},
+				{Command: "version", Timeout: time.Minute},
+				{Command: "status", Timeout: time.Minute},
+				{Command: "tpstats", Timeout: time.Minute},
+				{Command: "compactionstats", Flags: "-H", Timeout: time.Minute},
+				{Command: "gossipinfo", Timeout: time.Minute},
+				{Command: "cfstats", Flags: "-H", Timeout: 5 * time.Minute},
+				{Command: "ring", Timeout: time.Minute},
+			},
+			IOStats:       IOStatsDefaultSettings(),
+			DataInventory: DataInventoryDefaultSettings(),
+			SSTables:      SSTableMetadataDefaultSettings(),
+			Maintenance:   MaintenanceDefaultSettings(),
+			JMX:           JMXDefaultSettings(),
+			CQL:           CQLDefaultSettings(),
+			JVM:           JVMDefaultSettings(),
+			OS:            OSDefaultSettings(),
+			Network:       NetworkDefaultSettings(),
 		},
+		MaxConcurrentTasks: 4,
 	}
 }
 
@@ -78,12 +156,30 @@ type NodeCollector struct {
 	Logger   *logrus.Logger
 	Path     string
 
+	// Time window of the collected logs, zero leaves the side unbounded
+	TimestampFrom time.Time
+	TimestampTo   time.Time
+
 	AppFs afero.Fs
 
+	// Tasks selected by name, see TaskNames
+	Tasks TaskFilter
+	// Per task outcome of all the hosts, optional
+	Summary *CollectingSummary
+
 	log *logrus.Entry
 }
 
 func (collector *NodeCollector) Collect(agent SSHCollectingAgent) error {
+	// The nodes are collected concurrently, each one gets own logger and discovered paths
+	nodeCollector := *collector
+	nodeSettings := *collector.Settings
+	nodeCollector.Settings = &nodeSettings
+
+	return nodeCollector.collect(agent)
+}
+
+func (collector *NodeCollector) collect(agent SSHCollectingAgent) error {
 
 	log := collector.Logger.WithFields(logrus.Fields{
 		"prefix": "NC " + agent.GetHost(),
@@ -91,194 +187,186 @@ func (collector *NodeCollector) Collect(agent SSHCollectingAgent) error {
 	collector.log = log
 	log.Info("Node collector started")
 
+	tasks := collector.enabledTasks()
+	if len(tasks) == 0 {
+		log.Info("No node tasks selected")
+		return nil
+	}
+
+	summary := HostSummary{Host: agent.GetHost(), Kind: NodeHost, Tasks: make([]TaskStatus, 0)}
+	defer func() { collector.Summary.Record(summary) }()
+
 	err := agent.Connect()
 	if err != nil {
 		log.Error(err)
+		summary.Error = err.Error()
 		return err
 	}
 
-	InfoTaskCount := 4
-	var wg sync.WaitGroup
-	wg.Add(InfoTaskCount)
-
-	go func() {
-		defer wg.Done()
-
-		log.Info("Collecting nodetool info...")
-		err = collector.collectNodeToolInfo(agent)
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("Collecting nodetool info completed.")
-	}()
-
-	go func() {
-		defer wg.Done()
-
-		// TODO Hint "sudo apt install sysstat"
-		log.Info("Collecting IO stats...")
-		err = collector.collectIOStats(agent)
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("Collecting IO stats completed.")
-	}()
-
-	go func() {
-		defer wg.Done()
-
-		log.Info("Collecting disc info...")
-		err = collector.collectDiscInfo(agent)
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("Collecting disc info completed.")
-	}()
-
-	go func() {
-		defer wg.Done()
-
-		log.Info("Collecting system info...")
-		err = collector.collectSystemInfo(agent)
+	if collector.Settings.Cassandra.DiscoverPaths {
+		log.Info("Discovering Cassandra paths...")
+		collector.Settings.Cassandra, err = collector.discoverCassandraPaths(agent)
 		if err != nil {
-			log.Error(err)
+			log.Warn(err, ", using the configured paths")
 		}
-		log.Info("Collecting system info completed.")
-	}()
-
-	log.Info("Collecting configuration files...")
-	err = collector.collectConfigurationFiles(agent)
-	if err != nil {
-		log.Error(err)
+		cassandra := collector.Settings.Cassandra
+		log.Info("Cassandra paths: config '", cassandra.ConfigPath, "', logs '", cassandra.LogPath,
+			"', gc logs '", cassandra.GCPath, "', data ", cassandra.DataPath,
+			", commitlog '", cassandra.CommitLogPath, "', hints '", cassandra.HintsPath, "'")
 	}
-	log.Info("Collecting configuration files completed.")
 
-	log.Info("Collecting log files...")
-	err = collector.collectLogFiles(agent)
+	sink := &FolderSink{AppFs: collector.AppFs, Path: filepath.Join(collector.Path, agent.GetHost())}
+	statuses, err := RunTasks(tasks, collector.Settings.MaxConcurrentTasks, agent, sink, log)
 	if err != nil {
 		log.Error(err)
+		summary.Error = err.Error()
+		return err
 	}
-	log.Info("Collecting log files completed.")
+	summary.Tasks = statuses
 
-	log.Info("Collecting gc log files...")
-	err = collector.collectGCLogFiles(agent)
+	err = tasksError(statuses)
 	if err != nil {
-		log.Error(err)
+		return err
 	}
-	log.Info("Collecting gc log files completed.")
-
-	wg.Wait()
 
 	log.Info("Node collector completed")
 	return nil
 }
 
-func (collector *NodeCollector) collectConfigurationFiles(agent SSHCollectingAgent) error {
-	dest, err := collector.makeFolder(agent.GetHost(), "config")
-	if err != nil {
-		return err
+func (collector *NodeCollector) taskRegistry() *TaskRegistry {
+	registry := NewTaskRegistry()
+	// Each task runs on a copy of the collector, writing through the task sink and logging with the task logger
+	node := func(name string, run func(collector *NodeCollector, agent SSHCollectingAgent) error, dependencies ...string) {
+		registry.MustRegister(&funcTask{name: name, dependencies: dependencies,
+			run: func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+				task := *collector
+				task.AppFs = sink.Fs()
+				task.log = log
+				return run(&task, agent)
+			}})
 	}
 
-	for _, name := range collector.Settings.Collecting.Configs {
-		src := filepath.Join(collector.Settings.Cassandra.ConfigPath, name)
-		err = agent.ReceiveFile(src, dest, nil)
-		if err != nil {
-			collector.log.Warn("Failed to receive config file '" + src + "' (" + err.Error() + ")")
-		}
-	}
+	node("jmx", (*NodeCollector).collectJMXInfo)
+	node("cql", (*NodeCollector).collectCQLInfo)
+	node("jvm", (*NodeCollector).collectJVMInfo)
+	node("os", (*NodeCollector).collectOSInfo)
+	node("network", (*NodeCollector).collectNetworkInfo)
+	node("sstable-metadata", (*NodeCollector).collectSSTableMetadata)
+	node("maintenance", (*NodeCollector).collectMaintenanceInfo)
+	node("nodetool", (*NodeCollector).collectNodeToolInfo)
+	node("io-stats", (*NodeCollector).collectIOStats)
+	node("disk", (*NodeCollector).collectDiscInfo)
+	node("system", (*NodeCollector).collectSystemInfo)
+	// The file downloads go one after another
+	node("config", (*NodeCollector).collectConfigurationFiles)
+	node("logs", (*NodeCollector).collectLogFiles, "config")
+	node("gc-logs", (*NodeCollector).collectGCLogFiles, "logs")
+	node("custom", (*NodeCollector).collectCustomTasks, "gc-logs")
+
+	return registry
+}
 
-	return nil
+// TaskNames lists the node tasks, for the task selection
+func (collector *NodeCollector) TaskNames() []string {
+	return collector.taskRegistry().Names()
 }
 
-func (collector *NodeCollector) collectLogFiles(agent SSHCollectingAgent) error {
-	dest, err := collector.makeFolder(agent.GetHost(), "logs")
-	if err != nil {
-		return err
+// enabledTasks returns the tasks selected by name and enabled in the settings
+func (collector *NodeCollector) enabledTasks() []Task {
+	collecting := &collector.Settings.Collecting
+	disabled := map[string]bool{
+		"jmx":              !collecting.JMX.Enabled,
+		"cql":              !collecting.CQL.Enabled,
+		"jvm":              !collecting.JVM.Enabled,
+		"os":               !collecting.OS.Enabled,
+		"network":          !collecting.Network.Enabled,
+		"sstable-metadata": !collecting.SSTables.Enabled,
+		"maintenance":      !collecting.Maintenance.Enabled,
+		"custom":           len(collector.Settings.CustomTasks) == 0,
 	}
 
-	for _, name := range collector.Settings.Collecting.Logs {
-		src := filepath.Join(collector.Settings.Cassandra.LogPath, name)
-		err = agent.ReceiveFile(src, dest, func(copied int64, size int64, remaining time.Duration) {
-			collector.log.Info("Downloading '", name, "' log file ",
-				HumanSize(float64(copied)), " of ", HumanSize(float64(size)),
-				" (remaining ", remaining.Round(time.Second), ") ...")
-		})
-		if err != nil {
-			collector.log.Warn("Failed to receive log file '" + src + "' (" + err.Error() + ")")
+	tasks := make([]Task, 0)
+	for _, task := range collector.taskRegistry().Select(collector.Tasks) {
+		if !disabled[task.Name()] {
+			tasks = append(tasks, task)
 		}
 	}
-
-	return nil
+	return tasks
 }
 
-func (collector *NodeCollector) collectGCLogFiles(agent SSHCollectingAgent) error {
-	dest, err := collector.makeFolder(agent.GetHost(), "gc_logs")
+func (collector *NodeCollector) collectConfigurationFiles(agent SSHCollectingAgent) error {
+	dest, err := collector.makeFolder(agent.GetHost(), "config")
 	if err != nil {
 		return err
 	}
 
-	entries, err := agent.ListDirectory(collector.Settings.Cassandra.GCPath)
-	if err != nil {
-		return errors.New("Failed to check GC log directory (" + err.Error() + ")")
-	}
+	// Files are redacted in memory, secrets never reach the disk
+	redaction := collector.Settings.Collecting.Redaction.Enabled
+	findings := make([]redactionFinding, 0)
 
-	for _, entry := range entries {
-		if entry.IdDir {
+	for _, name := range collector.Settings.Collecting.Configs {
+		src := filepath.Join(collector.Settings.Cassandra.ConfigPath, name)
+		content, err := agent.GetContent(src)
+		if err != nil {
+			collector.log.Warn("Failed to receive config file '" + src + "' (" + err.Error() + ")")
 			continue
 		}
 
-		for _, pattern := range collector.Settings.Collecting.GCLogPatterns {
-			filename := filepath.Base(entry.Path)
-			match, err := filepath.Match(pattern, filename)
-			if err != nil {
-				collector.log.Warn("Failed to check GC log '" + entry.Path + " pattern  '" + pattern +
-					"' matching ' (" + err.Error() + ")")
-			}
+		data := content.Bytes()
+		if redaction {
+			var fileFindings []redactionFinding
+			data, fileFindings = collector.redact(filepath.Base(name), data)
+			findings = append(findings, fileFindings...)
+		}
 
-			if match == true {
-				err := agent.ReceiveFile(entry.Path, dest, func(copied int64, size int64, remaining time.Duration) {
-					collector.log.Info("Downloading '", filename, "' GC log file ",
-						HumanSize(float64(copied)), " of ", HumanSize(float64(size)),
-						" (remaining ", remaining.Round(time.Second), ") ...")
-				})
-				if err != nil {
-					collector.log.Warn("Failed to receive GC log file (" + err.Error() + ")")
-				}
-			}
+		err = afero.WriteFile(collector.AppFs, filepath.Join(dest, filepath.Base(name)), data, os.ModePerm)
+		if err != nil {
+			collector.log.Warn("Failed to save config file '" + src + "' (" + err.Error() + ")")
 		}
 	}
 
+	if redaction {
+		if len(findings) > 0 {
+			collector.log.Info("Redacted ", len(findings), " secrets in config files")
+		}
+		return collector.saveRedactionReport(dest, findings)
+	}
+
 	return nil
 }
 
 func (collector *NodeCollector) collectNodeToolInfo(agent SSHCollectingAgent) error {
-	commands := [...]string{
-		"info",
-		"version",
-		"status",
-		"tpstats",
-		"compactionstats -H",
-		"gossipinfo",
-		"cfstats -H",
-		"ring",
+	path, err := collector.makeFolder(agent.GetHost(), "info")
+	if err != nil {
+		return err
 	}
 
-	path, err := collector.makeFolder(agent.GetHost(), "info")
+	return collector.runNodeToolCommands(agent, collector.Settings.Collecting.NodeTool, path)
+}
+
+// runNodeToolCommands saves the output of each command to <path>/<command>_<flags>.info
+func (collector *NodeCollector) runNodeToolCommands(agent SSHCollectingAgent, commands []NodeToolCommandSettings,
+	path string) error {
+	credentials, err := collector.prepareNodeToolCredentials(agent)
 	if err != nil {
 		return err
 	}
+	defer collector.cleanupNodeToolCredentials(agent, credentials)
+
+	for _, settings := range commands {
+		command := settings.String()
 
-	for _, command := range commands {
 		var args = strings.Builder{}
 		args.WriteString("nodetool ")
-		if len(collector.Settings.Cassandra.Username) > 0 {
-			fmt.Fprintf(&args, "-u '%s' ", collector.Settings.Cassandra.Username)
-		}
-		if len(collector.Settings.Cassandra.Password) > 0 {
-			fmt.Fprintf(&args, "-pw '%s' ", collector.Settings.Cassandra.Password)
-		}
+		args.WriteString(credentials.args)
 		args.WriteString(command)
-		sout, _, err := agent.ExecuteCommand(args.String())
+
+		var sout *bytes.Buffer
+		if credentials.input != nil {
+			sout, _, err = agent.ExecuteCommandWithInput(withTimeout(args.String(), settings.Timeout), credentials.input)
+		} else {
+			sout, _, err = agent.ExecuteCommand(withTimeout(args.String(), settings.Timeout))
+		}
 		if err != nil {
 			collector.log.Error("Failed to execute '" + command + "' (" + err.Error() + ")")
 			continue
@@ -295,32 +383,82 @@ func (collector *NodeCollector) collectNodeToolInfo(agent SSHCollectingAgent) er
 	return nil
 }
 
-func (collector *NodeCollector) collectIOStats(agent SSHCollectingAgent) error {
-	const command = "eval timeout -sHUP 60s iostat -x -m -t -y -z 30 < /dev/null"
+type nodeToolCredentials struct {
+	args  string
+	input []byte
+	file  string
+}
 
-	path, err := collector.makeFolder(agent.GetHost(), "info")
-	if err != nil {
-		return err
+// prepareNodeToolCredentials builds the nodetool authentication arguments,
+// the password is never put on the remote command line.
+func (collector *NodeCollector) prepareNodeToolCredentials(agent SSHCollectingAgent) (*nodeToolCredentials, error) {
+	settings := &collector.Settings.Cassandra
+	credentials := &nodeToolCredentials{}
+
+	var args = strings.Builder{}
+	if len(settings.Username) > 0 {
+		fmt.Fprintf(&args, "-u %s ", ShellQuote(settings.Username))
+	}
+
+	if len(settings.PasswordFile) > 0 {
+		fmt.Fprintf(&args, "-pwf %s ", ShellQuote(settings.PasswordFile))
+	} else if len(settings.Password) > 0 {
+		content := []byte(settings.Username + " " + settings.Password + "\n")
+
+		switch settings.CredentialsTransfer {
+		case "", FileCredentialsTransfer:
+			file, err := collector.uploadCredentialsFile(agent, content)
+			if err != nil {
+				return nil, err
+			}
+			credentials.file = file
+			fmt.Fprintf(&args, "-pwf %s ", ShellQuote(file))
+		case StdinCredentialsTransfer:
+			credentials.input = content
+			args.WriteString("-pwf /dev/stdin ")
+		default:
+			return nil, errors.New("Unsupported credentials transfer '" + settings.CredentialsTransfer + "'")
+		}
 	}
 
-	sout, _, err := agent.ExecuteCommand(command)
+	credentials.args = args.String()
+	return credentials, nil
+}
+
+func (collector *NodeCollector) uploadCredentialsFile(agent SSHCollectingAgent, content []byte) (string, error) {
+	sout, _, err := agent.ExecuteCommand(createCredentialsFileCommand)
 	if err != nil {
-		// TODO Check if returned 124 status code
-		//return errors.New("Failed to execute '" + command + "' (" + err.Error() + ")")
+		return "", errors.New("Failed to create credentials file (" + err.Error() + ")")
 	}
 
-	err = afero.WriteFile(collector.AppFs, filepath.Join(path, "io_stat.info"), sout.Bytes(), os.ModePerm)
+	file := strings.TrimSpace(sout.String())
+	err = agent.PutContent(file, content, credentialsFileMode)
 	if err != nil {
-		return errors.New("Failed to save iostate info (" + err.Error() + ")")
+		removeErr := agent.Remove(file)
+		if removeErr != nil {
+			collector.log.Warn("Failed to remove credentials file '" + file + "' (" + removeErr.Error() + ")")
+		}
+		return "", errors.New("Failed to upload credentials file (" + err.Error() + ")")
 	}
 
-	return nil
+	return file, nil
+}
+
+func (collector *NodeCollector) cleanupNodeToolCredentials(agent SSHCollectingAgent, credentials *nodeToolCredentials) {
+	if len(credentials.file) == 0 {
+		return
+	}
+
+	err := agent.Remove(credentials.file)
+	if err != nil {
+		collector.log.Error("Failed to remove credentials file '" + credentials.file + "' (" + err.Error() + ")")
+	}
 }
 
 func (collector *NodeCollector) collectDiscInfo(agent SSHCollectingAgent) error {
+	// du walks the whole data, the inventory replaces it
 	commands := [...]string{
 		"df -h",
-		"du -h",
 	}
 
 	path, err := collector.makeFolder(agent.GetHost(), "info")
@@ -328,11 +466,18 @@ func (collector *NodeCollector) collectDiscInfo(agent SSHCollectingAgent) error
 		return err
 	}
 
+	settings := &collector.Settings.Cassandra
+	paths := append(append([]string{}, settings.DataPath...), settings.CommitLogPath, settings.HintsPath)
+
 	var report bytes.Buffer
 
 	for _, command := range commands {
-		for _, dataPath := range collector.Settings.Cassandra.DataPath {
-			command := fmt.Sprintf("%s %s", command, dataPath)
+		for _, dataPath := range paths {
+			if len(dataPath) == 0 {
+				continue
+			}
+
+			command := fmt.Sprintf("%s %s", command, ShellQuote(dataPath))
 
 			sout, _, err := agent.ExecuteCommand(command)
 			if err != nil {
@@ -351,6 +496,10 @@ func (collector *NodeCollector) collectDiscInfo(agent SSHCollectingAgent) error
 		return errors.New("Failed to save disk info (" + err.Error() + ")")
 	}
 
+	if collector.Settings.Collecting.DataInventory.Enabled {
+		return collector.collectDataInventory(agent, path)
+	}
+
 	return nil
 }
 
@@ -383,6 +532,15 @@ func (collector *NodeCollector) collectSystemInfo(agent SSHCollectingAgent) erro
 	return nil
 }
 
+// withTimeout bounds the remote command execution time, zero timeout leaves the command unbounded.
+// The timeout is rounded up to whole seconds, "timeout 0s" would not bound the command at all.
+func withTimeout(command string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return command
+	}
+	return fmt.Sprintf(timeoutCommandTemplate, int64(math.Ceil(timeout.Seconds())), command)
+}
+
 func (collector *NodeCollector) makeFolder(host string, name string) (string, error) {
 	path := filepath.Join(collector.Path, host, name)
 	err := collector.AppFs.MkdirAll(path, os.ModePerm)
@@ -1,38 +1,58 @@
 package collector
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
-const collectNodeToolInfoCommand = "nodetool info"
-const collectNodeToolVersionCommand = "nodetool version"
-const collectNodeToolStatusCommand = "nodetool status"
-const collectNodeToolTpstatsCommand = "nodetool tpstats"
-const collectNodeToolCompactionstatsCommand = "nodetool compactionstats -H"
-const collectNodeToolGossipinfoCommand = "nodetool gossipinfo"
-const collectNodeToolCfstatsCommand = "nodetool cfstats -H"
-const collectNodeToolRingCommand = "nodetool ring"
-
-const collectIOStatsCommand = "eval timeout -sHUP 60s iostat -x -m -t -y -z 30 < /dev/null"
+const collectNodeToolInfoCommand = "timeout 60s nodetool info"
+const collectNodeToolVersionCommand = "timeout 60s nodetool version"
+const collectNodeToolStatusCommand = "timeout 60s nodetool status"
+const collectNodeToolTpstatsCommand = "timeout 60s nodetool tpstats"
+const collectNodeToolCompactionstatsCommand = "timeout 60s nodetool compactionstats -H"
+const collectNodeToolGossipinfoCommand = "timeout 60s nodetool gossipinfo"
+const collectNodeToolCfstatsCommand = "timeout 300s nodetool cfstats -H"
+const collectNodeToolRingCommand = "timeout 60s nodetool ring"
+const collectNodeToolNetstatsCommand = "timeout 60s nodetool netstats"
+const collectNodeToolCompactionHistoryCommand = "timeout 300s nodetool compactionhistory"
+
+const collectIOStatsCommand = "timeout 60s sh -c 'for i in $(seq 0 6); do echo \"@sample $(date +%s.%N)\"; " +
+	"cat /proc/stat /proc/diskstats; if [ $i -lt 6 ]; then sleep 5; fi; done'"
+
+var collectDiscInfoCommands = []string{
+	"df -h /var/lib/cassandra/data",
+	"df -h /var/lib/cassandra/commitlog",
+	"df -h /var/lib/cassandra/hints",
+	collectDataInventoryCommand,
+}
 
-const collectDiscInfo1Command = "df -h /var/lib/cassandra/data"
-const collectDiscInfo2Command = "du -h /var/lib/cassandra/data"
+const collectDataInventoryCommand = "timeout 300s sh -c 'if command -v ionice >/dev/null 2>&1; then io='\"'\"'ionice -c3'\"'\"'; fi; " +
+	"$io nice -n 19 find /var/lib/cassandra/data -mindepth 1 -maxdepth 5 -type f -printf '\"'\"'%s %P\\n'\"'\"''"
 
 const collectSystemInfoFreeCommand = "free -m"
 const collectSystemInfoUlimitCommand = "ulimit -a"
 
+const collectCQLAddress = "127.0.0.1:9042"
+
+const collectNetworkSocketsCommand = "timeout 60s ss -tanp '( sport = :7000 or dport = :7000 or sport = :7001 or dport = :7001 or sport = :9042 or dport = :9042 or sport = :7199 or dport = :7199 )'"
+const collectNetworkInterfacesCommand = "timeout 60s ip -s -s link"
+
 var gcLogs = []FileInfo{
-	{"/var/log/cassandra/system.log", false},
-	{"/var/log/cassandra/gc.log.2", false},
-	{"/var/log/cassandra/gc.log.0", false},
-	{"/var/log/cassandra/gc.log.3.current", false},
-	{"/var/log/cassandra/gc.log.1", false},
+	{Path: "/var/log/cassandra/system.log", IdDir: false},
+	{Path: "/var/log/cassandra/gc.log.2", IdDir: false},
+	{Path: "/var/log/cassandra/gc.log.0", IdDir: false},
+	{Path: "/var/log/cassandra/gc.log.3.current", IdDir: false},
+	{Path: "/var/log/cassandra/gc.log.1", IdDir: false},
 }
 
 func TestNodeCollector_Collect(t *testing.T) {
@@ -65,18 +85,42 @@ func TestNodeCollector_Collect(t *testing.T) {
 	mockedSSHAgent.
 		On("ExecuteCommand", collectNodeToolRingCommand).
 		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", collectNodeToolNetstatsCommand).
+		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", collectNodeToolCompactionHistoryCommand).
+		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
 
 	mockedSSHAgent.
 		On("ExecuteCommand", collectIOStatsCommand).
 		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
 
 	mockedSSHAgent.
-		On("ExecuteCommand", collectDiscInfo1Command).
+		On("Dial", "tcp", collectCQLAddress).
+		Return(nil, errors.New("connect failed"))
+
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), errors.New("ps failed"))
+	mockedSSHAgent.
+		On("ExecuteCommand", collectNetworkSocketsCommand).
+		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", collectNetworkInterfacesCommand).
 		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
 	mockedSSHAgent.
-		On("ExecuteCommand", collectDiscInfo2Command).
+		On("ExecuteCommand", mock.MatchedBy(func(command string) bool {
+			return strings.HasPrefix(command, "timeout 60s sh -c ")
+		})).
 		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
 
+	for _, command := range collectDiscInfoCommands {
+		mockedSSHAgent.
+			On("ExecuteCommand", command).
+			Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+	}
+
 	mockedSSHAgent.
 		On("ExecuteCommand", collectSystemInfoFreeCommand).
 		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
@@ -85,21 +129,17 @@ func TestNodeCollector_Collect(t *testing.T) {
 		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
 
 	mockedSSHAgent.
-		On("ReceiveFile",
-			"/etc/cassandra/cassandra.yaml", "some/path/node-test-host-1/config", mock.AnythingOfType("collector.ProgressFunc")).
-		Return(nil)
+		On("GetContent", "/etc/cassandra/cassandra.yaml").
+		Return(bytes.NewBufferString("some data"), nil)
 	mockedSSHAgent.
-		On("ReceiveFile",
-			"/etc/cassandra/cassandra-env.sh", "some/path/node-test-host-1/config", mock.AnythingOfType("collector.ProgressFunc")).
-		Return(nil)
+		On("GetContent", "/etc/cassandra/cassandra-env.sh").
+		Return(bytes.NewBufferString("some data"), nil)
 	mockedSSHAgent.
-		On("ReceiveFile",
-			"/etc/cassandra/jvm.options", "some/path/node-test-host-1/config", mock.AnythingOfType("collector.ProgressFunc")).
-		Return(nil)
+		On("GetContent", "/etc/cassandra/jvm.options").
+		Return(bytes.NewBufferString("some data"), nil)
 	mockedSSHAgent.
-		On("ReceiveFile",
-			"/etc/cassandra/logback.xml", "some/path/node-test-host-1/config", mock.AnythingOfType("collector.ProgressFunc")).
-		Return(nil)
+		On("GetContent", "/etc/cassandra/logback.xml").
+		Return(bytes.NewBufferString("some data"), nil)
 	mockedSSHAgent.
 		On("ReceiveFile",
 			"/var/log/cassandra/system.log", "some/path/node-test-host-1/logs", mock.AnythingOfType("collector.ProgressFunc")).
@@ -132,15 +172,17 @@ func TestNodeCollector_Collect(t *testing.T) {
 		Logger:   logger,
 		Path:     "some/path",
 		AppFs:    afero.NewMemMapFs(),
+		Summary:  &CollectingSummary{},
 	}
 
+	// CQL can't connect and the IO samples can't be parsed, the rest is collected
 	err := collector.Collect(mockedSSHAgent)
-	if err != nil {
-		t.Errorf("Failed: %v", err)
-	}
+	assert.EqualError(t, err, "Failed tasks cql, io-stats")
 
 	mockedSSHAgent.AssertExpectations(t)
 
+	assert.Equal(t, []string{"node-test-host-1/cql"}, collector.Summary.RequiredFailures([]string{"cql", "nodetool"}))
+
 	hook.Reset()
 }
 
@@ -172,28 +214,175 @@ func TestNodeCollector_Collect_OnFailedToConnect(t *testing.T) {
 	hook.Reset()
 }
 
+func TestNodeCollector_Collect_SelectedTasks(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.On("Connect").Return(nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), errors.New("ps failed"))
+	mockedSSHAgent.
+		On("ExecuteCommand", collectSystemInfoFreeCommand).
+		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", collectSystemInfoUlimitCommand).
+		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.CustomTasks = []CustomTaskSettings{{Name: "date", Command: "date", Fatal: true}}
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+		Tasks:    TaskFilter{Only: []string{"system", "jmx", "custom"}, Skip: []string{"custom"}},
+	}
+
+	// jmx is disabled in the settings, custom is skipped
+	err := collector.Collect(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	mockedSSHAgent.AssertExpectations(t)
+	assert.Contains(t, collector.TaskNames(), "sstable-metadata")
+
+	hook.Reset()
+}
+
+func TestNodeCollector_Collect_NoTasks(t *testing.T) {
+
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+
+	logger, hook := test.NewNullLogger()
+
+	collector := NodeCollector{
+		Settings: NodeCollectorDefaultSettings(),
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+		Tasks:    TaskFilter{Only: []string{"metrics"}},
+	}
+
+	err := collector.Collect(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	mockedSSHAgent.AssertNotCalled(t, "Connect")
+
+	hook.Reset()
+}
+
 func TestNodeCollector_collectDiscInfo(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	for _, command := range collectDiscInfoCommands {
+		mockedSSHAgent.
+			On("ExecuteCommand", command).
+			Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+	}
+
+	logger, hook := test.NewNullLogger()
+
+	collector := NodeCollector{
+		Settings: NodeCollectorDefaultSettings(),
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+	}
+
+	err := collector.collectDiscInfo(mockedSSHAgent)
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectNodeToolInfo(t *testing.T) {
 	mockedSSHAgent := new(mockedSSHAgentObject)
 	mockedSSHAgent.
 		On("GetHost").
 		Return("node-test-host-1")
 	mockedSSHAgent.
-		On("ExecuteCommand", collectDiscInfo1Command).
+		On("ExecuteCommand", "timeout 120s nodetool tablehistograms keyspace1 table1").
 		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
 	mockedSSHAgent.
-		On("ExecuteCommand", collectDiscInfo2Command).
+		On("ExecuteCommand", "nodetool describecluster").
 		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
 
 	logger, hook := test.NewNullLogger()
 
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.NodeTool = []NodeToolCommandSettings{
+		{Command: "tablehistograms", Flags: "keyspace1 table1", Timeout: 2 * time.Minute},
+		{Command: "describecluster"},
+	}
+
+	appFs := afero.NewMemMapFs()
 	collector := NodeCollector{
-		Settings: NodeCollectorDefaultSettings(),
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+	}
+
+	err := collector.collectNodeToolInfo(mockedSSHAgent)
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	}
+
+	exists, _ := afero.Exists(appFs, "some/path/node-test-host-1/info/tablehistograms_keyspace1_table1.info")
+	assert.True(t, exists)
+	exists, _ = afero.Exists(appFs, "some/path/node-test-host-1/info/describecluster.info")
+	assert.True(t, exists)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectNodeToolInfoWithCredentialsFile(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "mktemp").
+		Return(bytes.NewBufferString("/tmp/tmp.Xa1b2c3\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("PutContent", "/tmp/tmp.Xa1b2c3", []byte("cassandra pa'ss word\n"), os.FileMode(0600)).
+		Return(nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s nodetool -u cassandra -pwf /tmp/tmp.Xa1b2c3 status").
+		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("Remove", "/tmp/tmp.Xa1b2c3").
+		Return(nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Cassandra.Username = "cassandra"
+	settings.Cassandra.Password = "pa'ss word"
+	settings.Collecting.NodeTool = []NodeToolCommandSettings{
+		{Command: "status", Timeout: time.Minute},
+	}
+
+	collector := NodeCollector{
+		Settings: settings,
 		Logger:   logger,
 		Path:     "some/path",
 		AppFs:    afero.NewMemMapFs(),
 	}
 
-	err := collector.collectDiscInfo(mockedSSHAgent)
+	err := collector.collectNodeToolInfo(mockedSSHAgent)
 	if err != nil {
 		t.Errorf("Failed: %v", err)
 	}
@@ -202,3 +391,218 @@ func TestNodeCollector_collectDiscInfo(t *testing.T) {
 
 	hook.Reset()
 }
+
+func TestNodeCollector_collectNodeToolInfoWithCredentialsStdin(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommandWithInput", "timeout 60s nodetool -u 'jmx user' -pwf /dev/stdin status", []byte("jmx user secret\n")).
+		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Cassandra.Username = "jmx user"
+	settings.Cassandra.Password = "secret"
+	settings.Cassandra.CredentialsTransfer = StdinCredentialsTransfer
+	settings.Collecting.NodeTool = []NodeToolCommandSettings{
+		{Command: "status", Timeout: time.Minute},
+	}
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+	}
+
+	err := collector.collectNodeToolInfo(mockedSSHAgent)
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectNodeToolInfoWithPasswordFile(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s nodetool -u cassandra -pwf /etc/cassandra/jmxremote.password status").
+		Return(bytes.NewBufferString("some data"), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Cassandra.Username = "cassandra"
+	settings.Cassandra.Password = "ignored"
+	settings.Cassandra.PasswordFile = "/etc/cassandra/jmxremote.password"
+	settings.Collecting.NodeTool = []NodeToolCommandSettings{
+		{Command: "status", Timeout: time.Minute},
+	}
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+	}
+
+	err := collector.collectNodeToolInfo(mockedSSHAgent)
+	if err != nil {
+		t.Errorf("Failed: %v", err)
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectJMXInfoOnFailedToConnect(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("Dial", "tcp", "127.0.0.1:7199").
+		Return(nil, errors.New("connect failed"))
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.JMX.Enabled = true
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+	}
+
+	err := collector.collectJMXInfo(mockedSSHAgent)
+	assert.EqualError(t, err, "Failed to connect JMX at '127.0.0.1:7199' (connect failed)")
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectCQLInfoOnFailedToConnect(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("Dial", "tcp", collectCQLAddress).
+		Return(nil, errors.New("connect failed"))
+
+	logger, hook := test.NewNullLogger()
+
+	collector := NodeCollector{
+		Settings: NodeCollectorDefaultSettings(),
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectCQLInfo(mockedSSHAgent)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Failed to connect CQL at '127.0.0.1:9042'")
+		assert.Contains(t, err.Error(), "connect failed")
+	}
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectLogFiles(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ListDirectory", "/var/log/cassandra").
+		Return([]FileInfo{
+			{Path: "/var/log/cassandra/system.log", IdDir: false},
+			{Path: "/var/log/cassandra/system.log.1.zip", IdDir: false},
+			{Path: "/var/log/cassandra/debug.log.2.gz", IdDir: false},
+			{Path: "/var/log/cassandra/gc.log.0", IdDir: false},
+			{Path: "/var/log/cassandra/system.log.d", IdDir: true},
+		}, nil)
+
+	appFs := afero.NewMemMapFs()
+
+	mockedSSHAgent.
+		On("ReceiveFile",
+			"/var/log/cassandra/system.log", "some/path/node-test-host-1/logs", mock.AnythingOfType("collector.ProgressFunc")).
+		Return(nil)
+	mockedSSHAgent.
+		On("ReceiveFile",
+			"/var/log/cassandra/system.log.1.zip", "some/path/node-test-host-1/logs", mock.AnythingOfType("collector.ProgressFunc")).
+		Run(func(args mock.Arguments) {
+			var archive bytes.Buffer
+			writer := zip.NewWriter(&archive)
+			entry, _ := writer.Create("system.log.1")
+			_, _ = entry.Write([]byte("rotated zip"))
+			_ = writer.Close()
+			_ = afero.WriteFile(appFs, "some/path/node-test-host-1/logs/system.log.1.zip", archive.Bytes(), os.ModePerm)
+		}).
+		Return(nil)
+	mockedSSHAgent.
+		On("ReceiveFile",
+			"/var/log/cassandra/debug.log.2.gz", "some/path/node-test-host-1/logs", mock.AnythingOfType("collector.ProgressFunc")).
+		Run(func(args mock.Arguments) {
+			var archive bytes.Buffer
+			writer := gzip.NewWriter(&archive)
+			_, _ = writer.Write([]byte("rotated gzip"))
+			_ = writer.Close()
+			_ = afero.WriteFile(appFs, "some/path/node-test-host-1/logs/debug.log.2.gz", archive.Bytes(), os.ModePerm)
+		}).
+		Return(nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.LogArchives = DecompressLogArchives
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectLogFiles(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	content, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/logs/system.log.1")
+	assert.Equal(t, "rotated zip", string(content))
+	content, _ = afero.ReadFile(appFs, "some/path/node-test-host-1/logs/debug.log.2")
+	assert.Equal(t, "rotated gzip", string(content))
+
+	exists, _ := afero.Exists(appFs, "some/path/node-test-host-1/logs/system.log.1.zip")
+	assert.False(t, exists)
+	exists, _ = afero.Exists(appFs, "some/path/node-test-host-1/logs/debug.log.2.gz")
+	assert.False(t, exists)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestWithTimeout(t *testing.T) {
+	assert.Equal(t, "nodetool info", withTimeout("nodetool info", 0))
+	assert.Equal(t, "timeout 60s nodetool info", withTimeout("nodetool info", time.Minute))
+	// Rounded up, timeout 0s would leave the command unbounded
+	assert.Equal(t, "timeout 1s nodetool info", withTimeout("nodetool info", 500*time.Millisecond))
+	assert.Equal(t, "timeout 2s nodetool info", withTimeout("nodetool info", 1500*time.Millisecond))
+}
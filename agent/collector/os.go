@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+const processIdPlaceholder = "{pid}"
+const shellCommandTemplate = "sh -c "
+
+/*
+Settings
+*/
+type OSSettings struct {
+	Enabled  bool                `yaml:"enabled"`
+	Timeout  time.Duration       `yaml:"timeout"`
+	Commands []OSCommandSettings `yaml:"commands"`
+}
+
+type OSCommandSettings struct {
+	// Output file name, os/<name>.txt
+	Name string `yaml:"name"`
+	// Shell command, {pid} is replaced with the Cassandra process id
+	Command string `yaml:"command"`
+}
+
+func OSDefaultSettings() OSSettings {
+	return OSSettings{
+		Enabled: true,
+		Timeout: time.Minute,
+		Commands: []OSCommandSettings{
+			{Name: "uname", Command: "uname -a"},
+			{Name: "os_release", Command: "cat /etc/os-release"},
+			{Name: "sysctl", Command: "sysctl -a 2>/dev/null"},
+			{Name: "transparent_hugepage", Command: "grep -H . /sys/kernel/mm/transparent_hugepage/enabled /sys/kernel/mm/transparent_hugepage/defrag"},
+			{Name: "lsblk", Command: "lsblk -o NAME,TYPE,SIZE,ROTA,RA,SCHED,FSTYPE,MOUNTPOINT"},
+			{Name: "block_queues", Command: "grep -H . /sys/block/*/queue/scheduler /sys/block/*/queue/read_ahead_kb /sys/block/*/queue/rotational"},
+			{Name: "cpuinfo", Command: "cat /proc/cpuinfo"},
+			{Name: "lscpu", Command: "lscpu"},
+			{Name: "numa", Command: "numactl --hardware"},
+			{Name: "dmesg_errors", Command: "dmesg -T | grep -iE 'out of memory|oom|killed process|i/o error|blk_update_request|medium error|ext4-fs error|xfs.*error' || true"},
+			{Name: "clock", Command: "timedatectl; chronyc tracking 2>/dev/null || ntpq -pn 2>/dev/null || true"},
+			{Name: "mounts", Command: "cat /proc/mounts"},
+			{Name: "swaps", Command: "cat /proc/swaps"},
+			{Name: "process_limits", Command: "cat /proc/" + processIdPlaceholder + "/limits"},
+		},
+	}
+}
+
+/*
+Collector
+*/
+func (collector *NodeCollector) collectOSInfo(agent SSHCollectingAgent) error {
+	settings := collector.Settings.Collecting.OS
+
+	dest, err := collector.makeFolder(agent.GetHost(), "os")
+	if err != nil {
+		return err
+	}
+
+	// Looked up only when a command needs it
+	var process *javaProcess
+	var processErr error
+
+	for _, command := range settings.Commands {
+		line := command.Command
+		if strings.Contains(line, processIdPlaceholder) {
+			if process == nil && processErr == nil {
+				process, processErr = collector.findJavaProcess(agent)
+			}
+			if processErr != nil {
+				collector.log.Warn("Skipped '" + command.Name + "' (" + processErr.Error() + ")")
+				continue
+			}
+			line = strings.ReplaceAll(line, processIdPlaceholder, strconv.Itoa(process.pid))
+		}
+
+		// The shell keeps the pipelines and lists bounded by the timeout as a whole
+		sout, _, err := agent.ExecuteCommand(withTimeout(shellCommandTemplate+ShellQuote(line), settings.Timeout))
+		if err != nil {
+			collector.log.Error("Failed to execute '" + line + "' (" + err.Error() + ")")
+			continue
+		}
+
+		err = afero.WriteFile(collector.AppFs, filepath.Join(dest, command.Name+".txt"), sout.Bytes(), os.ModePerm)
+		if err != nil {
+			collector.log.Error("Failed to save '" + command.Name + "' data (" + err.Error() + ")")
+		}
+	}
+
+	return nil
+}
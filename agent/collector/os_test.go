@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNodeCollector_collectOSInfo(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString(listProcessesOutput), bytes.NewBufferString(""), nil).
+		Once()
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 30s sh -c 'cat /proc/2345/limits'").
+		Return(bytes.NewBufferString("Max open files  100000  100000  files\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 30s sh -c 'grep -H . /sys/block/*/queue/scheduler'").
+		Return(bytes.NewBufferString("/sys/block/sda/queue/scheduler:[mq-deadline] none\n"), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 30s sh -c 'numactl --hardware'").
+		Return(bytes.NewBufferString(""), bytes.NewBufferString(""), errors.New("command not found"))
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.OS.Timeout = 30 * time.Second
+	settings.Collecting.OS.Commands = []OSCommandSettings{
+		{Name: "process_limits", Command: "cat /proc/{pid}/limits"},
+		{Name: "schedulers", Command: "grep -H . /sys/block/*/queue/scheduler"},
+		{Name: "numa", Command: "numactl --hardware"},
+		{Name: "process_threads", Command: "grep -i threads /proc/{pid}/status"},
+	}
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 30s sh -c 'grep -i threads /proc/2345/status'").
+		Return(bytes.NewBufferString("Threads: 300\n"), bytes.NewBufferString(""), nil)
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectOSInfo(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	data, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/os/process_limits.txt")
+	assert.Equal(t, "Max open files  100000  100000  files\n", string(data))
+	data, _ = afero.ReadFile(appFs, "some/path/node-test-host-1/os/schedulers.txt")
+	assert.Equal(t, "/sys/block/sda/queue/scheduler:[mq-deadline] none\n", string(data))
+	exists, _ := afero.Exists(appFs, "some/path/node-test-host-1/os/numa.txt")
+	assert.False(t, exists)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectOSInfoOnProcessNotFound(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", "ps -eo pid=,user:64=,args=").
+		Return(bytes.NewBufferString("    1 root     /sbin/init\n"), bytes.NewBufferString(""), nil).
+		Once()
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s sh -c 'uname -a'").
+		Return(bytes.NewBufferString("Linux node 5.4.0\n"), bytes.NewBufferString(""), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.OS.Commands = []OSCommandSettings{
+		{Name: "process_limits", Command: "cat /proc/{pid}/limits"},
+		{Name: "uname", Command: "uname -a"},
+		{Name: "process_status", Command: "cat /proc/{pid}/status"},
+	}
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    afero.NewMemMapFs(),
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectOSInfo(mockedSSHAgent)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(hook.Entries))
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+/*
+Constants
+*/
+const redactedValue = "<redacted>"
+const redactionReportFileName = "redaction.json"
+const redactionSecretGroup = "secret"
+
+// Built-in rules, the "secret" group is redacted (the whole match without it)
+var builtinRedactionRules = []RedactionRuleSettings{
+	{
+		// cassandra.yaml keys like keystore_password, truststore_password or LDAP admin_password
+		Name:    "yaml-secret",
+		Pattern: `(?im)^\s*[\w.-]*(?:password|passwd|secret|passphrase)[\w.-]*\s*:[ \t]*(?P<secret>[^\s#][^#\r\n]*?)[ \t]*(?:#.*)?$`,
+	},
+	{
+		// JVM options like -Djavax.net.ssl.keyStorePassword or -Dcom.sun.management.jmxremote.password.file
+		Name:    "jvm-secret-property",
+		Pattern: `(?i)-D[\w.-]*(?:password|passwd|secret|passphrase)[\w.-]*=(?P<secret>"[^"]*"|'[^']*'|[^\s"']+)`,
+	},
+	{
+		// Shell variables like JMX_PASSWORD in cassandra-env.sh
+		Name:    "shell-secret-variable",
+		Pattern: `(?im)^\s*(?:export\s+)?\w*(?:PASSWORD|PASSWD|SECRET|PASSPHRASE)\w*=(?P<secret>"[^"]*"|'[^']*'|\S+)`,
+	},
+	{
+		// Java properties like javax.net.ssl.keyStorePassword=... in the jcmd VM.system_properties output
+		Name:    "properties-secret",
+		Pattern: `(?im)^[ \t]*[a-z][\w.-]*(?:password|passwd|secret|passphrase)[\w.-]*[ \t]*=[ \t]*(?P<secret>\S+)`,
+	},
+	{
+		// Name and value rows like server_encryption_options_keystore_password of the system_views.settings table
+		Name:    "json-secret-setting",
+		Files:   "*.json",
+		Pattern: `(?i)"name":\s*"[\w.-]*(?:password|passwd|secret|passphrase)[\w.-]*",\s*"value":\s*"(?P<secret>(?:[^"\\]|\\.)+)"`,
+	},
+}
+
+/*
+Settings
+*/
+type RedactionSettings struct {
+	Enabled bool                    `yaml:"enabled"`
+	Rules   []RedactionRuleSettings `yaml:"rules"`
+}
+
+// User-defined rule, the match or its "secret" named group is replaced, files is a file name pattern (all when empty)
+type RedactionRuleSettings struct {
+	Name    string `yaml:"name"`
+	Files   string `yaml:"files,omitempty"`
+	Pattern string `yaml:"pattern"`
+}
+
+func RedactionDefaultSettings() RedactionSettings {
+	return RedactionSettings{
+		Enabled: true,
+		Rules:   []RedactionRuleSettings{},
+	}
+}
+
+/*
+Redaction
+*/
+type redactionFinding struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+}
+
+// redact replaces the secrets in the file content, the findings refer to lines of the original content.
+func (collector *NodeCollector) redact(fileName string, content []byte) ([]byte, []redactionFinding) {
+	findings := make([]redactionFinding, 0)
+
+	rules := append(append([]RedactionRuleSettings{}, builtinRedactionRules...), collector.Settings.Collecting.Redaction.Rules...)
+	for _, rule := range rules {
+		if len(rule.Files) > 0 {
+			match, err := filepath.Match(rule.Files, fileName)
+			if err != nil || !match {
+				continue
+			}
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			collector.log.Warn("Failed to compile redaction rule '" + rule.Name + "' (" + err.Error() + ")")
+			continue
+		}
+
+		group := 0
+		for index, name := range pattern.SubexpNames() {
+			if name == redactionSecretGroup {
+				group = index
+			}
+		}
+
+		var redacted bytes.Buffer
+		last := 0
+		for _, match := range pattern.FindAllSubmatchIndex(content, -1) {
+			start, end := match[0], match[1]
+			if group > 0 {
+				start, end = match[2*group], match[2*group+1]
+			}
+			// Already redacted by a previous rule
+			if start < 0 || start == end || string(content[start:end]) == redactedValue {
+				continue
+			}
+
+			findings = append(findings, redactionFinding{
+				File: fileName,
+				Line: bytes.Count(content[:start], []byte("\n")) + 1,
+				Rule: rule.Name,
+			})
+
+			redacted.Write(content[last:start])
+			redacted.WriteString(redactedValue)
+			last = end
+		}
+		redacted.Write(content[last:])
+		content = redacted.Bytes()
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+	return content, findings
+}
+
+// redactOutput redacts a collected command output like the config files, when the redaction is enabled
+func (collector *NodeCollector) redactOutput(fileName string, content []byte, findings *[]redactionFinding) []byte {
+	if !collector.Settings.Collecting.Redaction.Enabled {
+		return content
+	}
+
+	content, outputFindings := collector.redact(fileName, content)
+	*findings = append(*findings, outputFindings...)
+	return content
+}
+
+// saveOutputsRedactionReport lists the secrets redacted in the command outputs saved to path
+func (collector *NodeCollector) saveOutputsRedactionReport(path string, findings []redactionFinding) error {
+	if !collector.Settings.Collecting.Redaction.Enabled {
+		return nil
+	}
+
+	if len(findings) > 0 {
+		collector.log.Info("Redacted ", len(findings), " secrets in '"+filepath.Base(path)+"' outputs")
+	}
+	return collector.saveRedactionReport(path, findings)
+}
+
+func (collector *NodeCollector) saveRedactionReport(path string, findings []redactionFinding) error {
+	data, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = afero.WriteFile(collector.AppFs, filepath.Join(path, redactionReportFileName), data, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to save redaction report (" + err.Error() + ")")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"bytes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const cassandraYaml = `cluster_name: 'Test Cluster'
+authenticator: PasswordAuthenticator
+credentials_validity_in_ms: 2000
+server_encryption_options:
+  internode_encryption: all
+  keystore: conf/.keystore
+  keystore_password: cassandra # changeme
+  truststore_password: "truststore secret"
+  # keystore_password: commented
+client_encryption_options:
+  keystore_password:
+`
+
+const cassandraEnv = `JVM_OPTS="$JVM_OPTS -Dcom.sun.management.jmxremote.password.file=/etc/cassandra/jmxremote.password"
+JVM_OPTS="$JVM_OPTS -Djavax.net.ssl.keyStorePassword=s3cret -Dcassandra.jmx.local.port=7199"
+export JMX_PASSWORD='p@ss word'
+LDAP_URL=ldap://ldap.example.com
+`
+
+func TestNodeCollector_redact(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.Redaction.Rules = []RedactionRuleSettings{
+		{Name: "ldap-url", Files: "*.sh", Pattern: `ldap://(?P<secret>[\w.-]+)`},
+		{Name: "invalid", Pattern: `(`},
+	}
+
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	content, findings := collector.redact("cassandra.yaml", []byte(cassandraYaml))
+	assert.Equal(t, `cluster_name: 'Test Cluster'
+authenticator: PasswordAuthenticator
+credentials_validity_in_ms: 2000
+server_encryption_options:
+  internode_encryption: all
+  keystore: conf/.keystore
+  keystore_password: <redacted> # changeme
+  truststore_password: <redacted>
+  # keystore_password: commented
+client_encryption_options:
+  keystore_password:
+`, string(content))
+	assert.Equal(t, []redactionFinding{
+		{File: "cassandra.yaml", Line: 7, Rule: "yaml-secret"},
+		{File: "cassandra.yaml", Line: 8, Rule: "yaml-secret"},
+	}, findings)
+
+	content, findings = collector.redact("cassandra-env.sh", []byte(cassandraEnv))
+	assert.Equal(t, `JVM_OPTS="$JVM_OPTS -Dcom.sun.management.jmxremote.password.file=<redacted>"
+JVM_OPTS="$JVM_OPTS -Djavax.net.ssl.keyStorePassword=<redacted> -Dcassandra.jmx.local.port=7199"
+export JMX_PASSWORD=<redacted>
+LDAP_URL=ldap://<redacted>
+`, string(content))
+	assert.Equal(t, []redactionFinding{
+		{File: "cassandra-env.sh", Line: 1, Rule: "jvm-secret-property"},
+		{File: "cassandra-env.sh", Line: 2, Rule: "jvm-secret-property"},
+		{File: "cassandra-env.sh", Line: 3, Rule: "shell-secret-variable"},
+		{File: "cassandra-env.sh", Line: 4, Rule: "ldap-url"},
+	}, findings)
+
+	content, findings = collector.redact("jmx_jvm.json", []byte(`{"java.lang:type=Runtime": {"InputArguments": [
+  "-Xmx8G", "-Djavax.net.ssl.trustStorePassword=s3cret"]}}`))
+	assert.Equal(t, `{"java.lang:type=Runtime": {"InputArguments": [
+  "-Xmx8G", "-Djavax.net.ssl.trustStorePassword=<redacted>"]}}`, string(content))
+	assert.Equal(t, []redactionFinding{
+		{File: "jmx_jvm.json", Line: 2, Rule: "jvm-secret-property"},
+	}, findings)
+
+	// The system_views.settings rows as saved by collectCQLQuery
+	content, findings = collector.redact("system_views.settings.json", []byte(`[
+  {
+    "name": "server_encryption_options_keystore_password",
+    "value": "cass\"andra"
+  },
+  {
+    "name": "server_encryption_options_keystore",
+    "value": "conf/.keystore"
+  }
+]`))
+	assert.Equal(t, `[
+  {
+    "name": "server_encryption_options_keystore_password",
+    "value": "<redacted>"
+  },
+  {
+    "name": "server_encryption_options_keystore",
+    "value": "conf/.keystore"
+  }
+]`, string(content))
+	assert.Equal(t, []redactionFinding{
+		{File: "system_views.settings.json", Line: 4, Rule: "json-secret-setting"},
+	}, findings)
+
+	hook.Reset()
+}
+
+func TestNodeCollector_collectConfigurationFiles(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.
+		On("GetHost").
+		Return("node-test-host-1")
+	mockedSSHAgent.
+		On("GetContent", "/etc/cassandra/cassandra.yaml").
+		Return(bytes.NewBufferString(cassandraYaml), nil)
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.Configs = []string{"cassandra.yaml"}
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectConfigurationFiles(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	content, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/config/cassandra.yaml")
+	assert.NotContains(t, string(content), "truststore secret")
+
+	report, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/config/redaction.json")
+	assert.Contains(t, string(report), `"rule": "yaml-secret"`)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
@@ -0,0 +1,22 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+)
+
+var shellSafePattern = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// ShellQuote quotes the value to be passed to the remote shell as a single word,
+// values consisting of safe characters only are left as is.
+func ShellQuote(value string) string {
+	if len(value) == 0 {
+		return "''"
+	}
+
+	if shellSafePattern.MatchString(value) {
+		return value
+	}
+
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,26 @@
+package collector
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+
+	var testCases = []struct {
+		value    string
+		expected string
+	}{
+		{"", "''"},
+		{"/var/lib/cassandra/data", "/var/lib/cassandra/data"},
+		{"query=up", "query=up"},
+		{"/data/my snapshots", "'/data/my snapshots'"},
+		{"pa'ss", `'pa'"'"'ss'`},
+		{"$(reboot)", "'$(reboot)'"},
+		{`match[]={__name__!=""}`, `'match[]={__name__!=""}'`},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.expected, ShellQuote(test.value))
+	}
+}
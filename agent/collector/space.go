@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+Constants
+*/
+const usedSpaceCommandTemplate = "du -sk %s"
+const freeSpaceCommandTemplate = "df -Pk %s"
+
+// getUsedSpace returns the size in bytes of the remote path.
+func getUsedSpace(agent SSHCollectingAgent, path string) (int64, error) {
+	command := fmt.Sprintf(usedSpaceCommandTemplate, ShellQuote(path))
+	sout, _, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return 0, errors.New("Failed to get used space of '" + path + "' (" + err.Error() + ")")
+	}
+
+	fields := strings.Fields(sout.String())
+	if len(fields) < 1 {
+		return 0, errors.New("Failed to get used space of '" + path + "' (unexpected output)")
+	}
+
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, errors.New("Failed to parse used space of '" + path + "' (" + err.Error() + ")")
+	}
+
+	return size * 1024, nil
+}
+
+// getFreeSpace returns the space in bytes available on the remote filesystem holding the path.
+func getFreeSpace(agent SSHCollectingAgent, path string) (int64, error) {
+	command := fmt.Sprintf(freeSpaceCommandTemplate, ShellQuote(path))
+	sout, _, err := agent.ExecuteCommand(command)
+	if err != nil {
+		return 0, errors.New("Failed to get free space of '" + path + "' (" + err.Error() + ")")
+	}
+
+	return parseFreeSpace(sout.String())
+}
+
+func parseFreeSpace(output string) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return 0, errors.New("Failed to parse free space (unexpected output)")
+	}
+
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, errors.New("Failed to parse free space (unexpected output)")
+	}
+
+	available, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, errors.New("Failed to parse free space (" + err.Error() + ")")
+	}
+
+	return available * 1024, nil
+}
+
+// getLocalFreeSpaceOf returns the space available for the local path,
+// the path may not exist yet so the nearest existing parent is checked.
+func getLocalFreeSpaceOf(path string) (int64, error) {
+	path = filepath.Clean(path)
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			break
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, errors.New("Failed to find existing local folder for '" + path + "'")
+		}
+		path = parent
+	}
+
+	available, err := getLocalFreeSpace(path)
+	if err != nil {
+		return 0, errors.New("Failed to get local free space of '" + path + "' (" + err.Error() + ")")
+	}
+
+	return available, nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package collector
+
+import "syscall"
+
+func getLocalFreeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Constants
+*/
+
+// Lists the live data files relative to the data directory, keyspace/table/<file>
+const listSSTablesScriptTemplate = "find %s -mindepth 3 -maxdepth 3 -type f -name '*-Data.db' -printf '%%P\\n'"
+
+/*
+Settings
+*/
+type SSTableMetadataSettings struct {
+	Enabled bool `yaml:"enabled"`
+	// keyspace.table patterns, e.g. "ks1.events" or "ks2.*"
+	Tables []string `yaml:"tables"`
+	// sstablemetadata is in tools/bin of the Cassandra installation, usually not on the PATH
+	Command string        `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+	// SSTables passed per table, the rest is skipped
+	MaxSSTables int `yaml:"max-sstables"`
+}
+
+func SSTableMetadataDefaultSettings() SSTableMetadataSettings {
+	return SSTableMetadataSettings{
+		Enabled:     false,
+		Tables:      []string{},
+		Command:     "sstablemetadata",
+		Timeout:     5 * time.Minute,
+		MaxSSTables: 50,
+	}
+}
+
+/*
+Collector
+*/
+func (collector *NodeCollector) collectSSTableMetadata(agent SSHCollectingAgent) error {
+	settings := collector.Settings.Collecting.SSTables
+
+	if len(settings.Tables) == 0 {
+		collector.log.Warn("No tables configured for the SSTable metadata")
+		return nil
+	}
+	for _, pattern := range settings.Tables {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return errors.New("Invalid table pattern '" + pattern + "' (" + err.Error() + ")")
+		}
+	}
+
+	tables := collector.listSSTables(agent)
+	if len(tables) == 0 {
+		collector.log.Warn("No SSTables found for ", settings.Tables)
+		return nil
+	}
+
+	dest, err := collector.makeFolder(agent.GetHost(), "sstables")
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		files := tables[name]
+		sort.Strings(files)
+		if settings.MaxSSTables > 0 && len(files) > settings.MaxSSTables {
+			collector.log.Warn("Table " + name + " has " + strconv.Itoa(len(files)) + " SSTables, only " +
+				strconv.Itoa(settings.MaxSSTables) + " are read")
+			files = files[:settings.MaxSSTables]
+		}
+
+		args := make([]string, 0, len(files))
+		for _, file := range files {
+			args = append(args, ShellQuote(file))
+		}
+		command := withTimeout(settings.Command+" "+strings.Join(args, " "), settings.Timeout)
+
+		// A corrupted SSTable fails the tool, the output of the other ones is still kept
+		sout, _, err := agent.ExecuteCommand(command)
+		if err != nil {
+			collector.log.Error("Failed to read SSTable metadata of " + name + " (" + err.Error() + ")")
+		}
+		if sout == nil || sout.Len() == 0 {
+			continue
+		}
+
+		err = afero.WriteFile(collector.AppFs, filepath.Join(dest, name+".txt"), sout.Bytes(), os.ModePerm)
+		if err != nil {
+			collector.log.Error("Failed to save SSTable metadata of " + name + " (" + err.Error() + ")")
+		}
+	}
+
+	return nil
+}
+
+// listSSTables returns the data files of the matching tables keyed by keyspace.table
+func (collector *NodeCollector) listSSTables(agent SSHCollectingAgent) map[string][]string {
+	settings := collector.Settings.Collecting.SSTables
+
+	tables := make(map[string][]string)
+	for _, dataPath := range collector.Settings.Cassandra.DataPath {
+		script := fmt.Sprintf(listSSTablesScriptTemplate, ShellQuote(dataPath))
+		sout, _, err := agent.ExecuteCommand(withTimeout(shellCommandTemplate+ShellQuote(script), settings.Timeout))
+		if err != nil {
+			collector.log.Warn("Failed to list SSTables of '" + dataPath + "' (" + err.Error() + ")")
+		}
+		if sout == nil {
+			continue
+		}
+
+		for _, line := range strings.Split(sout.String(), "\n") {
+			elements := strings.Split(line, "/")
+			if len(elements) != 3 {
+				continue
+			}
+
+			table := elements[1]
+			match := tableFolderPattern.FindStringSubmatch(table)
+			if match != nil {
+				table = match[1]
+			}
+			name := elements[0] + "." + table
+			if !matchesAnyPattern(settings.Tables, name) {
+				continue
+			}
+			tables[name] = append(tables[name], path.Join(dataPath, line))
+		}
+	}
+
+	return tables
+}
+
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		matched, _ := path.Match(pattern, name)
+		if matched {
+			return true
+		}
+	}
+	return false
+}
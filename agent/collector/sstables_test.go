@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const listSSTablesCommand = "timeout 60s sh -c 'find /var/lib/cassandra/data -mindepth 3 -maxdepth 3 -type f " +
+	"-name '\"'\"'*-Data.db'\"'\"' -printf '\"'\"'%P\\n'\"'\"''"
+
+const sstablesListing = `ks1/events-0123456789abcdef0123456789abcdef/nb-2-big-Data.db
+ks1/events-0123456789abcdef0123456789abcdef/nb-1-big-Data.db
+ks1/users-fedcba9876543210fedcba9876543210/nb-1-big-Data.db
+ks2/sessions-00112233445566778899aabbccddeeff/nb-4-big-Data.db
+ks2/sessions-00112233445566778899aabbccddeeff/nb-6-big-Data.db
+ks2/sessions-00112233445566778899aabbccddeeff/nb-5-big-Data.db
+system/local-7ad54392bcdd35a684174e047860b377/nb-1-big-Data.db
+`
+
+func TestNodeCollector_collectSSTableMetadata(t *testing.T) {
+	mockedSSHAgent := new(mockedSSHAgentObject)
+	mockedSSHAgent.On("GetHost").Return("node-test-host-1")
+	mockedSSHAgent.
+		On("ExecuteCommand", listSSTablesCommand).
+		Return(bytes.NewBufferString(sstablesListing), bytes.NewBufferString(""), nil)
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s sstablemetadata "+
+			"/var/lib/cassandra/data/ks1/events-0123456789abcdef0123456789abcdef/nb-1-big-Data.db "+
+			"/var/lib/cassandra/data/ks1/events-0123456789abcdef0123456789abcdef/nb-2-big-Data.db").
+		Return(bytes.NewBufferString("SSTable: nb-1\nSSTable: nb-2\n"), bytes.NewBufferString(""), nil)
+	// ks2.sessions is cut to two SSTables, the tool fails on the second one
+	mockedSSHAgent.
+		On("ExecuteCommand", "timeout 60s sstablemetadata "+
+			"/var/lib/cassandra/data/ks2/sessions-00112233445566778899aabbccddeeff/nb-4-big-Data.db "+
+			"/var/lib/cassandra/data/ks2/sessions-00112233445566778899aabbccddeeff/nb-5-big-Data.db").
+		Return(bytes.NewBufferString("SSTable: nb-4\n"), bytes.NewBufferString(""), errors.New("exit status 1"))
+
+	logger, hook := test.NewNullLogger()
+
+	settings := NodeCollectorDefaultSettings()
+	settings.Collecting.SSTables = SSTableMetadataSettings{
+		Enabled:     true,
+		Tables:      []string{"ks1.events", "ks2.*"},
+		Command:     "sstablemetadata",
+		Timeout:     time.Minute,
+		MaxSSTables: 2,
+	}
+
+	appFs := afero.NewMemMapFs()
+	collector := NodeCollector{
+		Settings: settings,
+		Logger:   logger,
+		Path:     "some/path",
+		AppFs:    appFs,
+		log:      logger.WithField("prefix", "test"),
+	}
+
+	err := collector.collectSSTableMetadata(mockedSSHAgent)
+	assert.NoError(t, err)
+
+	data, _ := afero.ReadFile(appFs, "some/path/node-test-host-1/sstables/ks1.events.txt")
+	assert.Equal(t, "SSTable: nb-1\nSSTable: nb-2\n", string(data))
+	data, _ = afero.ReadFile(appFs, "some/path/node-test-host-1/sstables/ks2.sessions.txt")
+	assert.Equal(t, "SSTable: nb-4\n", string(data))
+	exists, _ := afero.Exists(appFs, "some/path/node-test-host-1/sstables/ks1.users.txt")
+	assert.False(t, exists)
+	exists, _ = afero.Exists(appFs, "some/path/node-test-host-1/sstables/system.local.txt")
+	assert.False(t, exists)
+
+	mockedSSHAgent.AssertExpectations(t)
+
+	hook.Reset()
+}
@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+Constants
+*/
+const SummaryFileName = "summary.json"
+
+const (
+	NodeHost    = "node"
+	MetricsHost = "metrics"
+)
+
+/*
+Summary
+*/
+
+// HostSummary is the outcome of collecting a host, Error is set when the host failed as a whole
+type HostSummary struct {
+	Host  string       `json:"host"`
+	Kind  string       `json:"kind"`
+	Error string       `json:"error,omitempty"`
+	Tasks []TaskStatus `json:"tasks"`
+}
+
+// CollectingSummary gathers the hosts summaries, the collectors record into it concurrently
+type CollectingSummary struct {
+	lock  sync.Mutex
+	hosts []HostSummary
+}
+
+func (summary *CollectingSummary) Record(host HostSummary) {
+	if summary == nil {
+		return
+	}
+
+	summary.lock.Lock()
+	defer summary.lock.Unlock()
+
+	summary.hosts = append(summary.hosts, host)
+}
+
+func (summary *CollectingSummary) sorted() []HostSummary {
+	summary.lock.Lock()
+	defer summary.lock.Unlock()
+
+	hosts := append([]HostSummary{}, summary.hosts...)
+	sort.SliceStable(hosts, func(i, j int) bool {
+		if hosts[i].Kind != hosts[j].Kind {
+			return hosts[i].Kind > hosts[j].Kind
+		}
+		return hosts[i].Host < hosts[j].Host
+	})
+	return hosts
+}
+
+// RequiredFailures lists the failed hosts and the failed required tasks as "<host>" and "<host>/<task>"
+func (summary *CollectingSummary) RequiredFailures(required []string) []string {
+	names := make(map[string]bool)
+	for _, name := range required {
+		names[name] = true
+	}
+
+	failures := make([]string, 0)
+	for _, host := range summary.sorted() {
+		if len(host.Error) > 0 {
+			failures = append(failures, host.Host)
+			continue
+		}
+		for _, task := range host.Tasks {
+			if task.Status == TaskFailed && (names[task.Name] || task.Fatal) {
+				failures = append(failures, host.Host+"/"+task.Name)
+			}
+		}
+	}
+	return failures
+}
+
+// Table formats the summary, one row per host task
+func (summary *CollectingSummary) Table() string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(writer, "HOST\tTASK\tSTATUS\tDURATION\tSIZE\tERROR")
+	for _, host := range summary.sorted() {
+		if len(host.Error) > 0 {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t\t\t%s\n", host.Host, "-", TaskFailed, host.Error)
+		}
+		for _, task := range host.Tasks {
+			duration := (time.Duration(task.DurationMs) * time.Millisecond).Round(100 * time.Millisecond)
+			message := task.Error
+			if len(message) == 0 && task.Issues > 0 {
+				message = fmt.Sprint(task.Issues, " warnings and errors logged")
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", host.Host, task.Name, task.Status, duration,
+				HumanSize(float64(task.Bytes)), message)
+		}
+	}
+	writer.Flush()
+
+	return buffer.String()
+}
+
+func (summary *CollectingSummary) Save(fs afero.Fs, path string) error {
+	data, err := json.MarshalIndent(struct {
+		Hosts []HostSummary `json:"hosts"`
+	}{summary.sorted()}, "", "  ")
+	if err != nil {
+		return errors.New("Failed to marshal collecting summary (" + err.Error() + ")")
+	}
+
+	err = afero.WriteFile(fs, filepath.Join(path, SummaryFileName), data, os.ModePerm)
+	if err != nil {
+		return errors.New("Failed to save collecting summary (" + err.Error() + ")")
+	}
+
+	return nil
+}
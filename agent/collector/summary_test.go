@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCollectingSummary(t *testing.T) {
+	summary := &CollectingSummary{}
+	summary.Record(HostSummary{Host: "10.0.0.2", Kind: NodeHost, Tasks: []TaskStatus{
+		{Name: "nodetool", Status: TaskOK, Bytes: 2048, DurationMs: 1500},
+		{Name: "cql", Status: TaskFailed, Error: "Failed to connect CQL"},
+	}})
+	summary.Record(HostSummary{Host: "metrics.example.com", Kind: MetricsHost, Tasks: []TaskStatus{
+		{Name: "metrics", Status: TaskOK},
+		{Name: "rules", Status: TaskWarning, Issues: 2},
+	}})
+	summary.Record(HostSummary{Host: "10.0.0.1", Kind: NodeHost, Error: "Failed to connect", Tasks: []TaskStatus{}})
+	summary.Record(HostSummary{Host: "10.0.0.3", Kind: NodeHost, Tasks: []TaskStatus{
+		{Name: "custom", Status: TaskFailed, Fatal: true, Error: "Failed to execute custom task 'sidecar'"},
+	}})
+
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.3/custom"}, summary.RequiredFailures([]string{"nodetool"}))
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2/cql", "10.0.0.3/custom"},
+		summary.RequiredFailures([]string{"nodetool", "cql"}))
+
+	lines := strings.Split(strings.TrimSpace(summary.Table()), "\n")
+	if assert.Len(t, lines, 7) {
+		assert.Equal(t, []string{"HOST", "TASK", "STATUS", "DURATION", "SIZE", "ERROR"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{"10.0.0.1", "-", "failed", "Failed", "to", "connect"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"10.0.0.2", "nodetool", "ok", "1.5s", "2.048", "kB"}, strings.Fields(lines[2]))
+		assert.True(t, strings.HasPrefix(lines[6], "metrics.example.com  rules"))
+		assert.True(t, strings.HasSuffix(lines[6], "2 warnings and errors logged"))
+	}
+
+	appFs := afero.NewMemMapFs()
+	assert.NoError(t, summary.Save(appFs, "some/path"))
+
+	var saved struct {
+		Hosts []HostSummary `json:"hosts"`
+	}
+	data, _ := afero.ReadFile(appFs, "some/path/summary.json")
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	if assert.Len(t, saved.Hosts, 4) {
+		assert.Equal(t, "10.0.0.1", saved.Hosts[0].Host)
+		assert.Equal(t, "metrics.example.com", saved.Hosts[3].Host)
+		assert.Equal(t, int64(2048), saved.Hosts[1].Tasks[0].Bytes)
+	}
+}
@@ -0,0 +1,402 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Constants
+*/
+const (
+	TaskOK      = "ok"
+	TaskWarning = "warning"
+	TaskFailed  = "failed"
+	// Not run, a dependency failed with a FatalError or was skipped
+	TaskSkipped = "skipped"
+)
+
+/*
+Task
+*/
+
+// Task is a unit of the collecting, run by RunTasks once its dependencies have finished
+type Task interface {
+	Name() string
+	// Dependencies order the tasks, a dependency failed with a FatalError skips the task, other failed or not
+	// selected dependencies do not stop it
+	Dependencies() []string
+	// The warnings and errors logged with log make the task status a warning
+	Run(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error
+}
+
+// OutputSink is the folder of the collected host, the tasks save their data into its sub folders
+type OutputSink interface {
+	Folder(name string) (string, error)
+	Fs() afero.Fs
+}
+
+type FolderSink struct {
+	AppFs afero.Fs
+	Path  string
+}
+
+func (sink *FolderSink) Folder(name string) (string, error) {
+	path := filepath.Join(sink.Path, name)
+	err := sink.AppFs.MkdirAll(path, os.ModePerm)
+	if err != nil {
+		return "", errors.New("Failed to create '" + name + "' folder (" + err.Error() + ")")
+	}
+
+	return path, nil
+}
+
+func (sink *FolderSink) Fs() afero.Fs {
+	return sink.AppFs
+}
+
+// FatalError fails the whole host collecting, other task errors are reported in the task status only
+type FatalError struct {
+	Err error
+}
+
+func (err *FatalError) Error() string {
+	return err.Err.Error()
+}
+
+// WarningError completes the task with a warning, the error is reported in the task status
+type WarningError struct {
+	Err error
+}
+
+func (err *WarningError) Error() string {
+	return err.Err.Error()
+}
+
+type TaskStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Fatal  bool   `json:"fatal,omitempty"`
+	// Warnings and errors logged by the task
+	Issues     int       `json:"issues"`
+	Bytes      int64     `json:"bytes"`
+	Started    time.Time `json:"started"`
+	DurationMs int64     `json:"duration-ms"`
+}
+
+// funcTask adapts the built-in collecting functions
+type funcTask struct {
+	name         string
+	dependencies []string
+	run          func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error
+}
+
+func (task *funcTask) Name() string {
+	return task.name
+}
+
+func (task *funcTask) Dependencies() []string {
+	return task.dependencies
+}
+
+func (task *funcTask) Run(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+	return task.run(agent, sink, log)
+}
+
+/*
+Registry
+*/
+
+// TaskFilter selects the tasks by name, Only empty selects all the tasks
+type TaskFilter struct {
+	Only []string
+	Skip []string
+}
+
+// ParseTaskNames splits a comma separated list of task names
+func ParseTaskNames(value string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Validate checks that all the names are known
+func (filter *TaskFilter) Validate(known []string) error {
+	names := make(map[string]bool)
+	for _, name := range known {
+		names[name] = true
+	}
+
+	unknown := make([]string, 0)
+	for _, name := range append(append([]string{}, filter.Only...), filter.Skip...) {
+		if !names[name] {
+			unknown = append(unknown, name)
+			names[name] = true
+		}
+	}
+	if len(unknown) > 0 {
+		sorted := append([]string{}, known...)
+		sort.Strings(sorted)
+		return errors.New("Unknown tasks " + strings.Join(unknown, ", ") + " (known tasks: " + strings.Join(sorted, ", ") + ")")
+	}
+
+	return nil
+}
+
+func (filter *TaskFilter) Selects(name string) bool {
+	for _, skipped := range filter.Skip {
+		if skipped == name {
+			return false
+		}
+	}
+	if len(filter.Only) == 0 {
+		return true
+	}
+	for _, selected := range filter.Only {
+		if selected == name {
+			return true
+		}
+	}
+	return false
+}
+
+type TaskRegistry struct {
+	tasks []Task
+	names map[string]bool
+}
+
+func NewTaskRegistry() *TaskRegistry {
+	return &TaskRegistry{
+		tasks: make([]Task, 0),
+		names: make(map[string]bool),
+	}
+}
+
+func (registry *TaskRegistry) Register(task Task) error {
+	if len(task.Name()) == 0 {
+		return errors.New("Task name is required")
+	}
+	if registry.names[task.Name()] {
+		return errors.New("Task '" + task.Name() + "' is already registered")
+	}
+	registry.names[task.Name()] = true
+	registry.tasks = append(registry.tasks, task)
+
+	return nil
+}
+
+// MustRegister registers the built-in tasks, a failure is a programming error
+func (registry *TaskRegistry) MustRegister(task Task) {
+	err := registry.Register(task)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (registry *TaskRegistry) Names() []string {
+	names := make([]string, 0, len(registry.tasks))
+	for _, task := range registry.tasks {
+		names = append(names, task.Name())
+	}
+	return names
+}
+
+// Select returns the registered tasks passing the filter, in the registration order
+func (registry *TaskRegistry) Select(filter TaskFilter) []Task {
+	tasks := make([]Task, 0)
+	for _, task := range registry.tasks {
+		if filter.Selects(task.Name()) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+/*
+Scheduler
+*/
+
+// RunTasks runs the tasks concurrently, at most workers at once (no limit when not positive), each one after
+// its dependencies, and returns the status of each task in the given order
+func RunTasks(tasks []Task, workers int, agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) ([]TaskStatus, error) {
+	err := checkTaskDependencies(tasks)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = len(tasks)
+	}
+
+	done := make(map[string]chan struct{})
+	indexes := make(map[string]int)
+	for index, task := range tasks {
+		done[task.Name()] = make(chan struct{})
+		indexes[task.Name()] = index
+	}
+
+	// A task takes a slot once its dependencies have finished, so the running tasks never wait for the others
+	slots := make(chan struct{}, workers)
+	statuses := make([]TaskStatus, len(tasks))
+	for index, task := range tasks {
+		go func(index int, task Task) {
+			defer close(done[task.Name()])
+
+			for _, dependency := range task.Dependencies() {
+				if channel, ok := done[dependency]; ok {
+					<-channel
+				}
+			}
+
+			// The statuses of the finished dependencies are not written anymore
+			for _, dependency := range task.Dependencies() {
+				position, ok := indexes[dependency]
+				if ok && statuses[position].Fatal {
+					statuses[index] = skipTask(task, "the '"+dependency+"' task failed", log)
+					return
+				}
+				if ok && statuses[position].Status == TaskSkipped {
+					statuses[index] = skipTask(task, "the '"+dependency+"' task was skipped", log)
+					return
+				}
+			}
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			statuses[index] = runTask(task, agent, sink, log)
+		}(index, task)
+	}
+
+	for _, task := range tasks {
+		<-done[task.Name()]
+	}
+
+	return statuses, nil
+}
+
+func runTask(task Task, agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) TaskStatus {
+	status := TaskStatus{Name: task.Name(), Status: TaskOK, Started: time.Now()}
+
+	counters := &taskCounters{}
+	installTaskIssuesHook(log.Logger)
+	taskLog := log.WithField("task", task.Name()).WithContext(context.WithValue(context.Background(), taskCountersKey, counters))
+	taskSink := &countingSink{OutputSink: sink, counters: counters}
+	taskAgent := &countingAgent{SSHCollectingAgent: agent, fs: sink.Fs(), counters: counters}
+
+	log.Info("Running task '" + task.Name() + "'...")
+	err := task.Run(taskAgent, taskSink, taskLog)
+	status.DurationMs = time.Since(status.Started).Milliseconds()
+	status.Issues = int(atomic.LoadInt64(&counters.issues))
+	status.Bytes = atomic.LoadInt64(&counters.bytes)
+
+	var warning *WarningError
+	if errors.As(err, &warning) {
+		status.Status = TaskWarning
+		status.Error = err.Error()
+		log.Warn("Task '"+task.Name()+"' completed with a warning (", err, ")")
+		return status
+	}
+	if err != nil {
+		var fatal *FatalError
+		status.Status = TaskFailed
+		status.Error = err.Error()
+		status.Fatal = errors.As(err, &fatal)
+		log.Error("Task '"+task.Name()+"' failed (", err, ")")
+		return status
+	}
+	if status.Issues > 0 {
+		status.Status = TaskWarning
+		log.Warn("Task '"+task.Name()+"' completed with ", status.Issues, " issues.")
+		return status
+	}
+	log.Info("Task '" + task.Name() + "' completed.")
+
+	return status
+}
+
+func skipTask(task Task, reason string, log *logrus.Entry) TaskStatus {
+	status := TaskStatus{Name: task.Name(), Status: TaskSkipped, Started: time.Now(), Error: "Skipped, " + reason}
+	log.Warn("Task '" + task.Name() + "' skipped, " + reason)
+
+	return status
+}
+
+// tasksError returns the fatal error, or lists the failed tasks
+func tasksError(statuses []TaskStatus) error {
+	failed := make([]string, 0)
+	for _, status := range statuses {
+		if status.Fatal {
+			return errors.New(status.Error)
+		}
+		if status.Status == TaskFailed {
+			failed = append(failed, status.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New("Failed tasks " + strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// checkTaskDependencies rejects the dependency cycles, they would never start
+func checkTaskDependencies(tasks []Task) error {
+	index := make(map[string]Task)
+	for _, task := range tasks {
+		index[task.Name()] = task
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+
+	var visit func(task Task, path []string) error
+	visit = func(task Task, path []string) error {
+		switch state[task.Name()] {
+		case visiting:
+			return errors.New("Task dependency cycle " + strings.Join(append(path, task.Name()), " -> "))
+		case visited:
+			return nil
+		}
+
+		state[task.Name()] = visiting
+		for _, name := range task.Dependencies() {
+			dependency, ok := index[name]
+			if !ok {
+				continue
+			}
+			err := visit(dependency, append(path, task.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		state[task.Name()] = visited
+
+		return nil
+	}
+
+	for _, task := range tasks {
+		err := visit(task, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
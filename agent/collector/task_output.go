@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Task counters
+*/
+type taskCountersKeyType struct{}
+
+var taskCountersKey = taskCountersKeyType{}
+
+// taskCounters are updated concurrently, through the atomic functions only
+type taskCounters struct {
+	issues int64
+	bytes  int64
+}
+
+// taskIssuesHook counts the warnings and errors logged with a task logger, see runTask
+type taskIssuesHook struct{}
+
+func (hook *taskIssuesHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+func (hook *taskIssuesHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if counters, ok := entry.Context.Value(taskCountersKey).(*taskCounters); ok {
+		atomic.AddInt64(&counters.issues, 1)
+	}
+	return nil
+}
+
+var taskIssuesHookLock sync.Mutex
+var taskIssuesHookLoggers = make(map[*logrus.Logger]bool)
+
+func installTaskIssuesHook(logger *logrus.Logger) {
+	taskIssuesHookLock.Lock()
+	defer taskIssuesHookLock.Unlock()
+
+	if !taskIssuesHookLoggers[logger] {
+		logger.AddHook(&taskIssuesHook{})
+		taskIssuesHookLoggers[logger] = true
+	}
+}
+
+/*
+Counting wrappers
+*/
+
+// countingSink counts the bytes written through its file system
+type countingSink struct {
+	OutputSink
+	counters *taskCounters
+}
+
+func (sink *countingSink) Fs() afero.Fs {
+	return &countingFs{Fs: sink.OutputSink.Fs(), counters: sink.counters}
+}
+
+type countingFs struct {
+	afero.Fs
+	counters *taskCounters
+}
+
+func (fs *countingFs) Create(name string) (afero.File, error) {
+	file, err := fs.Fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{File: file, counters: fs.counters}, nil
+}
+
+func (fs *countingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{File: file, counters: fs.counters}, nil
+}
+
+type countingFile struct {
+	afero.File
+	counters *taskCounters
+}
+
+func (file *countingFile) Write(p []byte) (int, error) {
+	n, err := file.File.Write(p)
+	atomic.AddInt64(&file.counters.bytes, int64(n))
+	return n, err
+}
+
+func (file *countingFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := file.File.WriteAt(p, off)
+	atomic.AddInt64(&file.counters.bytes, int64(n))
+	return n, err
+}
+
+func (file *countingFile) WriteString(s string) (int, error) {
+	n, err := file.File.WriteString(s)
+	atomic.AddInt64(&file.counters.bytes, int64(n))
+	return n, err
+}
+
+// countingAgent counts the received files, the agent writes them past the sink file system
+type countingAgent struct {
+	SSHCollectingAgent
+	fs       afero.Fs
+	counters *taskCounters
+}
+
+func (agent *countingAgent) ReceiveFile(src, dest string, progressFn ProgressFunc) error {
+	err := agent.SSHCollectingAgent.ReceiveFile(src, dest, progressFn)
+	if err != nil {
+		return err
+	}
+
+	if stat, err := agent.fs.Stat(dest); err == nil && stat.IsDir() {
+		dest = filepath.Join(dest, filepath.Base(src))
+	}
+	if stat, err := agent.fs.Stat(dest); err == nil {
+		atomic.AddInt64(&agent.counters.bytes, stat.Size())
+	}
+	return nil
+}
+
+func (agent *countingAgent) ReceiveDir(src, dest string, progressFn ProgressFunc) error {
+	before := agent.treeSize(dest)
+	err := agent.SSHCollectingAgent.ReceiveDir(src, dest, progressFn)
+	atomic.AddInt64(&agent.counters.bytes, agent.treeSize(dest)-before)
+	return err
+}
+
+func (agent *countingAgent) ReceiveCommandOutput(cmd, dest string, progressFn ProgressFunc) error {
+	err := agent.SSHCollectingAgent.ReceiveCommandOutput(cmd, dest, progressFn)
+	if stat, statErr := agent.fs.Stat(dest); statErr == nil {
+		atomic.AddInt64(&agent.counters.bytes, stat.Size())
+	}
+	return err
+}
+
+func (agent *countingAgent) treeSize(path string) int64 {
+	var size int64
+	_ = afero.Walk(agent.fs, path, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,202 @@
+package collector
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTaskFilter(t *testing.T) {
+	filter := TaskFilter{Only: ParseTaskNames(" nodetool, logs,,gc-logs "), Skip: []string{"gc-logs"}}
+	assert.Equal(t, []string{"nodetool", "logs", "gc-logs"}, filter.Only)
+
+	assert.True(t, filter.Selects("nodetool"))
+	assert.True(t, filter.Selects("logs"))
+	assert.False(t, filter.Selects("gc-logs"))
+	assert.False(t, filter.Selects("jmx"))
+
+	all := TaskFilter{Skip: []string{"metrics"}}
+	assert.True(t, all.Selects("jmx"))
+	assert.False(t, all.Selects("metrics"))
+
+	assert.NoError(t, filter.Validate([]string{"nodetool", "logs", "gc-logs", "jmx"}))
+	err := filter.Validate([]string{"nodetool", "jmx"})
+	if assert.Error(t, err) {
+		assert.Equal(t, "Unknown tasks logs, gc-logs (known tasks: jmx, nodetool)", err.Error())
+	}
+}
+
+func TestTaskRegistry(t *testing.T) {
+	registry := NewTaskRegistry()
+	assert.NoError(t, registry.Register(&funcTask{name: "first"}))
+	assert.NoError(t, registry.Register(&funcTask{name: "second"}))
+	assert.EqualError(t, registry.Register(&funcTask{name: "first"}), "Task 'first' is already registered")
+	assert.EqualError(t, registry.Register(&funcTask{name: ""}), "Task name is required")
+	assert.Panics(t, func() {
+		registry.MustRegister(&funcTask{name: "second"})
+	})
+
+	assert.Equal(t, []string{"first", "second"}, registry.Names())
+	tasks := registry.Select(TaskFilter{Only: []string{"second"}})
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, "second", tasks[0].Name())
+	}
+}
+
+func TestRunTasks(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	sink := &FolderSink{AppFs: afero.NewMemMapFs(), Path: "some/path/node-test-host-1"}
+
+	var lock sync.Mutex
+	order := make([]string, 0)
+	task := func(name string, err error, dependencies ...string) Task {
+		return &funcTask{name: name, dependencies: dependencies,
+			run: func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+				lock.Lock()
+				order = append(order, name)
+				lock.Unlock()
+				return err
+			}}
+	}
+
+	statuses, err := RunTasks([]Task{
+		task("custom", &FatalError{Err: errors.New("custom failed")}, "logs"),
+		task("logs", errors.New("logs failed"), "config", "not-selected"),
+		task("config", nil),
+		task("report", nil, "custom"),
+		task("upload", nil, "report"),
+	}, 0, nil, sink, logger.WithField("prefix", "test"))
+	assert.NoError(t, err)
+
+	// The dependencies go first, failed or not, the dependents of a fatal failure are skipped
+	assert.Equal(t, []string{"config", "logs", "custom"}, order)
+	if assert.Len(t, statuses, 5) {
+		assert.Equal(t, "custom", statuses[0].Name)
+		assert.Equal(t, TaskFailed, statuses[0].Status)
+		assert.True(t, statuses[0].Fatal)
+		assert.Equal(t, TaskFailed, statuses[1].Status)
+		assert.Equal(t, "logs failed", statuses[1].Error)
+		assert.False(t, statuses[1].Fatal)
+		assert.Equal(t, TaskOK, statuses[2].Status)
+		assert.Equal(t, TaskSkipped, statuses[3].Status)
+		assert.Equal(t, "Skipped, the 'custom' task failed", statuses[3].Error)
+		assert.Equal(t, TaskSkipped, statuses[4].Status)
+		assert.Equal(t, "Skipped, the 'report' task was skipped", statuses[4].Error)
+	}
+	assert.Equal(t, "custom failed", tasksError(statuses).Error())
+
+	_, err = RunTasks([]Task{
+		task("first", nil, "third"),
+		task("second", nil, "first"),
+		task("third", nil, "second"),
+	}, 0, nil, sink, logger.WithField("prefix", "test"))
+	if assert.Error(t, err) {
+		assert.Equal(t, "Task dependency cycle first -> third -> second -> first", err.Error())
+	}
+
+	path, err := sink.Folder("info")
+	assert.NoError(t, err)
+	assert.Equal(t, "some/path/node-test-host-1/info", path)
+
+	hook.Reset()
+}
+
+func TestRunTasks_Workers(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	sink := &FolderSink{AppFs: afero.NewMemMapFs(), Path: "some/path/node-test-host-1"}
+
+	var running, maxRunning int32
+	task := func(name string, dependencies ...string) Task {
+		return &funcTask{name: name, dependencies: dependencies,
+			run: func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+				current := atomic.AddInt32(&running, 1)
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			}}
+	}
+
+	tasks := []Task{task("logs", "config"), task("gc-logs", "logs"), task("config")}
+	for _, name := range []string{"jmx", "cql", "jvm", "os", "network", "nodetool"} {
+		tasks = append(tasks, task(name))
+	}
+
+	statuses, err := RunTasks(tasks, 2, nil, sink, logger.WithField("prefix", "test"))
+	assert.NoError(t, err)
+	assert.Len(t, statuses, len(tasks))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxRunning))
+
+	// A single worker runs the dependent tasks too
+	atomic.StoreInt32(&maxRunning, 0)
+	statuses, err = RunTasks(tasks[:3], 1, nil, sink, logger.WithField("prefix", "test"))
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxRunning))
+
+	hook.Reset()
+}
+
+func TestRunTasks_Status(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	sink := &FolderSink{AppFs: afero.NewMemMapFs(), Path: "some/path/node-test-host-1"}
+
+	statuses, err := RunTasks([]Task{
+		&funcTask{name: "nodetool", run: func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+			path, err := sink.Folder("info")
+			if err != nil {
+				return err
+			}
+			err = afero.WriteFile(sink.Fs(), filepath.Join(path, "status.info"), []byte("UN 10.0.0.1"), os.ModePerm)
+			if err != nil {
+				return err
+			}
+			log.WithField("command", "tpstats").Warn("Failed to execute 'tpstats'")
+			return nil
+		}},
+		&funcTask{name: "system", run: func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+			log.Info("Collecting system info")
+			return nil
+		}},
+		&funcTask{name: "metrics", run: func(agent SSHCollectingAgent, sink OutputSink, log *logrus.Entry) error {
+			return &WarningError{Err: errors.New("Failed to remove snapshot")}
+		}},
+	}, 0, nil, sink, logger.WithField("prefix", "test"))
+	assert.NoError(t, err)
+
+	if assert.Len(t, statuses, 3) {
+		assert.Equal(t, TaskWarning, statuses[0].Status)
+		assert.Equal(t, 1, statuses[0].Issues)
+		assert.Equal(t, int64(11), statuses[0].Bytes)
+		assert.Equal(t, TaskOK, statuses[1].Status)
+		assert.Equal(t, 0, statuses[1].Issues)
+		assert.Equal(t, TaskWarning, statuses[2].Status)
+		assert.Equal(t, "Failed to remove snapshot", statuses[2].Error)
+	}
+
+	// The task warnings are logged with the task name
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Failed to execute 'tpstats'" {
+			assert.Equal(t, "nodetool", entry.Data["task"])
+		}
+	}
+
+	assert.Nil(t, tasksError(statuses))
+	assert.EqualError(t, tasksError([]TaskStatus{{Name: "cql", Status: TaskFailed}, {Name: "jmx", Status: TaskFailed}}),
+		"Failed tasks cql, jmx")
+
+	hook.Reset()
+}
@@ -1,6 +1,12 @@
 package collector
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
 
 var decimapAbbrs = []string{"B", "kB", "MB", "GB", "TB", "PB", "EB", "ZB", "YB"}
 
@@ -20,3 +26,43 @@ func customSize(format string, size float64, base float64, _map []string) string
 	}
 	return fmt.Sprintf(format, size, _map[i])
 }
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a human-readable size (eg. "500MB", "2 GiB", "1024").
+func ParseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	index := strings.IndexFunc(value, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if index < 0 {
+		index = len(value)
+	}
+
+	number, err := strconv.ParseFloat(value[:index], 64)
+	if err != nil {
+		return 0, errors.New("invalid size '" + value + "'")
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(value[index:]))]
+	if !ok {
+		return 0, errors.New("invalid size unit '" + value + "'")
+	}
+
+	return int64(number * unit), nil
+}
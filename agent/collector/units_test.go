@@ -0,0 +1,30 @@
+package collector
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	var testCases = []struct {
+		value    string
+		expected int64
+	}{
+		{"1024", 1024},
+		{"500MB", 500 * 1000 * 1000},
+		{"1.5 GB", 1500 * 1000 * 1000},
+		{"2GiB", 2 << 30},
+		{"10k", 10000},
+	}
+
+	for _, test := range testCases {
+		size, err := ParseSize(test.value)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, size, test.value)
+	}
+
+	_, err := ParseSize("10 parsecs")
+	assert.Error(t, err)
+	_, err = ParseSize("MB")
+	assert.Error(t, err)
+}
@@ -1,13 +1,18 @@
 #!/bin/bash
 operatingSystems=("darwin" "linux" "windows")
 
+# The agent version and commit are written to the bundle manifest
+version=$(git describe --tags --always --dirty 2>/dev/null || echo "dev")
+commit=$(git rev-parse --short HEAD 2>/dev/null || echo "unknown")
+ldflags="-X main.version=${version} -X main.commit=${commit}"
+
 for os in ${operatingSystems[@]}; do
 	echo "Building $os for amd64"
 	if [[ $os = "windows" ]]; then
-		GOOS="${os}" GOARCH="amd64" go build -o "agent_${os}_amd64.exe"
+		GOOS="${os}" GOARCH="amd64" go build -ldflags "${ldflags}" -o "agent_${os}_amd64.exe"
 		zip "agent_${os}_amd64.zip" "agent_${os}_amd64.exe"
 	else
-	        GOOS="${os}" GOARCH="amd64" go build -o "agent_${os}_amd64"
+	        GOOS="${os}" GOARCH="amd64" go build -ldflags "${ldflags}" -o "agent_${os}_amd64"
 		tar -czvf "agent_${os}_amd64.tar.gz" "agent_${os}_amd64"
 	fi
 #	rm "agent_${os}_amd64"
@@ -0,0 +1,328 @@
+package jmx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+)
+
+/*
+Constants
+*/
+const (
+	connectorName = "jmxrmi"
+
+	newClientMethod     = "newClient(Ljava/lang/Object;)Ljavax/management/remote/rmi/RMIConnection;"
+	queryNamesMethod    = "queryNames(Ljavax/management/ObjectName;Ljava/rmi/MarshalledObject;Ljavax/security/auth/Subject;)Ljava/util/Set;"
+	getAttributesMethod = "getAttributes(Ljavax/management/ObjectName;[Ljava/lang/String;Ljavax/security/auth/Subject;)Ljavax/management/AttributeList;"
+	closeMethod         = "close()V"
+
+	maxValueDepth = 32
+)
+
+/*
+Client of the JMX RMI connector.
+
+The client does not take part in the RMI distributed garbage collection, the server keeps
+the connection exported for the DGC acknowledgement timeout (5 minutes by default) only.
+*/
+type Client struct {
+	dial       Dialer
+	timeout    time.Duration
+	ref        *RemoteRef
+	connection *rmiConnection
+}
+
+// Connect looks up the connector in the RMI registry listening on the address and opens a JMX connection,
+// the credentials are username and password or nil without authentication.
+func Connect(dial Dialer, address string, credentials []string, timeout time.Duration) (*Client, error) {
+	registry, err := dialRMI(dial, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer registry.Close()
+
+	stub, err := registry.lookup(connectorName)
+	if err != nil {
+		return nil, errors.New("Failed to look up JMX connector (" + err.Error() + ")")
+	}
+
+	serverRef, err := findRemoteRef(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := dialRemote(dial, serverRef, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer server.Close()
+
+	connectionStub, err := server.invoke(serverRef.ID, newClientMethod, func(encoder *Encoder) {
+		if credentials == nil {
+			encoder.WriteNull()
+		} else {
+			encoder.WriteStringArray(credentials)
+		}
+	})
+	if err != nil {
+		return nil, errors.New("Failed to open JMX connection (" + err.Error() + ")")
+	}
+
+	connectionRef, err := findRemoteRef(connectionStub)
+	if err != nil {
+		return nil, err
+	}
+
+	connection, err := dialRemote(dial, connectionRef, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{dial: dial, timeout: timeout, ref: connectionRef, connection: connection}, nil
+}
+
+// dialRemote connects the remote object endpoint, falling back to the registry host
+// as the endpoint host is often not reachable the same way (e.g. behind a tunnel).
+func dialRemote(dial Dialer, ref *RemoteRef, registry string, timeout time.Duration) (*rmiConnection, error) {
+	connection, err := dialRMI(dial, ref.Address(), timeout)
+	if err == nil {
+		return connection, nil
+	}
+
+	host, _, splitErr := net.SplitHostPort(registry)
+	if splitErr != nil || host == ref.Host {
+		return nil, err
+	}
+
+	fallback := *ref
+	fallback.Host = host
+	return dialRMI(dial, fallback.Address(), timeout)
+}
+
+// QueryNames returns the names of MBeans matching the object name pattern.
+func (client *Client) QueryNames(pattern string) ([]string, error) {
+	result, err := client.connection.invoke(client.ref.ID, queryNamesMethod, func(encoder *Encoder) {
+		encoder.WriteObjectName(pattern)
+		encoder.WriteNull()
+		encoder.WriteNull()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := Value(result).([]interface{})
+	if !ok {
+		return nil, errors.New("unexpected result of MBean query")
+	}
+
+	names := make([]string, 0, len(values))
+	for _, value := range values {
+		if name, ok := value.(string); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// GetAttributes returns the values of the MBean attributes, the attributes the MBean
+// does not have are left out.
+func (client *Client) GetAttributes(name string, attributes []string) (map[string]interface{}, error) {
+	result, err := client.connection.invoke(client.ref.ID, getAttributesMethod, func(encoder *Encoder) {
+		encoder.WriteObjectName(name)
+		encoder.WriteStringArray(attributes)
+		encoder.WriteNull()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+	list, ok := Value(result).([]interface{})
+	if !ok {
+		return nil, errors.New("unexpected result of MBean attributes")
+	}
+	for _, item := range list {
+		if attribute, ok := item.(map[string]interface{}); ok {
+			if name, ok := attribute["name"].(string); ok {
+				values[name] = attribute["value"]
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// Close closes the JMX connection.
+func (client *Client) Close() error {
+	_, err := client.connection.invoke(client.ref.ID, closeMethod, nil)
+	closeErr := client.connection.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+/*
+Conversion of deserialized values to plain values (e.g. for JSON)
+*/
+
+// Value converts the deserialized value, collections become slices and maps, composite and tabular data
+// become maps and slices of their contents, other objects become maps of their fields.
+func Value(value interface{}) interface{} {
+	return convert(value, 0)
+}
+
+func convert(value interface{}, depth int) interface{} {
+	if depth > maxValueDepth {
+		return nil
+	}
+	depth++
+
+	switch value := value.(type) {
+	case *Array:
+		values := make([]interface{}, 0, len(value.Values))
+		for _, item := range value.Values {
+			values = append(values, convert(item, depth))
+		}
+		return values
+	case *Enum:
+		return value.Constant
+	case *ClassDesc:
+		return value.Name
+	case float32:
+		return finite(float64(value))
+	case float64:
+		return finite(value)
+	case *Object:
+		return convertObject(value, depth)
+	}
+
+	return value
+}
+
+func convertObject(object *Object, depth int) interface{} {
+	switch {
+	case object.InstanceOf("java.lang.Number"), object.InstanceOf("java.lang.Boolean"), object.InstanceOf("java.lang.Character"):
+		return convert(object.Fields["value"], depth)
+	case object.InstanceOf("javax.management.ObjectName"):
+		if contents := object.Contents("javax.management.ObjectName"); len(contents) > 0 {
+			return contents[0]
+		}
+		return ""
+	case object.InstanceOf("java.util.Date"):
+		data := object.BlockData("java.util.Date")
+		if len(data) == 8 {
+			return time.Unix(0, int64(binary.BigEndian.Uint64(data))*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+		}
+	case object.InstanceOf("javax.management.Attribute"):
+		return map[string]interface{}{
+			"name":  convert(object.Fields["name"], depth),
+			"value": convert(object.Fields["value"], depth),
+		}
+	case object.InstanceOf("javax.management.openmbean.CompositeDataSupport"):
+		return convert(object.Fields["contents"], depth)
+	case object.InstanceOf("javax.management.openmbean.TabularDataSupport"):
+		rows := make([]interface{}, 0)
+		if data, ok := convert(object.Fields["dataMap"], depth).(map[string]interface{}); ok {
+			keys := sortedKeys(data)
+			for _, key := range keys {
+				rows = append(rows, data[key])
+			}
+		}
+		return rows
+	case object.InstanceOf("java.util.HashMap"):
+		return convertMap(object.Contents("java.util.HashMap"), depth)
+	case object.InstanceOf("java.util.TreeMap"):
+		return convertMap(object.Contents("java.util.TreeMap"), depth)
+	case object.InstanceOf("java.util.Hashtable"):
+		return convertMap(object.Contents("java.util.Hashtable"), depth)
+	case object.InstanceOf("java.util.concurrent.ConcurrentHashMap"):
+		return convertMap(object.Contents("java.util.concurrent.ConcurrentHashMap"), depth)
+	case object.InstanceOf("java.util.ArrayList"):
+		return convertList(object.Contents("java.util.ArrayList"), depth)
+	case object.InstanceOf("java.util.HashSet"):
+		return convertList(object.Contents("java.util.HashSet"), depth)
+	case object.InstanceOf("java.util.TreeSet"):
+		// The comparator precedes the elements
+		if contents := object.Contents("java.util.TreeSet"); len(contents) > 0 {
+			return convertList(contents[1:], depth)
+		}
+		return []interface{}{}
+	case object.InstanceOf("java.util.Collections$UnmodifiableCollection"), object.InstanceOf("java.util.Collections$SynchronizedCollection"):
+		return convert(object.Fields["c"], depth)
+	case object.InstanceOf("java.util.Collections$UnmodifiableMap"), object.InstanceOf("java.util.Collections$SynchronizedMap"):
+		return convert(object.Fields["m"], depth)
+	case object.InstanceOf("java.util.Collections$EmptyList"), object.InstanceOf("java.util.Collections$EmptySet"):
+		return []interface{}{}
+	case object.InstanceOf("java.util.Collections$EmptyMap"):
+		return map[string]interface{}{}
+	case object.InstanceOf("java.util.Collections$SingletonList"), object.InstanceOf("java.util.Collections$SingletonSet"):
+		return []interface{}{convert(object.Fields["element"], depth)}
+	case object.InstanceOf("java.util.Arrays$ArrayList"):
+		return convert(object.Fields["a"], depth)
+	case object.InstanceOf("java.util.ImmutableCollections$CollSer"):
+		if array, ok := object.Fields["array"].(*Array); ok {
+			// Tag 1 and 2 are lists and sets, 3 is map with keys and values interleaved
+			if tag, ok := object.Fields["tag"].(int32); ok && tag&0xff == 3 {
+				return convertMap(array.Values, depth)
+			}
+			return convertList(array.Values, depth)
+		}
+	}
+
+	fields := make(map[string]interface{})
+	for name, field := range object.Fields {
+		fields[name] = convert(field, depth)
+	}
+	fields["@class"] = object.Class.Name
+	return fields
+}
+
+func convertList(items []interface{}, depth int) []interface{} {
+	values := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		values = append(values, convert(item, depth))
+	}
+	return values
+}
+
+func convertMap(items []interface{}, depth int) map[string]interface{} {
+	values := make(map[string]interface{})
+	for i := 0; i+1 < len(items); i += 2 {
+		// Some maps terminate the entries with null key
+		if items[i] == nil {
+			break
+		}
+		key := convert(items[i], depth)
+		if name, ok := key.(string); ok {
+			values[name] = convert(items[i+1], depth)
+		} else {
+			values[fmt.Sprint(key)] = convert(items[i+1], depth)
+		}
+	}
+	return values
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// finite replaces NaN and infinite values JSON can not represent.
+func finite(value float64) interface{} {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,244 @@
+package jmx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+Serialization stream builder
+*/
+type stream struct {
+	bytes.Buffer
+}
+
+func (s *stream) u8(values ...byte) *stream {
+	s.Write(values)
+	return s
+}
+
+func (s *stream) u16(value uint16) *stream {
+	_ = binary.Write(s, binary.BigEndian, value)
+	return s
+}
+
+func (s *stream) i32(value int32) *stream {
+	_ = binary.Write(s, binary.BigEndian, value)
+	return s
+}
+
+func (s *stream) i64(value int64) *stream {
+	_ = binary.Write(s, binary.BigEndian, value)
+	return s
+}
+
+func (s *stream) utf(value string) *stream {
+	return s.u16(uint16(len(value))).u8([]byte(value)...)
+}
+
+func (s *stream) str(value string) *stream {
+	return s.u8(tcString).utf(value)
+}
+
+func (s *stream) classDesc(name string, flags byte, fields ...[2]string) *stream {
+	s.u8(tcClassDesc).utf(name).i64(1).u8(flags).u16(uint16(len(fields)))
+	for _, field := range fields {
+		s.u8(field[0][0]).utf(field[1])
+		if field[0][0] == 'L' || field[0][0] == '[' {
+			s.str(field[0])
+		}
+	}
+	return s.u8(tcNull, tcEndBlockData)
+}
+
+func (s *stream) block(build func(*stream)) *stream {
+	data := &stream{}
+	build(data)
+	return s.u8(tcBlockData, byte(data.Len())).u8(data.Bytes()...)
+}
+
+func (s *stream) remoteStub(port int32, number int64) *stream {
+	s.u8(tcObject).u8(tcProxyClassDesc).i32(1).utf("javax.management.remote.rmi.RMIServer").u8(tcNull, tcEndBlockData)
+	s.classDesc("java.lang.reflect.Proxy", scSerializable, [2]string{"Ljava/lang/reflect/InvocationHandler;", "h"}).u8(tcNull)
+	s.u8(tcObject).classDesc("java.rmi.server.RemoteObjectInvocationHandler", scSerializable)
+	s.classDesc("java.rmi.server.RemoteObject", scSerializable|scWriteMethod).u8(tcNull)
+	return s.block(func(data *stream) {
+		data.utf("UnicastRef").utf("cassandra-1").i32(port).i64(number).i32(7).i64(8).u8(0, 9).u8(0)
+	}).u8(tcEndBlockData)
+}
+
+func (s *stream) long(value int64) *stream {
+	s.u8(tcObject).classDesc("java.lang.Long", scSerializable, [2]string{"J", "value"})
+	s.classDesc("java.lang.Number", scSerializable).u8(tcNull)
+	return s.i64(value)
+}
+
+func (s *stream) arrayList(elements ...func(*stream)) *stream {
+	s.u8(tcObject).classDesc("java.util.ArrayList", scSerializable|scWriteMethod, [2]string{"I", "size"}).u8(tcNull)
+	s.i32(int32(len(elements))).block(func(data *stream) { data.i32(int32(len(elements))) })
+	for _, element := range elements {
+		element(s)
+	}
+	return s.u8(tcEndBlockData)
+}
+
+func (s *stream) returnHeader() *stream {
+	return s.u8(jrmpReturn).u16(streamMagic).u16(streamVersion).block(func(data *stream) {
+		data.u8(normalReturn).i32(1).i64(2).u16(3)
+	})
+}
+
+/*
+Fake JMX RMI server
+*/
+type fakeServer struct {
+	calls   []int64
+	replies map[int64][]byte
+}
+
+func (server *fakeServer) dial(network string, address string) (net.Conn, error) {
+	client, conn := net.Pipe()
+	go server.serve(conn)
+	return client, nil
+}
+
+func (server *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	handshake := make([]byte, 7)
+	if _, err := io.ReadFull(reader, handshake); err != nil {
+		return
+	}
+	_, _ = conn.Write((&stream{}).u8(jrmpProtocolAck).utf("127.0.0.1").i32(50000).Bytes())
+	if _, err := readUTF(reader); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(reader, make([]byte, 4)); err != nil {
+		return
+	}
+
+	for {
+		message, err := reader.ReadByte()
+		if err != nil || message != jrmpCall {
+			return
+		}
+
+		decoder := NewDecoder(reader)
+		if decoder.ReadHeader() != nil {
+			return
+		}
+		header, err := decoder.ReadPrimitive(34)
+		if err != nil {
+			return
+		}
+		hash := int64(binary.BigEndian.Uint64(header[26:]))
+		server.calls = append(server.calls, hash)
+
+		// Arguments, none of the calls takes primitives
+		arguments := map[int64]int{registryInterfaceHash: 1, methodHash(newClientMethod): 1,
+			methodHash(queryNamesMethod): 3, methodHash(getAttributesMethod): 3}
+		for i := 0; i < arguments[hash]; i++ {
+			if _, err := decoder.ReadObject(); err != nil {
+				return
+			}
+		}
+
+		_, _ = conn.Write(server.replies[hash])
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := &fakeServer{replies: map[int64][]byte{
+		registryInterfaceHash:        (&stream{}).returnHeader().remoteStub(7199, 11).Bytes(),
+		methodHash(newClientMethod):  (&stream{}).returnHeader().remoteStub(7199, 12).Bytes(),
+		methodHash(queryNamesMethod): nil,
+		methodHash(closeMethod):      (&stream{}).returnHeader().Bytes(),
+		methodHash(getAttributesMethod): (&stream{}).returnHeader().arrayList(func(s *stream) {
+			s.u8(tcObject).classDesc("javax.management.Attribute", scSerializable,
+				[2]string{"Ljava/lang/String;", "name"}, [2]string{"Ljava/lang/Object;", "value"}).u8(tcNull)
+			s.str("Load").long(1024)
+		}, func(s *stream) {
+			s.u8(tcObject).u8(tcReference).i32(baseWireHandle + 2)
+			s.str("ReleaseVersion").str("4.0.11")
+		}).Bytes(),
+	}}
+
+	// HashSet of one ObjectName
+	names := (&stream{}).returnHeader()
+	names.u8(tcObject).classDesc("java.util.HashSet", scSerializable|scWriteMethod).u8(tcNull)
+	names.block(func(data *stream) { data.i32(16).i32(0x3f400000).i32(1) })
+	names.u8(tcObject).classDesc("javax.management.ObjectName", scSerializable|scWriteMethod).u8(tcNull)
+	names.str("org.apache.cassandra.db:type=StorageService").u8(tcEndBlockData)
+	names.u8(tcEndBlockData)
+	server.replies[methodHash(queryNamesMethod)] = names.Bytes()
+
+	client, err := Connect(server.dial, "127.0.0.1:7199", []string{"cassandra", "secret"}, time.Second)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(12), client.ref.ID.Number)
+
+	result, err := client.QueryNames("org.apache.cassandra.db:*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org.apache.cassandra.db:type=StorageService"}, result)
+
+	attributes, err := client.GetAttributes("org.apache.cassandra.db:type=StorageService", []string{"Load", "ReleaseVersion"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Load": int64(1024), "ReleaseVersion": "4.0.11"}, attributes)
+
+	assert.NoError(t, client.Close())
+	assert.Equal(t, []int64{registryInterfaceHash, methodHash(newClientMethod), methodHash(queryNamesMethod),
+		methodHash(getAttributesMethod), methodHash(closeMethod)}, server.calls)
+}
+
+func TestRemoteException(t *testing.T) {
+	reply := (&stream{}).u8(jrmpReturn).u16(streamMagic).u16(streamVersion).block(func(data *stream) {
+		data.u8(exceptionalReturn).i32(1).i64(2).u16(3)
+	})
+	reply.u8(tcObject).classDesc("java.lang.SecurityException", scSerializable)
+	reply.classDesc("java.lang.Throwable", scSerializable,
+		[2]string{"Ljava/lang/String;", "detailMessage"}, [2]string{"Ljava/lang/Throwable;", "cause"}).u8(tcNull)
+	reply.str("Authentication failed").u8(tcReference).i32(baseWireHandle + 4)
+
+	server := &fakeServer{replies: map[int64][]byte{registryInterfaceHash: reply.Bytes()}}
+
+	_, err := Connect(server.dial, "127.0.0.1:7199", nil, time.Second)
+	assert.EqualError(t, err, "Failed to look up JMX connector (java.lang.SecurityException: Authentication failed)")
+}
+
+func TestMethodHash(t *testing.T) {
+	assert.Equal(t, int64(-1089742558549201240), methodHash(newClientMethod))
+	assert.Equal(t, int64(-8081107751519807347), methodHash("getVersion()Ljava/lang/String;"))
+}
+
+func TestEncoder(t *testing.T) {
+	encoder := NewEncoder()
+	encoder.WriteObjectName("java.lang:type=Memory")
+	encoder.WriteStringArray([]string{"HeapMemoryUsage"})
+
+	decoder := NewDecoder(bytes.NewReader(encoder.Bytes()))
+	assert.NoError(t, decoder.ReadHeader())
+
+	name, err := decoder.ReadObject()
+	assert.NoError(t, err)
+	assert.Equal(t, "java.lang:type=Memory", Value(name))
+
+	attributes, err := decoder.ReadObject()
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"HeapMemoryUsage"}, Value(attributes))
+}
+
+func TestModifiedUTF8(t *testing.T) {
+	value := "keyspace\x00ü€😀"
+	assert.Equal(t, []byte{0xc0, 0x80}, encodeModifiedUTF8("\x00"))
+	assert.Equal(t, 6, len(encodeModifiedUTF8("😀")))
+	assert.Equal(t, value, decodeModifiedUTF8(encodeModifiedUTF8(value)))
+}
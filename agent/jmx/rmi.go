@@ -0,0 +1,349 @@
+package jmx
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Java RMI transport protocol (JRMP)
+*/
+const (
+	jrmpMagic          = 0x4a524d49
+	jrmpVersion        = 2
+	jrmpStreamProtocol = 0x4b
+	jrmpProtocolAck    = 0x4e
+	jrmpCall           = 0x50
+	jrmpReturn         = 0x51
+
+	normalReturn      = 1
+	exceptionalReturn = 2
+
+	registryInterfaceHash = 4905912898345647071
+	registryLookup        = 2
+)
+
+type Dialer func(network string, address string) (net.Conn, error)
+
+// ObjID identifies an exported remote object.
+type ObjID struct {
+	Number int64
+	Unique int32
+	Time   int64
+	Count  int16
+}
+
+// RemoteRef is a live reference to a remote object.
+type RemoteRef struct {
+	Host string
+	Port int
+	ID   ObjID
+}
+
+func (ref RemoteRef) Address() string {
+	return net.JoinHostPort(ref.Host, strconv.Itoa(ref.Port))
+}
+
+// RemoteError is an exception thrown by the remote method.
+type RemoteError struct {
+	Class   string
+	Message string
+}
+
+func (err *RemoteError) Error() string {
+	if err.Message == "" {
+		return err.Class
+	}
+	return err.Class + ": " + err.Message
+}
+
+type rmiConnection struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+func dialRMI(dial Dialer, address string, timeout time.Duration) (*rmiConnection, error) {
+	conn, err := dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	connection := &rmiConnection{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+	connection.deadline()
+
+	var handshake bytes.Buffer
+	_ = binary.Write(&handshake, binary.BigEndian, uint32(jrmpMagic))
+	_ = binary.Write(&handshake, binary.BigEndian, uint16(jrmpVersion))
+	handshake.WriteByte(jrmpStreamProtocol)
+	_, err = conn.Write(handshake.Bytes())
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	ack, err := connection.reader.ReadByte()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if ack != jrmpProtocolAck {
+		_ = conn.Close()
+		return nil, errors.New("RMI protocol not acknowledged")
+	}
+
+	// Endpoint the server sees, the client answers with it and port zero
+	host, err := readUTF(connection.reader)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_, err = io.ReadFull(connection.reader, make([]byte, 4))
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	var endpoint bytes.Buffer
+	writeUTF(&endpoint, host)
+	_ = binary.Write(&endpoint, binary.BigEndian, int32(0))
+	_, err = conn.Write(endpoint.Bytes())
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return connection, nil
+}
+
+func (connection *rmiConnection) deadline() {
+	if connection.timeout > 0 {
+		_ = connection.conn.SetDeadline(time.Now().Add(connection.timeout))
+	}
+}
+
+func (connection *rmiConnection) Close() error {
+	return connection.conn.Close()
+}
+
+// call invokes the remote method, the header is the operation and hash following the object id,
+// the arguments are written by the function.
+func (connection *rmiConnection) call(id ObjID, header []byte, arguments func(*Encoder), void bool) (interface{}, error) {
+	connection.deadline()
+
+	var primitives bytes.Buffer
+	_ = binary.Write(&primitives, binary.BigEndian, id)
+	primitives.Write(header)
+
+	encoder := NewEncoder()
+	encoder.WriteBlockData(primitives.Bytes())
+	if arguments != nil {
+		arguments(encoder)
+	}
+
+	_, err := connection.conn.Write(append([]byte{jrmpCall}, encoder.Bytes()...))
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := connection.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if message != jrmpReturn {
+		return nil, errors.New("unexpected RMI message 0x" + strconv.FormatInt(int64(message), 16))
+	}
+
+	decoder := NewDecoder(connection.reader)
+	err = decoder.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	// Return type followed by the UID to acknowledge
+	returnHeader, err := decoder.ReadPrimitive(15)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reading further would block with methods not returning a value
+	if returnHeader[0] == normalReturn && void {
+		return nil, nil
+	}
+
+	value, err := decoder.ReadObject()
+	if err != nil {
+		return nil, err
+	}
+
+	switch returnHeader[0] {
+	case normalReturn:
+		return value, nil
+	case exceptionalReturn:
+		return nil, remoteError(value)
+	}
+
+	return nil, errors.New("unexpected RMI return type")
+}
+
+// invoke calls a method of a remote object exported with the 1.2 stub protocol.
+func (connection *rmiConnection) invoke(id ObjID, method string, arguments func(*Encoder)) (interface{}, error) {
+	var header bytes.Buffer
+	_ = binary.Write(&header, binary.BigEndian, int32(-1))
+	_ = binary.Write(&header, binary.BigEndian, methodHash(method))
+
+	return connection.call(id, header.Bytes(), arguments, strings.HasSuffix(method, ")V"))
+}
+
+// lookup finds the remote object bound in the RMI registry.
+func (connection *rmiConnection) lookup(name string) (interface{}, error) {
+	var header bytes.Buffer
+	_ = binary.Write(&header, binary.BigEndian, int32(registryLookup))
+	_ = binary.Write(&header, binary.BigEndian, int64(registryInterfaceHash))
+
+	return connection.call(ObjID{}, header.Bytes(), func(encoder *Encoder) {
+		encoder.WriteString(name)
+	}, false)
+}
+
+// methodHash computes the hash RMI uses to identify the method by name and descriptor.
+func methodHash(method string) int64 {
+	var data bytes.Buffer
+	writeUTF(&data, method)
+
+	digest := sha1.Sum(data.Bytes())
+	return int64(binary.LittleEndian.Uint64(digest[:8]))
+}
+
+// findRemoteRef finds the live reference in a deserialized stub or proxy.
+func findRemoteRef(value interface{}) (*RemoteRef, error) {
+	object, ok := value.(*Object)
+	if !ok {
+		return nil, errors.New("remote object expected, got " + describe(value))
+	}
+
+	if handler, ok := object.Fields["h"]; ok && object.Class.Super != nil && object.Class.Super.Name == "java.lang.reflect.Proxy" {
+		return findRemoteRef(handler)
+	}
+
+	if !object.InstanceOf("java.rmi.server.RemoteObject") {
+		return nil, errors.New("remote object expected, got " + describe(value))
+	}
+
+	return parseRemoteRef(object.BlockData("java.rmi.server.RemoteObject"))
+}
+
+// parseRemoteRef parses the external form of UnicastRef and UnicastRef2.
+func parseRemoteRef(data []byte) (*RemoteRef, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+
+	refClass, err := readUTF(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	switch refClass {
+	case "UnicastRef":
+	case "UnicastRef2":
+		format, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if format != 0 {
+			return nil, errors.New("remote objects with custom socket factories (e.g. SSL) are not supported")
+		}
+	default:
+		return nil, errors.New("unsupported remote reference '" + refClass + "'")
+	}
+
+	ref := &RemoteRef{}
+	ref.Host, err = readUTF(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var port int32
+	err = binary.Read(reader, binary.BigEndian, &port)
+	if err != nil {
+		return nil, err
+	}
+	ref.Port = int(port)
+
+	err = binary.Read(reader, binary.BigEndian, &ref.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ref, nil
+}
+
+func remoteError(value interface{}) error {
+	object, ok := value.(*Object)
+	if !ok {
+		return errors.New("remote exception: " + describe(value))
+	}
+
+	remote := &RemoteError{Class: object.Class.Name}
+	remote.Message, _ = object.Fields["detailMessage"].(string)
+
+	// Look for the root cause, RMI wraps server side exceptions
+	if cause, ok := object.Fields["cause"].(*Object); ok && cause != object {
+		if causeError, ok := remoteError(cause).(*RemoteError); ok {
+			remote.Message += " (" + causeError.Error() + ")"
+		}
+	}
+
+	return remote
+}
+
+func describe(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case *Object:
+		message, _ := value.Fields["detailMessage"].(string)
+		if message != "" {
+			return value.Class.Name + ": " + message
+		}
+		return value.Class.Name
+	case *Array:
+		return value.Class.Name
+	case *Enum:
+		return value.Class.Name + "." + value.Constant
+	case *ClassDesc:
+		return "class " + value.Name
+	case string:
+		return "string"
+	}
+	return "unknown value"
+}
+
+func readUTF(reader *bufio.Reader) (string, error) {
+	var length uint16
+	err := binary.Read(reader, binary.BigEndian, &length)
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		return "", err
+	}
+
+	return decodeModifiedUTF8(data), nil
+}
+
+func writeUTF(buffer *bytes.Buffer, value string) {
+	data := encodeModifiedUTF8(value)
+	_ = binary.Write(buffer, binary.BigEndian, uint16(len(data)))
+	buffer.Write(data)
+}
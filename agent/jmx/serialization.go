@@ -0,0 +1,704 @@
+package jmx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+/*
+Java object serialization stream protocol
+*/
+const (
+	streamMagic   = 0xaced
+	streamVersion = 5
+
+	tcNull           = 0x70
+	tcReference      = 0x71
+	tcClassDesc      = 0x72
+	tcObject         = 0x73
+	tcString         = 0x74
+	tcArray          = 0x75
+	tcClass          = 0x76
+	tcBlockData      = 0x77
+	tcEndBlockData   = 0x78
+	tcReset          = 0x79
+	tcBlockDataLong  = 0x7a
+	tcException      = 0x7b
+	tcLongString     = 0x7c
+	tcProxyClassDesc = 0x7d
+	tcEnum           = 0x7e
+
+	baseWireHandle = 0x7e0000
+
+	scWriteMethod    = 0x01
+	scSerializable   = 0x02
+	scExternalizable = 0x04
+	scBlockData      = 0x08
+	scEnum           = 0x10
+)
+
+// ClassDesc is a deserialized class descriptor.
+type ClassDesc struct {
+	Name             string
+	SerialVersionUID int64
+	Flags            byte
+	Fields           []FieldDesc
+	Interfaces       []string
+	Super            *ClassDesc
+}
+
+type FieldDesc struct {
+	Type      byte
+	Name      string
+	ClassName string
+}
+
+// Object is a deserialized object, fields of the whole class hierarchy are merged and the data written
+// by custom writeObject (or writeExternal) methods is kept per class.
+type Object struct {
+	Class       *ClassDesc
+	Fields      map[string]interface{}
+	Annotations map[string][]interface{}
+}
+
+type Array struct {
+	Class  *ClassDesc
+	Values []interface{}
+}
+
+type Enum struct {
+	Class    *ClassDesc
+	Constant string
+}
+
+type BlockData []byte
+
+// Hierarchy returns the class and its super classes, the top most first.
+func (desc *ClassDesc) Hierarchy() []*ClassDesc {
+	hierarchy := make([]*ClassDesc, 0)
+	for class := desc; class != nil; class = class.Super {
+		hierarchy = append([]*ClassDesc{class}, hierarchy...)
+	}
+	return hierarchy
+}
+
+// InstanceOf checks the class or one of its super classes has the name.
+func (object *Object) InstanceOf(name string) bool {
+	for class := object.Class; class != nil; class = class.Super {
+		if class.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockData concatenates the primitive data written by the class custom serialization.
+func (object *Object) BlockData(class string) []byte {
+	var data []byte
+	for _, item := range object.Annotations[class] {
+		if block, ok := item.(BlockData); ok {
+			data = append(data, block...)
+		}
+	}
+	return data
+}
+
+// Contents returns the objects written by the class custom serialization.
+func (object *Object) Contents(class string) []interface{} {
+	contents := make([]interface{}, 0)
+	for _, item := range object.Annotations[class] {
+		if _, ok := item.(BlockData); !ok {
+			contents = append(contents, item)
+		}
+	}
+	return contents
+}
+
+/*
+Decoder
+*/
+type Decoder struct {
+	reader  *bufio.Reader
+	handles []interface{}
+	block   []byte
+}
+
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{reader: bufio.NewReader(reader)}
+}
+
+// ReadHeader reads the stream magic and version.
+func (decoder *Decoder) ReadHeader() error {
+	var header [4]byte
+	_, err := io.ReadFull(decoder.reader, header[:])
+	if err != nil {
+		return err
+	}
+
+	if binary.BigEndian.Uint16(header[0:]) != streamMagic || binary.BigEndian.Uint16(header[2:]) != streamVersion {
+		return errors.New("invalid serialization stream header")
+	}
+
+	return nil
+}
+
+// ReadPrimitive reads primitive data written in block data mode.
+func (decoder *Decoder) ReadPrimitive(size int) ([]byte, error) {
+	for len(decoder.block) < size {
+		tc, err := decoder.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		block, err := decoder.readBlockData(tc)
+		if err != nil {
+			return nil, err
+		}
+		decoder.block = append(decoder.block, block...)
+	}
+
+	data := decoder.block[:size]
+	decoder.block = decoder.block[size:]
+	return data, nil
+}
+
+// ReadObject reads the next object, the values are strings, boxed primitives as Go types
+// (for primitive fields), *Object, *Array, *Enum, *ClassDesc or nil.
+func (decoder *Decoder) ReadObject() (interface{}, error) {
+	tc, err := decoder.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	return decoder.readContent(tc)
+}
+
+func (decoder *Decoder) readContent(tc byte) (interface{}, error) {
+	switch tc {
+	case tcNull:
+		return nil, nil
+	case tcReference:
+		return decoder.readReference()
+	case tcString:
+		length, err := decoder.readUint16()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.readString(int64(length))
+	case tcLongString:
+		length, err := decoder.readInt64()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.readString(length)
+	case tcClassDesc, tcProxyClassDesc:
+		return decoder.readClassDesc(tc)
+	case tcClass:
+		desc, err := decoder.readNextClassDesc()
+		if err != nil {
+			return nil, err
+		}
+		decoder.newHandle(desc)
+		return desc, nil
+	case tcObject:
+		return decoder.readNewObject()
+	case tcArray:
+		return decoder.readNewArray()
+	case tcEnum:
+		return decoder.readNewEnum()
+	case tcBlockData, tcBlockDataLong:
+		block, err := decoder.readBlockData(tc)
+		if err != nil {
+			return nil, err
+		}
+		return BlockData(block), nil
+	case tcReset:
+		decoder.handles = nil
+		return decoder.ReadObject()
+	case tcException:
+		decoder.handles = nil
+		throwable, err := decoder.ReadObject()
+		if err != nil {
+			return nil, err
+		}
+		decoder.handles = nil
+		return nil, errors.New("exception in serialization stream: " + describe(throwable))
+	}
+
+	return nil, fmt.Errorf("unexpected serialization type code 0x%02x", tc)
+}
+
+func (decoder *Decoder) readBlockData(tc byte) ([]byte, error) {
+	var size int64
+	switch tc {
+	case tcBlockData:
+		length, err := decoder.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size = int64(length)
+	case tcBlockDataLong:
+		length, err := decoder.readInt32()
+		if err != nil {
+			return nil, err
+		}
+		size = int64(length)
+	default:
+		return nil, fmt.Errorf("block data expected, got type code 0x%02x", tc)
+	}
+
+	if size < 0 {
+		return nil, errors.New("invalid block data size")
+	}
+
+	data := make([]byte, size)
+	_, err := io.ReadFull(decoder.reader, data)
+	return data, err
+}
+
+func (decoder *Decoder) newHandle(value interface{}) int {
+	decoder.handles = append(decoder.handles, value)
+	return len(decoder.handles) - 1
+}
+
+func (decoder *Decoder) readReference() (interface{}, error) {
+	handle, err := decoder.readInt32()
+	if err != nil {
+		return nil, err
+	}
+
+	index := int(handle) - baseWireHandle
+	if index < 0 || index >= len(decoder.handles) {
+		return nil, fmt.Errorf("invalid serialization handle 0x%x", handle)
+	}
+
+	return decoder.handles[index], nil
+}
+
+func (decoder *Decoder) readString(length int64) (string, error) {
+	if length < 0 || length > math.MaxInt32 {
+		return "", errors.New("invalid string length")
+	}
+
+	data := make([]byte, length)
+	_, err := io.ReadFull(decoder.reader, data)
+	if err != nil {
+		return "", err
+	}
+
+	value := decodeModifiedUTF8(data)
+	decoder.newHandle(value)
+	return value, nil
+}
+
+func (decoder *Decoder) readNextClassDesc() (*ClassDesc, error) {
+	value, err := decoder.ReadObject()
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	desc, ok := value.(*ClassDesc)
+	if !ok {
+		return nil, errors.New("class descriptor expected")
+	}
+	return desc, nil
+}
+
+func (decoder *Decoder) readClassDesc(tc byte) (*ClassDesc, error) {
+	desc := &ClassDesc{}
+
+	if tc == tcProxyClassDesc {
+		decoder.newHandle(desc)
+
+		count, err := decoder.readInt32()
+		if err != nil {
+			return nil, err
+		}
+		for i := int32(0); i < count; i++ {
+			name, err := decoder.readUTF()
+			if err != nil {
+				return nil, err
+			}
+			desc.Interfaces = append(desc.Interfaces, name)
+		}
+		desc.Flags = scSerializable
+	} else {
+		name, err := decoder.readUTF()
+		if err != nil {
+			return nil, err
+		}
+		desc.Name = name
+
+		desc.SerialVersionUID, err = decoder.readInt64()
+		if err != nil {
+			return nil, err
+		}
+
+		decoder.newHandle(desc)
+
+		desc.Flags, err = decoder.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		count, err := decoder.readUint16()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint16(0); i < count; i++ {
+			field := FieldDesc{}
+			field.Type, err = decoder.reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			field.Name, err = decoder.readUTF()
+			if err != nil {
+				return nil, err
+			}
+			if field.Type == 'L' || field.Type == '[' {
+				className, err := decoder.ReadObject()
+				if err != nil {
+					return nil, err
+				}
+				field.ClassName, _ = className.(string)
+			}
+			desc.Fields = append(desc.Fields, field)
+		}
+	}
+
+	// Class annotation (e.g. RMI codebase location)
+	_, err := decoder.readAnnotation()
+	if err != nil {
+		return nil, err
+	}
+
+	desc.Super, err = decoder.readNextClassDesc()
+	if err != nil {
+		return nil, err
+	}
+
+	return desc, nil
+}
+
+func (decoder *Decoder) readAnnotation() ([]interface{}, error) {
+	contents := make([]interface{}, 0)
+	for {
+		tc, err := decoder.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if tc == tcEndBlockData {
+			return contents, nil
+		}
+
+		value, err := decoder.readContent(tc)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, value)
+	}
+}
+
+func (decoder *Decoder) readNewObject() (*Object, error) {
+	desc, err := decoder.readNextClassDesc()
+	if err != nil {
+		return nil, err
+	}
+	if desc == nil {
+		return nil, errors.New("object without class descriptor")
+	}
+
+	object := &Object{
+		Class:       desc,
+		Fields:      make(map[string]interface{}),
+		Annotations: make(map[string][]interface{}),
+	}
+	decoder.newHandle(object)
+
+	for _, class := range desc.Hierarchy() {
+		name := class.Name
+		if len(class.Interfaces) > 0 {
+			name = "$Proxy"
+		}
+
+		if class.Flags&scExternalizable != 0 {
+			if class.Flags&scBlockData == 0 {
+				return nil, errors.New("unsupported externalizable class '" + class.Name + "'")
+			}
+			object.Annotations[name], err = decoder.readAnnotation()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for _, field := range class.Fields {
+			value, err := decoder.readFieldValue(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			object.Fields[field.Name] = value
+		}
+
+		if class.Flags&scWriteMethod != 0 {
+			object.Annotations[name], err = decoder.readAnnotation()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return object, nil
+}
+
+func (decoder *Decoder) readNewArray() (*Array, error) {
+	desc, err := decoder.readNextClassDesc()
+	if err != nil {
+		return nil, err
+	}
+	if desc == nil || len(desc.Name) < 2 {
+		return nil, errors.New("array without class descriptor")
+	}
+
+	array := &Array{Class: desc}
+	decoder.newHandle(array)
+
+	size, err := decoder.readInt32()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, errors.New("invalid array size")
+	}
+
+	array.Values = make([]interface{}, 0, size)
+	for i := int32(0); i < size; i++ {
+		value, err := decoder.readFieldValue(desc.Name[1])
+		if err != nil {
+			return nil, err
+		}
+		array.Values = append(array.Values, value)
+	}
+
+	return array, nil
+}
+
+func (decoder *Decoder) readNewEnum() (*Enum, error) {
+	desc, err := decoder.readNextClassDesc()
+	if err != nil {
+		return nil, err
+	}
+
+	enum := &Enum{Class: desc}
+	decoder.newHandle(enum)
+
+	constant, err := decoder.ReadObject()
+	if err != nil {
+		return nil, err
+	}
+	enum.Constant, _ = constant.(string)
+
+	return enum, nil
+}
+
+func (decoder *Decoder) readFieldValue(fieldType byte) (interface{}, error) {
+	switch fieldType {
+	case 'B':
+		value, err := decoder.reader.ReadByte()
+		return int8(value), err
+	case 'C':
+		value, err := decoder.readUint16()
+		return string(rune(value)), err
+	case 'D':
+		value, err := decoder.readInt64()
+		return math.Float64frombits(uint64(value)), err
+	case 'F':
+		value, err := decoder.readInt32()
+		return math.Float32frombits(uint32(value)), err
+	case 'I':
+		return decoder.readInt32()
+	case 'J':
+		return decoder.readInt64()
+	case 'S':
+		value, err := decoder.readUint16()
+		return int16(value), err
+	case 'Z':
+		value, err := decoder.reader.ReadByte()
+		return value != 0, err
+	case 'L', '[':
+		return decoder.ReadObject()
+	}
+
+	return nil, fmt.Errorf("unexpected field type '%c'", fieldType)
+}
+
+func (decoder *Decoder) readUTF() (string, error) {
+	length, err := decoder.readUint16()
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(decoder.reader, data)
+	if err != nil {
+		return "", err
+	}
+
+	return decodeModifiedUTF8(data), nil
+}
+
+func (decoder *Decoder) readUint16() (uint16, error) {
+	var data [2]byte
+	_, err := io.ReadFull(decoder.reader, data[:])
+	return binary.BigEndian.Uint16(data[:]), err
+}
+
+func (decoder *Decoder) readInt32() (int32, error) {
+	var data [4]byte
+	_, err := io.ReadFull(decoder.reader, data[:])
+	return int32(binary.BigEndian.Uint32(data[:])), err
+}
+
+func (decoder *Decoder) readInt64() (int64, error) {
+	var data [8]byte
+	_, err := io.ReadFull(decoder.reader, data[:])
+	return int64(binary.BigEndian.Uint64(data[:])), err
+}
+
+// decodeModifiedUTF8 decodes the Java modified UTF-8, where characters outside of
+// the basic plane are encoded as surrogate pairs and zero is encoded as two bytes.
+func decodeModifiedUTF8(data []byte) string {
+	chars := make([]uint16, 0, len(data))
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch {
+		case b < 0x80:
+			chars = append(chars, uint16(b))
+			i++
+		case b&0xe0 == 0xc0 && i+1 < len(data):
+			chars = append(chars, uint16(b&0x1f)<<6|uint16(data[i+1]&0x3f))
+			i += 2
+		case b&0xf0 == 0xe0 && i+2 < len(data):
+			chars = append(chars, uint16(b&0x0f)<<12|uint16(data[i+1]&0x3f)<<6|uint16(data[i+2]&0x3f))
+			i += 3
+		default:
+			chars = append(chars, utf16.Encode([]rune{0xfffd})...)
+			i++
+		}
+	}
+	return string(utf16.Decode(chars))
+}
+
+func encodeModifiedUTF8(value string) []byte {
+	var buffer bytes.Buffer
+	for _, char := range utf16.Encode([]rune(value)) {
+		switch {
+		case char != 0 && char < 0x80:
+			buffer.WriteByte(byte(char))
+		case char < 0x800:
+			buffer.WriteByte(byte(0xc0 | char>>6))
+			buffer.WriteByte(byte(0x80 | char&0x3f))
+		default:
+			buffer.WriteByte(byte(0xe0 | char>>12))
+			buffer.WriteByte(byte(0x80 | (char>>6)&0x3f))
+			buffer.WriteByte(byte(0x80 | char&0x3f))
+		}
+	}
+	return buffer.Bytes()
+}
+
+/*
+Encoder, writes just what RMI calls of the JMX connector need
+*/
+type Encoder struct {
+	buffer bytes.Buffer
+}
+
+func NewEncoder() *Encoder {
+	encoder := &Encoder{}
+	encoder.writeUint16(streamMagic)
+	encoder.writeUint16(streamVersion)
+	return encoder
+}
+
+func (encoder *Encoder) Bytes() []byte {
+	return encoder.buffer.Bytes()
+}
+
+// WriteBlockData writes primitive data.
+func (encoder *Encoder) WriteBlockData(data []byte) {
+	encoder.buffer.WriteByte(tcBlockData)
+	encoder.buffer.WriteByte(byte(len(data)))
+	encoder.buffer.Write(data)
+}
+
+func (encoder *Encoder) WriteNull() {
+	encoder.buffer.WriteByte(tcNull)
+}
+
+func (encoder *Encoder) WriteString(value string) {
+	data := encodeModifiedUTF8(value)
+	encoder.buffer.WriteByte(tcString)
+	encoder.writeUint16(uint16(len(data)))
+	encoder.buffer.Write(data)
+}
+
+// WriteStringArray writes java.lang.String[].
+func (encoder *Encoder) WriteStringArray(values []string) {
+	encoder.buffer.WriteByte(tcArray)
+	encoder.writeClassDesc("[Ljava.lang.String;", -5921575005990323385, scSerializable)
+	encoder.writeUint32(uint32(len(values)))
+	for _, value := range values {
+		encoder.WriteString(value)
+	}
+}
+
+// WriteObjectName writes javax.management.ObjectName.
+func (encoder *Encoder) WriteObjectName(name string) {
+	encoder.buffer.WriteByte(tcObject)
+	encoder.writeClassDesc("javax.management.ObjectName", 1081892073854801359, scSerializable|scWriteMethod)
+	encoder.WriteString(name)
+	encoder.buffer.WriteByte(tcEndBlockData)
+}
+
+// writeClassDesc writes a class descriptor without fields and super class, annotated
+// with the empty codebase location the RMI marshal streams expect.
+func (encoder *Encoder) writeClassDesc(name string, serialVersionUID int64, flags byte) {
+	data := encodeModifiedUTF8(name)
+	encoder.buffer.WriteByte(tcClassDesc)
+	encoder.writeUint16(uint16(len(data)))
+	encoder.buffer.Write(data)
+	encoder.writeUint64(uint64(serialVersionUID))
+	encoder.buffer.WriteByte(flags)
+	encoder.writeUint16(0)
+	encoder.buffer.WriteByte(tcNull)
+	encoder.buffer.WriteByte(tcEndBlockData)
+	encoder.buffer.WriteByte(tcNull)
+}
+
+func (encoder *Encoder) writeUint16(value uint16) {
+	var data [2]byte
+	binary.BigEndian.PutUint16(data[:], value)
+	encoder.buffer.Write(data[:])
+}
+
+func (encoder *Encoder) writeUint32(value uint32) {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], value)
+	encoder.buffer.Write(data[:])
+}
+
+func (encoder *Encoder) writeUint64(value uint64) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], value)
+	encoder.buffer.Write(data[:])
+}
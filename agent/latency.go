@@ -0,0 +1,107 @@
+package main
+
+import (
+	"agent/collector"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const networkLatencySummaryFileName = "network_latency.txt"
+
+// SummarizeNetworkLatency puts the round trip times measured on each node into the node-to-node matrix,
+// the nodes without measurements are left out. Nothing is saved when no node has measured them.
+func SummarizeNetworkLatency(root string) error {
+	nodesPath := filepath.Join(root, "nodes")
+	hosts, err := ioutil.ReadDir(nodesPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	latencies := make(map[string]collector.NetworkLatency)
+	peerSet := make(map[string]bool)
+	for _, host := range hosts {
+		data, err := ioutil.ReadFile(filepath.Join(nodesPath, host.Name(), "network", collector.NetworkLatencyFileName))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var latency collector.NetworkLatency
+		err = json.Unmarshal(data, &latency)
+		if err != nil {
+			return err
+		}
+		latencies[host.Name()] = latency
+		for peer := range latency.Peers {
+			peerSet[peer] = true
+		}
+	}
+	if len(latencies) == 0 {
+		return nil
+	}
+
+	nodes := make([]string, 0, len(latencies))
+	for node := range latencies {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	peers := make([]string, 0, len(peerSet))
+	for peer := range peerSet {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+
+	var summary bytes.Buffer
+	summary.WriteString("Average round trip time (ms) from the node (row) to the peer (column)\n\n")
+
+	table := tabwriter.NewWriter(&summary, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "FROM \\ TO\t%s\n", strings.Join(peers, "\t"))
+	for _, node := range nodes {
+		latency := latencies[node]
+
+		label := node
+		if len(latency.Addresses) > 0 {
+			label += " (" + strings.Join(latency.Addresses, ", ") + ")"
+		}
+
+		cells := make([]string, 0, len(peers))
+		for _, peer := range peers {
+			roundTrip, ok := latency.Peers[peer]
+			cells = append(cells, roundTripCell(roundTrip, ok))
+		}
+		fmt.Fprintf(table, "%s\t%s\n", label, strings.Join(cells, "\t"))
+	}
+	err = table.Flush()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(root, networkLatencySummaryFileName), summary.Bytes(), 0644)
+}
+
+func roundTripCell(roundTrip collector.PeerRoundTrip, measured bool) string {
+	switch {
+	case !measured:
+		return "-"
+	case roundTrip.Transmitted == 0:
+		return "error"
+	case roundTrip.Received == 0:
+		return "unreachable"
+	case roundTrip.Received < roundTrip.Transmitted:
+		loss := 100 * (roundTrip.Transmitted - roundTrip.Received) / roundTrip.Transmitted
+		return fmt.Sprintf("%.2f (%d%% loss)", roundTrip.AvgMs, loss)
+	}
+	return fmt.Sprintf("%.2f", roundTrip.AvgMs)
+}
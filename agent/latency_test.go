@@ -0,0 +1,55 @@
+package main
+
+import (
+	"agent/collector"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummarizeNetworkLatency(t *testing.T) {
+	root, err := ioutil.TempDir("", "bundle")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(root)
+
+	latencies := map[string]collector.NetworkLatency{
+		"10.0.0.1": {
+			Addresses: []string{"10.0.0.1"},
+			Peers: map[string]collector.PeerRoundTrip{
+				"10.0.0.2": {Transmitted: 5, Received: 4, AvgMs: 0.345},
+				"10.0.0.3": {Transmitted: 5, Received: 0},
+			},
+		},
+		"10.0.0.2": {
+			Addresses: []string{"10.0.0.2"},
+			Peers: map[string]collector.PeerRoundTrip{
+				"10.0.0.1": {Transmitted: 5, Received: 5, AvgMs: 0.3},
+				"10.0.0.3": {Error: "timeout"},
+			},
+		},
+	}
+	for host, latency := range latencies {
+		path := filepath.Join(root, "nodes", host, "network")
+		assert.NoError(t, os.MkdirAll(path, os.ModePerm))
+		data, _ := json.Marshal(latency)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(path, collector.NetworkLatencyFileName), data, 0644))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "nodes", "10.0.0.3", "network"), os.ModePerm))
+
+	err = SummarizeNetworkLatency(root)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(root, networkLatencySummaryFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, `Average round trip time (ms) from the node (row) to the peer (column)
+
+FROM \ TO            10.0.0.1  10.0.0.2         10.0.0.3
+10.0.0.1 (10.0.0.1)  -         0.34 (20% loss)  unreachable
+10.0.0.2 (10.0.0.2)  0.30      -                error
+`, string(data))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"agent/collector"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/mattn/go-colorable"
@@ -16,6 +17,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,23 +26,38 @@ const timestampPattern = "20060102T150405"
 const knownHostsPath = "/.ssh/known_hosts"
 const defaultPrivateKeyPath = "/.ssh/id_rsa"
 
+// Exit code of the collecting with a failed host or required task, the bundle is still created
+const requiredTasksFailedExitCode = 2
+
+// Exit code of the collecting without a bundle, e.g. anonymizing or compressing failed
+const bundleNotCreatedExitCode = 3
+
 var (
 	user               = flag.String("l", "", "User to log in as on the remote machine")
 	port               = flag.Int("p", 22, "Port to connect to on the remote host")
 	disableKnownHosts  = flag.Bool("disable_known_hosts", false, "Skip loading the user’s known-hosts file")
-	mcTimeRangeFrom    = flag.String("mc-from", "", "Datetime (RFC3339 format, 2006-01-02T15:04:05Z07:00) to fetch metrics from some time point. (Default 1970-01-01 00:00:00 +0000 UTC)")
-	mcTimeRangeTo      = flag.String("mc-to", "", "Datetime (RFC3339 format, 2006-01-02T15:04:05Z07:00) to fetch metrics to some time point. (Default current datetime)")
+	mcTimeRangeFrom    = flag.String("mc-from", "", "Datetime (RFC3339 format, 2006-01-02T15:04:05Z07:00) to fetch metrics and logs from some time point. (Default 1970-01-01 00:00:00 +0000 UTC)")
+	mcTimeRangeTo      = flag.String("mc-to", "", "Datetime (RFC3339 format, 2006-01-02T15:04:05Z07:00) to fetch metrics and logs to some time point. (Default current datetime)")
 	configPath         = flag.String("config", "", "The path to the configuration file")
 	generateConfigPath = flag.String("generate-config", "", "The path where the default settings file will be created")
+	anonymize          = flag.Bool("anonymize", false, "Replace IP addresses and hostnames with pseudonyms in the collected data, the mapping is saved next to the tarball")
+	tasks              = flag.String("tasks", "", "Comma separated node and metrics tasks to run, e.g. nodetool,logs (Default all enabled tasks)")
+	skipTasks          = flag.String("skip-tasks", "", "Comma separated node and metrics tasks not to run")
+	verifyBundlePath   = flag.String("verify-bundle", "", "The path of a collected data tarball to verify against its manifest, nothing is collected")
 
 	mcTargets   StringList
 	ncTargets   StringList
 	privateKeys StringList
 
-	collectingTimestamp = time.Now().UTC().Format(timestampPattern)
+	collectingStarted   = time.Now().UTC()
+	collectingTimestamp = collectingStarted.Format(timestampPattern)
 
 	mcTimestampFrom = time.Unix(0, 0).UTC()
 	mcTimestampTo   = time.Now().UTC()
+
+	// Logs are collected in full unless the time window is given
+	ncTimestampFrom time.Time
+	ncTimestampTo   time.Time
 )
 
 var log = logrus.New()
@@ -73,6 +90,11 @@ func main() {
 
 	initCommandLineParameters()
 
+	if len(*verifyBundlePath) > 0 {
+		verifyBundle(*verifyBundlePath)
+		return
+	}
+
 	// Settings
 	settings := &Settings{
 		Agent:   *AgentDefaultSettings(),
@@ -136,6 +158,7 @@ func main() {
 		Path:          filepath.Join(collectingPath, "metrics"),
 		TimestampFrom: mcTimestampFrom,
 		TimestampTo:   mcTimestampTo,
+		AppFs:         afero.NewOsFs(),
 	}
 
 	nodesCollector := collector.NodeCollector{
@@ -143,6 +166,35 @@ func main() {
 		Logger:   log,
 		Path:     filepath.Join(collectingPath, "nodes"),
 		AppFs:    afero.NewOsFs(),
+
+		TimestampFrom: ncTimestampFrom,
+		TimestampTo:   ncTimestampTo,
+	}
+
+	taskFilter := collector.TaskFilter{Only: settings.Agent.Tasks, Skip: settings.Agent.SkipTasks}
+	if len(*tasks) > 0 {
+		taskFilter.Only = collector.ParseTaskNames(*tasks)
+	}
+	if len(*skipTasks) > 0 {
+		taskFilter.Skip = collector.ParseTaskNames(*skipTasks)
+	}
+	knownTasks := append(nodesCollector.TaskNames(), metricsCollector.TaskNames()...)
+	err = taskFilter.Validate(knownTasks)
+	if err == nil {
+		err = (&collector.TaskFilter{Only: settings.Agent.RequiredTasks}).Validate(knownTasks)
+	}
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	nodesCollector.Tasks = taskFilter
+	metricsCollector.Tasks = taskFilter
+
+	summary := &collector.CollectingSummary{}
+	nodesCollector.Summary = summary
+	metricsCollector.Summary = summary
+	if len(taskFilter.Only) > 0 || len(taskFilter.Skip) > 0 {
+		log.Info("Collecting tasks: ", taskFilter.Only, ", skipped: ", taskFilter.Skip)
 	}
 
 	metricsTargets := JoinToSet(settings.Target.Metrics, mcTargets.items)
@@ -154,6 +206,16 @@ func main() {
 	log.Info("Metrics collecting hosts are: ", metricsTargets)
 	log.Info("Metrics collecting time span: ", mcTimestampFrom.UTC(), " ... ", mcTimestampTo.UTC())
 	log.Info("Node collecting hosts are: ", nodeTargets)
+	if !ncTimestampFrom.IsZero() || !ncTimestampTo.IsZero() {
+		log.Info("Node logs collecting time span: ", ncTimestampFrom.UTC(), " ... ", ncTimestampTo.UTC())
+	}
+
+	// The anonymization drops the binary files containing addresses, the whole snapshot would be lost
+	if (*anonymize || settings.Agent.Anonymization.Enabled) && len(metricsTargets) > 0 && metricsCollector.CollectsSnapshot() {
+		log.Error("Anonymization is not supported with the '", settings.Metrics.Backend, "' metrics snapshot, "+
+			"use the victoriametrics export mode, the thanos or mimir backend, or skip the 'metrics' task")
+		os.Exit(1)
+	}
 
 	taskCount := len(metricsTargets) + len(nodeTargets)
 
@@ -170,7 +232,7 @@ func main() {
 
 			err := metricsCollector.Collect(sshAgent)
 			if err != nil {
-				log.Error("Failed to collect metrics on '" + host + "'")
+				log.Error("Failed to collect metrics on '" + host + "' (" + err.Error() + ")")
 			}
 		}(host)
 	}
@@ -185,13 +247,36 @@ func main() {
 
 			err := nodesCollector.Collect(sshAgent)
 			if err != nil {
-				log.Error("Failed to collect node on '" + host + "'")
+				log.Error("Failed to collect node on '" + host + "' (" + err.Error() + ")")
 			}
 		}(host)
 	}
 
 	wg.Wait()
 
+	failures := reportCollectingSummary(summary, collectingPath, settings.Agent.RequiredTasks)
+
+	if settings.Node.Collecting.Network.Enabled && settings.Node.Collecting.Network.Latency {
+		err = SummarizeNetworkLatency(collectingPath)
+		if err != nil {
+			log.Error("Failed to summarize network latency (", err, ")")
+		}
+	}
+
+	if len(settings.Agent.MaxBundleSize) > 0 {
+		trimCollectedData(collectingPath, &settings.Agent)
+	}
+
+	var anonymizer *Anonymizer
+	if *anonymize || settings.Agent.Anonymization.Enabled {
+		anonymizer, err = anonymizeCollectedData(collectingPath, &settings.Agent.Anonymization, append(nodeTargets, metricsTargets...))
+		if err != nil {
+			// Never hand over the data partially anonymized
+			log.Error(err, ", the collected data is not compressed")
+			os.Exit(bundleNotCreatedExitCode)
+		}
+	}
+
 	// Compressing tarball
 	log.Info("Compressing collected data (", collectingPath, ")...")
 
@@ -204,15 +289,176 @@ func main() {
 		log.Warn("Failed to copy agent log to collecting folder: " + err.Error())
 	}
 
+	if anonymizer != nil {
+		_, err = anonymizer.AnonymizeFile(filepath.Join(collectingPath, "agent.log"))
+		if err != nil {
+			log.Error("Failed to anonymize agent log, removed from collecting folder (", err, ")")
+			os.Remove(filepath.Join(collectingPath, "agent.log"))
+		}
+
+		mappingPath := filepath.Join(collectingRootFolder, fmt.Sprint(collectingTimestamp, anonymizationMappingSuffix))
+		err = anonymizer.SaveMapping(mappingPath)
+		if err != nil {
+			log.Error("Failed to save anonymization mapping (", err, ")")
+		} else {
+			log.Info("Anonymization mapping (keep it, it is not a part of the tarball): ", mappingPath)
+		}
+	}
+
+	log.Info("Writing bundle manifest...")
+	err = newBundleManifest(settings, nodeTargets, metricsTargets, anonymizer).Save(collectingPath)
+	if err != nil {
+		log.Error("Failed to write bundle manifest (", err, ")")
+	} else {
+		log.Info("Writing bundle manifest  OK")
+	}
+
 	tarball := filepath.Join(collectingRootFolder, fmt.Sprint(collectingTimestamp, "-data.zip"))
 	err = Zip(collectingPath, tarball)
 	if err != nil {
 		log.Error("Failed to compress collected data (", err, ")")
-	} else {
-		log.Info("Compressing collected data  OK")
+		os.Exit(bundleNotCreatedExitCode)
 	}
+	log.Info("Compressing collected data  OK")
 
 	log.Info("Tarball: ", tarball)
+
+	if len(failures) > 0 {
+		log.Error("Collecting failed on ", failures)
+		os.Exit(requiredTasksFailedExitCode)
+	}
+}
+
+// newBundleManifest describes the collecting, the hosts are pseudonymized like in the collected data
+func newBundleManifest(settings *Settings, nodeTargets []string, metricsTargets []string, anonymizer *Anonymizer) *BundleManifest {
+	var replace func([]byte) []byte
+	if anonymizer != nil {
+		replace = anonymizer.Replace
+		nodeTargets = replaceAll(nodeTargets, replace)
+		metricsTargets = replaceAll(metricsTargets, replace)
+	}
+
+	manifest := &BundleManifest{
+		Agent: ManifestAgent{Version: version, Commit: commit},
+		Collecting: ManifestCollecting{
+			Timestamp:   collectingTimestamp,
+			Started:     collectingStarted,
+			Finished:    time.Now().UTC(),
+			MetricsFrom: mcTimestampFrom.UTC(),
+			MetricsTo:   mcTimestampTo.UTC(),
+			Anonymized:  anonymizer != nil,
+		},
+		Targets: ManifestTargets{Nodes: nodeTargets, Metrics: metricsTargets},
+	}
+	if !ncTimestampFrom.IsZero() {
+		from := ncTimestampFrom.UTC()
+		manifest.Collecting.LogsFrom = &from
+	}
+	if !ncTimestampTo.IsZero() {
+		to := ncTimestampTo.UTC()
+		manifest.Collecting.LogsTo = &to
+	}
+
+	values, err := sanitizedSettings(settings, replace)
+	if err != nil {
+		log.Warn(err, ", the settings are not a part of the manifest")
+	}
+	manifest.Settings = values
+
+	return manifest
+}
+
+func replaceAll(values []string, replace func([]byte) []byte) []string {
+	replaced := make([]string, 0, len(values))
+	for _, value := range values {
+		replaced = append(replaced, string(replace([]byte(value))))
+	}
+	return replaced
+}
+
+func verifyBundle(path string) {
+	log.Info("Verifying bundle '", path, "'...")
+	manifest, problems, err := VerifyBundle(path)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	log.Info("Bundle collected by agent ", manifest.Agent.Version, " (", manifest.Agent.Commit, ") at ",
+		manifest.Collecting.Timestamp, ", ", len(manifest.Files), " files")
+	for _, problem := range problems {
+		log.Error(problem)
+	}
+	if len(problems) > 0 {
+		log.Error("Verifying bundle failed, ", len(problems), " problems found")
+		os.Exit(1)
+	}
+	log.Info("Verifying bundle  OK")
+}
+
+// reportCollectingSummary logs and saves the summary, and returns the failed hosts and required tasks
+func reportCollectingSummary(summary *collector.CollectingSummary, collectingPath string, required []string) []string {
+	log.Info("Collecting summary:")
+	for _, line := range strings.Split(strings.TrimRight(summary.Table(), "\n"), "\n") {
+		log.Info(line)
+	}
+
+	err := summary.Save(afero.NewOsFs(), collectingPath)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return summary.RequiredFailures(required)
+}
+
+func trimCollectedData(collectingPath string, settings *AgentSettings) {
+	maxSize, err := collector.ParseSize(settings.MaxBundleSize)
+	if err != nil {
+		log.Error("Failed to check bundle size budget (", err, ")")
+		return
+	}
+
+	log.Info("Trimming collected data to ", collector.HumanSize(float64(maxSize)), "...")
+	metadata, err := TrimToBudget(collectingPath, maxSize, settings.BundlePriorities)
+	if err != nil {
+		log.Error("Failed to trim collected data (", err, ")")
+		return
+	}
+
+	for _, artifact := range metadata.Dropped {
+		log.Warn("Dropped '", artifact.Path, "' (", artifact.Class, ", ", collector.HumanSize(float64(artifact.Size)), ")")
+	}
+	if metadata.BundleSize > maxSize {
+		log.Warn("Collected data ", collector.HumanSize(float64(metadata.BundleSize)), " exceeds the budget, ",
+			"the rest has no trimming priority")
+	}
+
+	err = metadata.Save(collectingPath)
+	if err != nil {
+		log.Error("Failed to save bundle metadata (", err, ")")
+		return
+	}
+	log.Info("Trimming collected data  OK")
+}
+
+func anonymizeCollectedData(collectingPath string, settings *AnonymizationSettings, hosts []string) (*Anonymizer, error) {
+	anonymizer, err := NewAnonymizer(settings, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Anonymizing collected data...")
+	dropped, err := anonymizer.Anonymize(collectingPath)
+	if err != nil {
+		return nil, errors.New("Failed to anonymize collected data (" + err.Error() + ")")
+	}
+
+	for _, path := range dropped {
+		log.Warn("Dropped '", path, "' (binary file containing addresses)")
+	}
+	log.Info("Anonymizing collected data  OK")
+
+	return anonymizer, nil
 }
 
 func loadKnownHostsKey() ssh.HostKeyCallback {
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"agent/collector"
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const bundleManifestFileName = "manifest.json"
+const bundleManifestFormat = 1
+
+const redactedSetting = "<redacted>"
+
+// Set by the build, e.g. go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+type BundleManifest struct {
+	Format     int                    `json:"format"`
+	Agent      ManifestAgent          `json:"agent"`
+	Collecting ManifestCollecting     `json:"collecting"`
+	Targets    ManifestTargets        `json:"targets"`
+	Settings   map[string]interface{} `json:"settings"`
+	Files      []ManifestFile         `json:"files"`
+}
+
+type ManifestAgent struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+type ManifestCollecting struct {
+	Timestamp   string     `json:"timestamp"`
+	Started     time.Time  `json:"started"`
+	Finished    time.Time  `json:"finished"`
+	MetricsFrom time.Time  `json:"metrics-from"`
+	MetricsTo   time.Time  `json:"metrics-to"`
+	LogsFrom    *time.Time `json:"logs-from,omitempty"`
+	LogsTo      *time.Time `json:"logs-to,omitempty"`
+	Anonymized  bool       `json:"anonymized"`
+}
+
+type ManifestTargets struct {
+	Nodes   []string `json:"nodes"`
+	Metrics []string `json:"metrics"`
+}
+
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// sanitizedSettings returns the settings as saved in the settings file without the secrets, transform (if any)
+// is applied to the encoded settings, e.g. to anonymize the hosts
+func sanitizedSettings(settings *Settings, transform func([]byte) []byte) (map[string]interface{}, error) {
+	sanitized := *settings
+
+	// The nodetool, JMX and CQL credentials
+	cassandra := &sanitized.Node.Cassandra
+	cassandra.Username = redactSetting(cassandra.Username)
+	cassandra.Password = redactSetting(cassandra.Password)
+	cassandra.PasswordFile = redactSetting(cassandra.PasswordFile)
+
+	// The custom commands may carry secrets, e.g. a curl with a token, the slice is shared with the settings
+	tasks := make([]collector.CustomTaskSettings, len(sanitized.Node.CustomTasks))
+	copy(tasks, sanitized.Node.CustomTasks)
+	for index := range tasks {
+		tasks[index].Command = redactSetting(tasks[index].Command)
+	}
+	sanitized.Node.CustomTasks = tasks
+
+	// The basic auth credentials of the metrics backends
+	sanitized.Metrics.Thanos.URL = redactURLPassword(sanitized.Metrics.Thanos.URL)
+	sanitized.Metrics.Mimir.URL = redactURLPassword(sanitized.Metrics.Mimir.URL)
+
+	data, err := yaml.Marshal(&sanitized)
+	if err != nil {
+		return nil, errors.New("Failed to marshal settings (" + err.Error() + ")")
+	}
+	if transform != nil {
+		data = transform(data)
+	}
+
+	values := make(map[string]interface{})
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal settings (" + err.Error() + ")")
+	}
+
+	return values, nil
+}
+
+func redactSetting(value string) string {
+	if len(value) == 0 {
+		return value
+	}
+	return redactedSetting
+}
+
+// redactURLPassword replaces the password of the URL user info, e.g. http://user:<redacted>@host
+func redactURLPassword(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.User == nil {
+		return value
+	}
+	if _, ok := parsed.User.Password(); !ok {
+		return value
+	}
+
+	username := parsed.User.Username()
+	parsed.User = nil
+	return strings.Replace(parsed.String(), "://", "://"+url.PathEscape(username)+":"+redactedSetting+"@", 1)
+}
+
+// ListBundleFiles checksums the collected files, the manifest itself excluded
+func ListBundleFiles(root string) ([]ManifestFile, error) {
+	files := make([]ManifestFile, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+		if relative == bundleManifestFileName {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		size, checksum, err := checksumReader(file)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, ManifestFile{Path: relative, Size: size, SHA256: checksum})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// Save lists the collected files and writes the manifest at the bundle root
+func (manifest *BundleManifest) Save(root string) error {
+	files, err := ListBundleFiles(root)
+	if err != nil {
+		return errors.New("Failed to checksum collected files (" + err.Error() + ")")
+	}
+	manifest.Format = bundleManifestFormat
+	manifest.Files = files
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.New("Failed to marshal bundle manifest (" + err.Error() + ")")
+	}
+
+	return ioutil.WriteFile(filepath.Join(root, bundleManifestFileName), data, 0644)
+}
+
+// VerifyBundle checks the bundle files against its manifest, and returns the problems found
+func VerifyBundle(path string) (*BundleManifest, []string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, errors.New("Failed to open bundle (" + err.Error() + ")")
+	}
+	defer archive.Close()
+
+	entries := make(map[string]*zip.File)
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		entries[strings.TrimPrefix(entry.Name, "./")] = entry
+	}
+
+	entry, ok := entries[bundleManifestFileName]
+	if !ok {
+		return nil, nil, errors.New("Failed to find bundle manifest, the bundle has no " + bundleManifestFileName)
+	}
+	manifest := &BundleManifest{}
+	err = readZipJSON(entry, manifest)
+	if err != nil {
+		return nil, nil, errors.New("Failed to read bundle manifest (" + err.Error() + ")")
+	}
+	if manifest.Format > bundleManifestFormat {
+		return nil, nil, errors.New(fmt.Sprint("Unsupported bundle manifest format ", manifest.Format))
+	}
+	delete(entries, bundleManifestFileName)
+
+	problems := make([]string, 0)
+	for _, file := range manifest.Files {
+		entry, ok := entries[file.Path]
+		if !ok {
+			problems = append(problems, "Missing file '"+file.Path+"'")
+			continue
+		}
+		delete(entries, file.Path)
+
+		size, checksum, err := checksumZipFile(entry)
+		if err != nil {
+			problems = append(problems, "Failed to read file '"+file.Path+"' ("+err.Error()+")")
+			continue
+		}
+		if size != file.Size {
+			problems = append(problems, fmt.Sprint("Size mismatch of file '", file.Path, "' (", size, " bytes, expected ", file.Size, ")"))
+		} else if checksum != file.SHA256 {
+			problems = append(problems, "Checksum mismatch of file '"+file.Path+"'")
+		}
+	}
+
+	unlisted := make([]string, 0)
+	for name := range entries {
+		unlisted = append(unlisted, name)
+	}
+	sort.Strings(unlisted)
+	for _, name := range unlisted {
+		problems = append(problems, "Unlisted file '"+name+"'")
+	}
+
+	return manifest, problems, nil
+}
+
+func readZipJSON(entry *zip.File, value interface{}) error {
+	reader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return json.NewDecoder(reader).Decode(value)
+}
+
+func checksumZipFile(entry *zip.File) (int64, string, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return 0, "", err
+	}
+	defer reader.Close()
+
+	return checksumReader(reader)
+}
+
+func checksumReader(reader io.Reader) (int64, string, error) {
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -15,11 +15,43 @@ const defaultProfileContainerName = "DEFAULT"
 
 type AgentSettings struct {
 	CollectedDataPath string `yaml:"collected-data-path"`
+
+	// Size of the collected data (e.g. "500MB"), empty for no limit
+	MaxBundleSize string `yaml:"max-bundle-size"`
+	// Artifact classes priorities, the lower priority data is trimmed first
+	BundlePriorities map[string]int `yaml:"bundle-priorities"`
+
+	Anonymization AnonymizationSettings `yaml:"anonymization"`
+
+	// Node and metrics task names, all the enabled tasks run when Tasks is empty
+	Tasks     []string `yaml:"tasks"`
+	SkipTasks []string `yaml:"skip-tasks"`
+	// The agent exits with an error when any of them fails on any host
+	RequiredTasks []string `yaml:"required-tasks"`
 }
 
 func AgentDefaultSettings() *AgentSettings {
 	return &AgentSettings{
 		CollectedDataPath: "~/.instaclustr/supportcenter/DATA",
+		MaxBundleSize:     "",
+		BundlePriorities: map[string]int{
+			"metrics":     1,
+			"gc-logs":     2,
+			"logs":        3,
+			"sstables":    4,
+			"custom":      5,
+			"jvm":         6,
+			"maintenance": 7,
+			"network":     8,
+			"os":          9,
+			"cql":         10,
+			"info":        11,
+			"config":      12,
+		},
+		Anonymization: *AnonymizationDefaultSettings(),
+		Tasks:         []string{},
+		SkipTasks:     []string{},
+		RequiredTasks: []string{"config", "logs", "nodetool", "metrics"},
 	}
 }
 
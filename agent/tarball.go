@@ -28,12 +28,20 @@ func Zip(source string, target string) error {
 			return err
 		}
 
-		header.Name = "." + strings.TrimPrefix(path, source)
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		// The zip entry names are slash separated on every platform
+		header.Name = "./"
+		if relative != "." {
+			header.Name += filepath.ToSlash(relative)
+		}
 
 		if info.IsDir() {
-			header.Name += "/"
+			header.Name = strings.TrimSuffix(header.Name, "/") + "/"
 		} else {
-			if filepath.Ext(info.Name()) == ".tar" {
+			if ext := filepath.Ext(info.Name()); ext == ".tar" || ext == ".gz" {
 				header.Method = zip.Store
 			} else {
 				header.Method = zip.Deflate
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"archive/zip"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZip(t *testing.T) {
+	root, err := ioutil.TempDir("", "bundle")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(root)
+
+	collectingPath := filepath.Join(root, "collecting")
+	for _, path := range []string{"agent.log", "nodes/10.0.0.1/logs/system.log.1.gz"} {
+		path = filepath.Join(collectingPath, filepath.FromSlash(path))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile(path, []byte("log"), 0644))
+	}
+
+	bundle := filepath.Join(root, "bundle.zip")
+	assert.NoError(t, Zip(collectingPath, bundle))
+
+	reader, err := zip.OpenReader(bundle)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer reader.Close()
+
+	methods := make(map[string]uint16)
+	for _, entry := range reader.File {
+		methods[entry.Name] = entry.Method
+	}
+	assert.Equal(t, map[string]uint16{
+		"./":                                    zip.Store,
+		"./agent.log":                           zip.Deflate,
+		"./nodes/":                              zip.Store,
+		"./nodes/10.0.0.1/":                     zip.Store,
+		"./nodes/10.0.0.1/logs/":                zip.Store,
+		"./nodes/10.0.0.1/logs/system.log.1.gz": zip.Store,
+	}, methods)
+}
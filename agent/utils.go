@@ -71,7 +71,7 @@ func printParameterUsage(parameter *flag.Flag) {
 }
 
 func parseAndValidateCommandLineArguments() {
-	if *user == "" {
+	if *user == "" && *verifyBundlePath == "" {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -85,6 +85,7 @@ func parseAndValidateCommandLineArguments() {
 			os.Exit(1)
 		}
 		mcTimestampFrom = timestamp
+		ncTimestampFrom = timestamp
 	}
 
 	if len(strings.TrimSpace(*mcTimeRangeTo)) > 0 {
@@ -96,6 +97,7 @@ func parseAndValidateCommandLineArguments() {
 			os.Exit(1)
 		}
 		mcTimestampTo = timestamp
+		ncTimestampTo = timestamp
 	}
 
 	if mcTimestampFrom.After(mcTimestampTo) {
@@ -3,6 +3,7 @@
 DATA_DIR="./data"
 METRICS_PATH="$DATA_DIR/metrics/snapshot/"
 METRICS_PACKAGE="$METRICS_PATH/InstaclustrCollection.tar"
+METRICS_COMPRESSED_PACKAGE="$METRICS_PACKAGE.gz"
 
 if [ -z "$1" ]; then
   echo "No tarball supplied"
@@ -17,8 +18,60 @@ mkdir $DATA_DIR
 # Extract collected info in data folder
 unzip $1 -d $DATA_DIR
 
+# Verify the extracted files against the bundle manifest (the bundles of older agents have none)
+if [ -f "$DATA_DIR/manifest.json" ]; then
+  python3 - "$DATA_DIR" <<'EOF_VERIFY'
+import hashlib, json, os, sys
+
+root = sys.argv[1]
+with open(os.path.join(root, "manifest.json")) as f:
+    manifest = json.load(f)
+
+agent = manifest.get("agent", {})
+print("Bundle collected by agent %s (%s) at %s" % (agent.get("version"), agent.get("commit"), manifest.get("collecting", {}).get("timestamp")))
+
+problems = []
+listed = set()
+for file in manifest.get("files", []):
+    listed.add(file["path"])
+    path = os.path.join(root, *file["path"].split("/"))
+    if not os.path.isfile(path):
+        problems.append("Missing file '%s'" % file["path"])
+        continue
+    digest = hashlib.sha256()
+    with open(path, "rb") as f:
+        for chunk in iter(lambda: f.read(1 << 20), b""):
+            digest.update(chunk)
+    if os.path.getsize(path) != file["size"]:
+        problems.append("Size mismatch of file '%s'" % file["path"])
+    elif digest.hexdigest() != file["sha256"]:
+        problems.append("Checksum mismatch of file '%s'" % file["path"])
+
+for folder, _, names in os.walk(root):
+    for name in names:
+        relative = os.path.relpath(os.path.join(folder, name), root).replace(os.sep, "/")
+        if relative != "manifest.json" and relative not in listed:
+            problems.append("Unlisted file '%s'" % relative)
+
+for problem in problems:
+    print(problem)
+sys.exit(1 if problems else 0)
+EOF_VERIFY
+  if [ $? -ne 0 ]; then
+    echo "The bundle does not match its manifest"
+    if [ -z "$SKIP_VERIFY" ]; then
+      echo "Set SKIP_VERIFY=1 to analyze it anyway"
+      exit 1
+    fi
+  fi
+else
+  echo "No bundle manifest, the bundle is not verified"
+fi
+
 if [ -f "$METRICS_PACKAGE" ]; then
   tar -vxf $METRICS_PACKAGE -C $METRICS_PATH
+elif [ -f "$METRICS_COMPRESSED_PACKAGE" ]; then
+  tar -vxzf $METRICS_COMPRESSED_PACKAGE -C $METRICS_PATH
 fi
 
 # Start dockers